@@ -0,0 +1,212 @@
+package myplainkv
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// accessBatch is the number of read keys held in memory before their
+	// access times are written
+	accessBatch int = 256
+)
+
+// accessLog holds the keys read since access times were last written
+type accessLog struct {
+	mu      sync.Mutex
+	keys    map[string]map[string]bool
+	n       int
+	flushed time.Time
+}
+
+// add records a read key and reports whether the log is due to be written
+func (l *accessLog) add(bucket, key string, every time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.keys == nil {
+		l.keys = make(map[string]map[string]bool)
+		l.flushed = time.Now()
+	}
+	if l.keys[bucket] == nil {
+		l.keys[bucket] = make(map[string]bool)
+	}
+	if !l.keys[bucket][key] {
+		l.keys[bucket][key] = true
+		l.n++
+	}
+	return l.n >= accessBatch || time.Since(l.flushed) >= every
+}
+
+// take empties the log and returns the keys it held by bucket
+func (l *accessLog) take() map[string]map[string]bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := l.keys
+	l.keys, l.n, l.flushed = nil, 0, time.Now()
+	return keys
+}
+
+// touch records that a key was read, writing the access times of the
+// keys read so far once enough have gathered. Errors are dropped, as a
+// failed write only makes keys look idle for longer. The connection
+// must be open.
+func (p *MyPlainKV) touch(bucket, key string) {
+	if !p.shared().accesses.add(bucket, key, p.AccessResolution) || p.inTransaction {
+		// Writing from a transaction would hold row locks until it ends
+		return
+	}
+	p.flushAccess()
+}
+
+// FlushAccess writes the access times of keys read since they were last
+// written. Reads record access times in batches when AccessResolution is
+// set, so call it before closing a store for good to keep the last batch.
+func (p *MyPlainKV) FlushAccess() (err error) {
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	return p.flushAccess()
+}
+
+// flushAccess writes the logged access times. Keys accessed within the
+// resolution are skipped, so a hot key costs at most one write per
+// resolution. The connection must be open.
+func (p *MyPlainKV) flushAccess() error {
+	for bucket, keys := range p.shared().accesses.take() {
+		batch := make([]string, 0, len(keys))
+		for k := range keys {
+			batch = append(batch, k)
+		}
+		for len(batch) > 0 {
+			n := len(batch)
+			if n > batchSize {
+				n = batchSize
+			}
+			args := []any{bucket}
+			for _, k := range batch[:n] {
+				args = append(args, k)
+			}
+			args = append(args, p.AccessResolution.Seconds())
+			// A read is not an update, so UpdatedAt is kept
+			sqlstr := `UPDATE ` + p.defTableName + ` SET AccessedAt = NOW(), UpdatedAt = UpdatedAt
+			WHERE Bucket = ? AND KeyID IN (` + placeholders(n, `?`) + `)
+			AND AccessedAt < NOW() - INTERVAL ? SECOND;`
+			if _, err := p.exec(sqlstr, args...); err != nil {
+				return err
+			}
+			batch = batch[n:]
+		}
+	}
+	return nil
+}
+
+// EvictIdle deletes the keys of the current bucket not read for idle,
+// along with their aliases, chunks and references. Writes
+// do not count as access, so a cached value rewritten on a schedule is
+// still evicted if nothing reads it. New keys count as read when
+// created. It returns the number of keys deleted.
+func (p *MyPlainKV) EvictIdle(idle time.Duration) (int64, error) {
+	return p.evictIdle(p.currBuckt, idle)
+}
+
+func (p *MyPlainKV) evictIdle(bucket string, idle time.Duration) (n int64, err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return 0, err
+	}
+	if p.autoClose {
+		// Keep the connection across the batches
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return 0, err
+	}
+	bucket = p.bucket(bucket)
+	// Reads of this instance must count before keys are judged idle
+	if err = p.flushAccess(); err != nil {
+		return 0, err
+	}
+	secs := idle.Seconds()
+	sqlstr := `SELECT KeyID FROM ` + p.defTableName + `
+	WHERE Bucket = ? AND AccessedAt < NOW() - INTERVAL ? SECOND LIMIT ?;`
+	for {
+		keys := make([]string, 0, sweepBatch)
+		sqr, err := p.query(sqlstr, bucket, secs, sweepBatch)
+		if err != nil {
+			return n, err
+		}
+		for sqr.Next() {
+			var k string
+			if err = sqr.Scan(&k); err != nil {
+				sqr.Close()
+				return n, err
+			}
+			keys = append(keys, k)
+		}
+		sqr.Close()
+		if err = sqr.Err(); err != nil {
+			return n, err
+		}
+		for _, k := range keys {
+			// The key may have been read since it was listed
+			ok, err := p.purge(bucket, k, `AccessedAt < NOW() - INTERVAL ? SECOND`, secs)
+			if err != nil {
+				return n, err
+			}
+			if ok {
+				n++
+			}
+		}
+		if len(keys) < sweepBatch {
+			p.record(start, n)
+			return n, nil
+		}
+	}
+}
+
+// StartIdleEvictor starts evicting the keys of a bucket not read for
+// idle every interval, as EvictIdle does. It runs on a session of the
+// store, so the reads the store has not written out yet count, and skips
+// its turn while the store is in maintenance. Calling the returned
+// function stops it.
+func (p *MyPlainKV) StartIdleEvictor(bucket string, idle, interval time.Duration) (stop func()) {
+	ev := p.Session()
+	bucket = p.bucket(bucket)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				ev.Close()
+				return
+			case <-t.C:
+				// Errors are left for the next turn to retry
+				ev.evictIdle(bucket, idle)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// EvictIdle deletes the keys of the bucket not read for idle
+func (b *Bucket) EvictIdle(idle time.Duration) (int64, error) {
+	return b.kv.evictIdle(b.name, idle)
+}
@@ -0,0 +1,58 @@
+package myplainkv
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrLockTimeout error = errors.New(`timed out waiting for lock`)
+)
+
+// WithAdvisoryLock runs fn while holding the MySQL advisory lock name,
+// waiting up to timeout for it with GET_LOCK. A negative timeout waits
+// indefinitely. The lock is held by a connection pinned for the
+// duration, so the server releases it if that connection drops. fn
+// itself runs on the store as usual.
+func (p *MyPlainKV) WithAdvisoryLock(name string, timeout time.Duration, fn func() error) (err error) {
+	var (
+		got  sql.NullInt64
+		conn *sql.Conn
+	)
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		// Keep the pool until fn completes
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	ctx := p.callCtx()
+	if conn, err = p.db.Conn(ctx); err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	secs := timeout.Seconds()
+	if timeout < 0 {
+		secs = -1
+	}
+	if err = conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?);`, name, secs).Scan(&got); err != nil {
+		return err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return ErrLockTimeout
+	}
+	defer func() {
+		// The caller's context may be done by now, but the lock must
+		// still be released
+		conn.ExecContext(context.Background(), `DO RELEASE_LOCK(?);`, name)
+	}()
+	return fn()
+}
@@ -0,0 +1,74 @@
+package myplainkv
+
+import (
+	"errors"
+)
+
+const (
+	aliasBuckt    string = `--alias--`
+	maxAliasDepth int    = 16
+)
+
+var (
+	ErrAliasLoop error = errors.New(`alias loop detected`)
+	ErrNoTarget  error = errors.New(`alias target is empty`)
+)
+
+// aliasBucket returns the bucket holding the aliases of a bucket
+func aliasBucket(bucket string) string {
+	return aliasBuckt + bucket
+}
+
+// Alias makes aliasKey resolve to the value of targetKey on Get.
+// A value set directly under aliasKey takes precedence over the alias.
+// Deleting the target leaves the alias in place, resolving to nothing.
+func (p *MyPlainKV) Alias(aliasKey, targetKey string) error {
+	return p.alias(p.currBuckt, aliasKey, targetKey)
+}
+
+// ResolveAlias returns the key an alias finally points to.
+// A key that is not an alias resolves to itself.
+func (p *MyPlainKV) ResolveAlias(key string) (string, error) {
+	return p.resolveAlias(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) alias(bucket, aliasKey, targetKey string) error {
+	if targetKey == "" {
+		return ErrNoTarget
+	}
+	if aliasKey == targetKey {
+		return ErrAliasLoop
+	}
+	bucket = p.bucket(bucket)
+	p.shared().misses.forget(bucket, aliasKey)
+	return p.set(aliasBucket(bucket), aliasKey, []byte(targetKey))
+}
+
+func (p *MyPlainKV) resolveAlias(bucket, key string) (string, error) {
+	bucket = p.bucket(bucket)
+	seen := make(map[string]bool)
+	for {
+		target, err := p.get(aliasBucket(bucket), key)
+		if err != nil {
+			return key, err
+		}
+		if len(target) == 0 {
+			return key, nil
+		}
+		seen[key] = true
+		key = string(target)
+		if seen[key] || len(seen) > maxAliasDepth {
+			return key, ErrAliasLoop
+		}
+	}
+}
+
+// Alias makes aliasKey resolve to the value of targetKey in the bucket
+func (b *Bucket) Alias(aliasKey, targetKey string) error {
+	return b.kv.alias(b.name, aliasKey, targetKey)
+}
+
+// ResolveAlias returns the key an alias in the bucket finally points to
+func (b *Bucket) ResolveAlias(key string) (string, error) {
+	return b.kv.resolveAlias(b.name, key)
+}
@@ -0,0 +1,312 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// batchSize is the number of keys sent in one batch statement, keeping
+// well under the limit of placeholders in a prepared statement
+const batchSize int = 500
+
+// placeholders returns n copies of tuple separated by commas
+func placeholders(n int, tuple string) string {
+	return strings.TrimSuffix(strings.Repeat(tuple+`, `, n), `, `)
+}
+
+// MSet creates or updates several records, sending one multi-row
+// statement per 500 keys, in one transaction. Values too large for a
+// single row are stored one by one, as in Set.
+func (p *MyPlainKV) MSet(values map[string][]byte) error {
+	return p.mset(p.currBuckt, values)
+}
+
+func (p *MyPlainKV) mset(bucket string, values map[string][]byte) (err error) {
+	var (
+		ra int64
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return ErrReadOnlyView
+	}
+	if len(bucket) > 50 {
+		return ErrBucketIdTooLong
+	}
+	keys := make([]string, 0, len(values))
+	large := make([]string, 0)
+	for k, v := range values {
+		if len(k) > 300 {
+			return ErrKeyTooLong
+		}
+		if len(v) > maxValueLen {
+			if !p.ChunkOversized {
+				return ErrValueTooLong
+			}
+			large = append(large, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return err
+	}
+
+	err = p.atomic(func() error {
+		if p.ChunkOversized {
+			// Keys set to plain values may have held chunked ones
+			if err := p.unchunk(bucket, keys); err != nil {
+				return err
+			}
+		}
+		for len(keys) > 0 {
+			n := len(keys)
+			if n > batchSize {
+				n = batchSize
+			}
+			args := make([]any, 0, n*3)
+			for _, k := range keys[:n] {
+				p.shared().misses.forget(bucket, k)
+				args = append(args, bucket, k, values[k])
+			}
+			sqlstr := `INSERT INTO ` + p.defTableName + ` (Bucket, KeyID, Value) VALUES ` +
+				placeholders(n, `(?, ?, ?)`) + `
+			ON DUPLICATE KEY UPDATE ` + renewed + `, Value=VALUES(Value), ExpiresAt=NULL, Version=Version+1;`
+			res, err := p.exec(sqlstr, args...)
+			if err != nil {
+				return err
+			}
+			c, _ := res.RowsAffected()
+			ra += c
+			keys = keys[n:]
+		}
+		for _, k := range large {
+			if err := p.set(bucket, k, values[k]); err != nil {
+				return err
+			}
+			ra++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.record(start, ra)
+	return nil
+}
+
+// MGet retrieves several records, sending one query per 500 keys.
+// Missing keys are left out of the result. Aliases and chunked values
+// are followed with a query of their own.
+func (p *MyPlainKV) MGet(keys []string) (map[string][]byte, error) {
+	return p.mget(p.currBuckt, keys)
+}
+
+func (p *MyPlainKV) mget(bucket string, keys []string) (vals map[string][]byte, err error) {
+	const (
+		rowValue int = iota
+		rowAlias
+		rowManifest
+	)
+	var (
+		k    string
+		kind int
+		raw  sql.RawBytes
+		sqr  *sql.Rows
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	vals = make(map[string][]byte, len(keys))
+	if err = p.Open(); err != nil {
+		return vals, err
+	}
+	if p.autoClose {
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	bucket = p.bucket(bucket)
+
+	// Keys that a single query cannot resolve are read one by one
+	slow := make([]string, 0)
+	if p.shared().views.get(bucket) != nil {
+		slow = keys
+		keys = nil
+	}
+	ab, cb := aliasBucket(bucket), chunkBucket(bucket)
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > batchSize {
+			n = batchSize
+		}
+		args := []any{bucket, ab, bucket, ab, cb}
+		for _, k := range keys[:n] {
+			args = append(args, k)
+		}
+		sqlstr := `
+		SELECT KeyID, CASE WHEN Bucket=? THEN 0 WHEN Bucket=? THEN 1 ELSE 2 END AS Kind, Value
+		FROM ` + p.defTableName + `
+		WHERE Bucket IN (?, ?, ?) AND KeyID IN (` + placeholders(n, `?`) + `) AND ` + notExpired + `;`
+		if sqr, err = p.query(sqlstr, args...); err != nil {
+			return vals, err
+		}
+		manifests := make(map[string][]byte)
+		aliased := make(map[string]bool)
+		for sqr.Next() {
+			if err = sqr.Scan(&k, &kind, &raw); err != nil {
+				sqr.Close()
+				return vals, err
+			}
+			switch kind {
+			case rowManifest:
+				manifests[k] = append([]byte{}, raw...)
+			case rowAlias:
+				aliased[k] = true
+			default:
+				vals[k] = append([]byte{}, raw...)
+			}
+		}
+		sqr.Close()
+		if err = sqr.Err(); err != nil {
+			return vals, err
+		}
+		for k, m := range manifests {
+			if v, ok := vals[k]; ok && isManifest(v, m) {
+				delete(vals, k)
+				slow = append(slow, k)
+			}
+		}
+		for k := range aliased {
+			if _, ok := vals[k]; !ok {
+				slow = append(slow, k)
+			}
+		}
+		keys = keys[n:]
+	}
+
+	for _, k := range slow {
+		val := make([]byte, 0)
+		found, err := p.getRaw(bucket, k, func(raw sql.RawBytes) error {
+			val = append(val, raw...)
+			return nil
+		})
+		if err != nil {
+			return vals, err
+		}
+		if found {
+			vals[k] = val
+		}
+	}
+	p.record(start, int64(len(vals)))
+	return vals, nil
+}
+
+// MDel deletes several records, sending one statement per 500 keys for
+// each kind of row attached to them, in one transaction. With RefDelete
+// set to RefBlock or RefCascade, keys are deleted one by one, as in Del.
+func (p *MyPlainKV) MDel(keys []string) error {
+	return p.mdel(p.currBuckt, keys)
+}
+
+func (p *MyPlainKV) mdel(bucket string, keys []string) (err error) {
+	var (
+		ra int64
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return ErrReadOnlyView
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return err
+	}
+
+	err = p.atomic(func() error {
+		if p.RefDelete != RefUnlink {
+			for _, k := range keys {
+				if err := p.del(bucket, k); err != nil {
+					return err
+				}
+				ra += p.lastRes.RowsAffected
+			}
+			return nil
+		}
+		for len(keys) > 0 {
+			n := len(keys)
+			if n > batchSize {
+				n = batchSize
+			}
+			batch := keys[:n]
+			in := placeholders(n, `?`)
+			args := make([]any, 0, n+3)
+			for _, k := range batch {
+				args = append(args, k)
+			}
+
+			// Only chunked values have parts to drop
+			sqr, err := p.query(`SELECT KeyID FROM `+p.defTableName+` WHERE Bucket = ? AND KeyID IN (`+in+`);`,
+				append([]any{chunkBucket(bucket)}, args...)...)
+			if err != nil {
+				return err
+			}
+			chunked := make([]string, 0)
+			for sqr.Next() {
+				var k string
+				if err = sqr.Scan(&k); err != nil {
+					sqr.Close()
+					return err
+				}
+				chunked = append(chunked, k)
+			}
+			sqr.Close()
+			if err = sqr.Err(); err != nil {
+				return err
+			}
+
+			res, err := p.exec(`DELETE FROM `+p.defTableName+` WHERE Bucket = ? AND KeyID IN (`+in+`);`,
+				append([]any{bucket}, args...)...)
+			if err != nil {
+				return err
+			}
+			c, _ := res.RowsAffected()
+			ra += c
+			_, err = p.exec(`DELETE FROM `+p.defTableName+` WHERE Bucket IN (?, ?) AND KeyID IN (`+in+`);`,
+				append([]any{aliasBucket(bucket), chunkBucket(bucket)}, args...)...)
+			if err != nil {
+				return err
+			}
+			for _, k := range chunked {
+				if err = p.dropParts(bucket, k); err != nil {
+					return err
+				}
+			}
+			if err = p.unlinkRefs(bucket, batch...); err != nil {
+				return err
+			}
+			keys = keys[n:]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.record(start, ra)
+	return nil
+}
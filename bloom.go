@@ -0,0 +1,186 @@
+package myplainkv
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// bloomMagic starts every exported filter, followed by the version.
+	// Version 1 filters hashed keys as stored, and read as malformed.
+	bloomMagic   string = `PKVB`
+	bloomVersion byte   = 2
+
+	// bloomHeader is the size of the magic, version, hash count and
+	// bit count preceding the bits of a filter
+	bloomHeader int = len(bloomMagic) + 1 + 1 + 8
+)
+
+var (
+	ErrInvalidFPRate error = errors.New(`false positive rate must be between 0 and 1`)
+)
+
+// bloom is a Bloom filter of m bits probed k times per key
+type bloom struct {
+	k    uint8
+	m    uint64
+	bits []byte
+}
+
+// newBloom sizes a filter for n keys at the false positive rate
+func newBloom(n int64, fpRate float64) *bloom {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 8 {
+		m = 8
+	}
+	k := math.Round(float64(m) / float64(n) * math.Ln2)
+	k = math.Max(1, math.Min(k, 32))
+	return &bloom{
+		k:    uint8(k),
+		m:    m,
+		bits: make([]byte, (m+7)/8),
+	}
+}
+
+// probes calls fn with each bit position of a key, derived from two
+// hashes as in Kirsch and Mitzenmacher
+func (b *bloom) probes(key string, fn func(bit uint64) bool) bool {
+	key = bloomKey(key)
+	h1, h2 := fnv.New64a(), fnv.New64()
+	h1.Write([]byte(key))
+	h2.Write([]byte(key))
+	a, d := h1.Sum64(), h2.Sum64()|1
+	for i := uint64(0); i < uint64(b.k); i++ {
+		if !fn((a + i*d) % b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomKey folds a key as the case-insensitive collation of the table
+// compares it, so keys Get finds under another case or with trailing
+// spaces test the same
+func bloomKey(key string) string {
+	return strings.TrimRight(strings.ToLower(key), ` `)
+}
+
+func (b *bloom) add(key string) {
+	b.probes(key, func(bit uint64) bool {
+		b.bits[bit/8] |= 1 << (bit % 8)
+		return true
+	})
+}
+
+func (b *bloom) has(key string) bool {
+	return b.probes(key, func(bit uint64) bool {
+		return b.bits[bit/8]&(1<<(bit%8)) != 0
+	})
+}
+
+func (b *bloom) bytes() []byte {
+	buf := make([]byte, bloomHeader, bloomHeader+len(b.bits))
+	copy(buf, bloomMagic)
+	buf[len(bloomMagic)] = bloomVersion
+	buf[len(bloomMagic)+1] = b.k
+	binary.BigEndian.PutUint64(buf[len(bloomMagic)+2:], b.m)
+	return append(buf, b.bits...)
+}
+
+// parseBloom reads an exported filter, reporting whether it is valid
+func parseBloom(filter []byte) (*bloom, bool) {
+	if len(filter) < bloomHeader || string(filter[:len(bloomMagic)]) != bloomMagic ||
+		filter[len(bloomMagic)] != bloomVersion {
+		return nil, false
+	}
+	b := &bloom{
+		k:    filter[len(bloomMagic)+1],
+		m:    binary.BigEndian.Uint64(filter[len(bloomMagic)+2:]),
+		bits: filter[bloomHeader:],
+	}
+	if b.k == 0 || b.m == 0 || uint64(len(b.bits)) != (b.m+7)/8 {
+		return nil, false
+	}
+	return b, true
+}
+
+// ExportBloom builds a Bloom filter of the live keys of a bucket at the
+// false positive rate, for MayContain to test keys against without a
+// query. The filter is a snapshot: keys set after it is built are not
+// in it, so export it again as often as the caller can afford. The
+// filter of a view holds the keys read through it.
+func (p *MyPlainKV) ExportBloom(bucket string, fpRate float64) (filter []byte, err error) {
+	var (
+		n int64
+		k string
+	)
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, ErrInvalidFPRate
+	}
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return nil, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if v := p.shared().views.get(bucket); v != nil {
+		var keys []string
+		if keys, err = p.listView(v, `%`); err != nil {
+			return nil, err
+		}
+		b := newBloom(int64(len(keys)), fpRate)
+		for _, k := range keys {
+			b.add(k)
+		}
+		p.record(start, int64(len(keys)))
+		return b.bytes(), nil
+	}
+	sqlstr := `SELECT COUNT(*) FROM ` + p.defTableName + ` WHERE Bucket = ? AND ` + notExpired + `;`
+	if err = p.queryRow(sqlstr, bucket).Scan(&n); err != nil {
+		return nil, err
+	}
+	b := newBloom(n, fpRate)
+	// Keys are streamed rather than listed, as the bucket may be huge
+	sqlstr = `SELECT KeyID FROM ` + p.defTableName + ` WHERE Bucket = ? AND ` + notExpired + `;`
+	sqr, err := p.query(sqlstr, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer sqr.Close()
+	for sqr.Next() {
+		if err = sqr.Scan(&k); err != nil {
+			return nil, err
+		}
+		b.add(k)
+	}
+	if err = sqr.Err(); err != nil {
+		return nil, err
+	}
+	p.record(start, n)
+	return b.bytes(), nil
+}
+
+// MayContain reports whether a key may be in the filter exported by
+// ExportBloom. A false result means the key was not in the bucket when
+// the filter was built. Keys are tested ignoring case and trailing
+// spaces, as the table compares them, but not accents: under an accent
+// insensitive collation, a key Get finds written with other accents may
+// test false. A malformed filter contains every key, so a bad download
+// never hides keys that exist.
+func MayContain(filter []byte, key string) bool {
+	b, ok := parseBloom(filter)
+	if !ok {
+		return true
+	}
+	return b.has(key)
+}
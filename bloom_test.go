@@ -0,0 +1,38 @@
+package myplainkv
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBloom(t *testing.T) {
+	const n = 10000
+	b := newBloom(n, 0.01)
+	for i := 0; i < n; i++ {
+		b.add(`key` + strconv.Itoa(i))
+	}
+	filter := b.bytes()
+	for i := 0; i < n; i++ {
+		if !MayContain(filter, `key`+strconv.Itoa(i)) {
+			t.Fatalf(`Expected key%d to be in the filter`, i)
+		}
+	}
+	fp := 0
+	for i := 0; i < n; i++ {
+		if MayContain(filter, `other`+strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	if fp > n/50 {
+		t.Logf(`Expected about 1%% false positives, got %d of %d`, fp, n)
+		t.Fail()
+	}
+	if !MayContain(filter, `KEY42`) || !MayContain(filter, `key42  `) {
+		t.Logf(`Expected keys to be tested as the collation compares them`)
+		t.Fail()
+	}
+	if !MayContain(filter[:5], `anything`) {
+		t.Logf(`Expected a malformed filter to contain every key`)
+		t.Fail()
+	}
+}
@@ -0,0 +1,148 @@
+package myplainkv
+
+import (
+	"io"
+)
+
+// Bucket is a handle of a MyPlainKV scoped to a single bucket.
+// Its methods never change the current bucket of the parent,
+// so several views of one store can be used side by side.
+type Bucket struct {
+	kv   *MyPlainKV
+	name string
+}
+
+// In returns a view of the store scoped to the bucket
+func (p *MyPlainKV) In(bucket string) *Bucket {
+	return &Bucket{
+		kv:   p,
+		name: p.bucket(bucket),
+	}
+}
+
+// Bucket returns a handle to the bucket with the full method set,
+// including its own tallies and MIME types. Independent parts of an
+// application can each hold their own handle on a shared store.
+func (p *MyPlainKV) Bucket(name string) *Bucket {
+	return p.In(name)
+}
+
+// Name returns the name of the bucket
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// Get retrieves a record using a key
+func (b *Bucket) Get(key string) ([]byte, error) {
+	return b.kv.getKey(b.name, key)
+}
+
+// GetInto retrieves a record using a key and appends its value to buf
+func (b *Bucket) GetInto(key string, buf []byte) ([]byte, error) {
+	return b.kv.getInto(b.name, key, buf)
+}
+
+// GetTo retrieves a record using a key and writes its value to w. As
+// with MyPlainKV.GetTo, w may have received part of a chunked value
+// failing verification.
+func (b *Bucket) GetTo(key string, w io.Writer) (int64, error) {
+	return b.kv.getTo(b.name, key, w)
+}
+
+// Set creates or updates the record by the value
+func (b *Bucket) Set(key string, value []byte) error {
+	return b.kv.set(b.name, key, value)
+}
+
+// Del deletes a record with the provided key
+func (b *Bucket) Del(key string) error {
+	return b.kv.del(b.name, key)
+}
+
+// PutReader stores everything read from r under the key in the bucket
+func (b *Bucket) PutReader(key string, r io.Reader) error {
+	return b.kv.putReader(b.name, key, r)
+}
+
+// GetReader returns a reader of the value of the key in the bucket
+func (b *Bucket) GetReader(key string) (io.ReadCloser, error) {
+	return b.kv.getReader(b.name, key)
+}
+
+// MSet creates or updates several records in the bucket
+func (b *Bucket) MSet(values map[string][]byte) error {
+	return b.kv.mset(b.name, values)
+}
+
+// MGet retrieves several records from the bucket
+func (b *Bucket) MGet(keys []string) (map[string][]byte, error) {
+	return b.kv.mget(b.name, keys)
+}
+
+// MDel deletes several records from the bucket
+func (b *Bucket) MDel(keys []string) error {
+	return b.kv.mdel(b.name, keys)
+}
+
+// ListKeys lists the keys of the bucket starting with the pattern
+func (b *Bucket) ListKeys(pattern string) ([]string, error) {
+	return b.kv.listKeys(b.name, pattern)
+}
+
+// Count returns the number of keys in the bucket
+func (b *Bucket) Count() (int64, error) {
+	n, _, err := b.kv.stats(b.name)
+	return n, err
+}
+
+// BucketSize returns the number of bytes stored in the bucket
+func (b *Bucket) BucketSize() (int64, error) {
+	_, n, err := b.kv.stats(b.name)
+	return n, err
+}
+
+// ListKeysBySuffix lists all keys ending with suffix in the bucket
+func (b *Bucket) ListKeysBySuffix(suffix string) ([]string, error) {
+	return b.kv.listKeysBySuffix(b.name, suffix)
+}
+
+// GetMime gets the mime of the value stored in the bucket
+func (b *Bucket) GetMime(key string) (string, error) {
+	return b.kv.getMime(b.name, key)
+}
+
+// SetMime sets the mime of the value stored in the bucket
+func (b *Bucket) SetMime(key string, mime string) error {
+	return b.kv.setMime(b.name, key, mime)
+}
+
+// Tally gets the current tally of a key in the bucket.
+// To start with a pre-defined number, set the offset variable
+func (b *Bucket) Tally(key string, offset int) (int, error) {
+	return b.kv.tally(b.name, key, offset)
+}
+
+// TallyIncr increments the tally
+func (b *Bucket) TallyIncr(key string) (int, error) {
+	return b.kv.tallyIncr(b.name, key)
+}
+
+// TallyDecr decrements the tally
+func (b *Bucket) TallyDecr(key string) (int, error) {
+	return b.kv.tallyDecr(b.name, key)
+}
+
+// TallyIncrBy adds delta to the tally
+func (b *Bucket) TallyIncrBy(key string, delta int64) (int64, error) {
+	return b.kv.tallyAdd(b.name, key, delta)
+}
+
+// TallyDecrBy subtracts delta from the tally
+func (b *Bucket) TallyDecrBy(key string, delta int64) (int64, error) {
+	return b.kv.tallyAdd(b.name, key, -delta)
+}
+
+// TallyReset resets tally to zero
+func (b *Bucket) TallyReset(key string) error {
+	return b.kv.tallyReset(b.name, key)
+}
@@ -0,0 +1,115 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrVersionConflict error = errors.New(`record was changed by another writer`)
+)
+
+// GetWithVersion retrieves a record and its version. Every write to the
+// record increments the version. A missing key has version 0. Aliases
+// are followed for the value, but the version is that of the key itself.
+func (p *MyPlainKV) GetWithVersion(key string) ([]byte, uint64, error) {
+	return p.getWithVersion(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) getWithVersion(bucket, key string) (val []byte, ver uint64, err error) {
+	defer func() { p.noteErr(err) }()
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		val, err = p.fetch(bucket, key)
+		return val, 0, err
+	}
+	// The transaction reads the version and value from one snapshot
+	err = p.atomic(func() error {
+		sqlstr := `SELECT Version FROM ` + p.defTableName + `
+		WHERE Bucket = ? AND KeyID = ? AND ` + notExpired + `;`
+		err := p.queryRow(sqlstr, bucket, key).Scan(&ver)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		val, err = p.fetch(bucket, key)
+		return err
+	})
+	if err != nil {
+		return []byte{}, 0, err
+	}
+	return val, ver, nil
+}
+
+// SetIfVersion updates the record only if its version is still
+// expected, as returned by GetWithVersion, and fails with
+// ErrVersionConflict otherwise. An expected version of 0 creates the
+// record only if it does not exist. Values too large for a single row
+// fail with ErrValueTooLong.
+func (p *MyPlainKV) SetIfVersion(key string, value []byte, expected uint64) error {
+	return p.setIfVersion(p.currBuckt, key, value, expected)
+}
+
+func (p *MyPlainKV) setIfVersion(bucket, key string, value []byte, expected uint64) error {
+	if expected == 0 {
+		ok, err := p.setNX(bucket, key, value)
+		if err == nil && !ok {
+			err = ErrVersionConflict
+		}
+		return err
+	}
+	return p.updateIfVersion(bucket, key, value, expected, false)
+}
+
+// updateIfVersion updates an existing record if its version is still
+// expected. Unless keepTTL is set, the record no longer expires.
+func (p *MyPlainKV) updateIfVersion(bucket, key string, value []byte, expected uint64, keepTTL bool) (err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return ErrReadOnlyView
+	}
+	if len(value) > maxValueLen {
+		return ErrValueTooLong
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return err
+	}
+	cols := `Value = ?, ExpiresAt = NULL`
+	if keepTTL {
+		cols = `Value = ?`
+	}
+	sqlstr := `UPDATE ` + p.defTableName + ` SET ` + cols + `, Version = Version + 1
+	WHERE Bucket = ? AND KeyID = ? AND Version = ? AND ` + notExpired + `;`
+	res, err := p.exec(sqlstr, value, bucket, key, expected)
+	if err != nil {
+		return err
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if ra == 0 {
+		return ErrVersionConflict
+	}
+	p.record(start, ra)
+	return nil
+}
+
+// GetWithVersion retrieves a record in the bucket and its version
+func (b *Bucket) GetWithVersion(key string) ([]byte, uint64, error) {
+	return b.kv.getWithVersion(b.name, key)
+}
+
+// SetIfVersion updates the record in the bucket only if its version is
+// still expected
+func (b *Bucket) SetIfVersion(key string, value []byte, expected uint64) error {
+	return b.kv.setIfVersion(b.name, key, value, expected)
+}
@@ -0,0 +1,234 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaintenanceConfig selects the chores StartMaintenance runs
+type MaintenanceConfig struct {
+	Interval       time.Duration // Time between rounds
+	Vacuum         bool          // Rebuild the table with OPTIMIZE TABLE to reclaim space
+	Analyze        bool          // Refresh index statistics, and the bucket stats if BucketStats is set
+	Orphans        bool          // Delete chunk manifests and parts left without their key
+	ChecksumSample int           // Number of chunked values to read back and verify per round
+}
+
+// MaintenanceReport is the outcome of the last maintenance round
+type MaintenanceReport struct {
+	Running   bool      `json:"running"`             // The maintenance worker is started
+	Leader    bool      `json:"leader"`              // This instance ran the last round
+	LastRun   time.Time `json:"lastRun"`             // Time the last round completed
+	LastError string    `json:"lastError,omitempty"` // Error that ended the last round, if any
+	Orphans   int64     `json:"orphans"`             // Orphaned rows deleted by the last round
+	Sampled   int       `json:"sampled"`             // Chunked values verified by the last round
+	Corrupt   []string  `json:"corrupt,omitempty"`   // Chunked values failing verification, as bucket/key
+}
+
+// choreState holds the report of the maintenance worker
+type choreState struct {
+	mu     sync.Mutex
+	report MaintenanceReport
+}
+
+// StartMaintenance starts running the selected chores every interval.
+// Of all the instances sharing the store, only the one holding an
+// advisory lock runs a round; the others skip it. The worker runs on a
+// connection pool of its own. Calling the returned function stops it.
+func (p *MyPlainKV) StartMaintenance(cfg MaintenanceConfig) (stop func()) {
+	w := p.detached()
+	p.shared().chores.mu.Lock()
+	p.shared().chores.report = MaintenanceReport{Running: true}
+	p.shared().chores.mu.Unlock()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(cfg.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				w.Close()
+				p.shared().chores.mu.Lock()
+				p.shared().chores.report.Running = false
+				p.shared().chores.mu.Unlock()
+				return
+			case <-t.C:
+				rep := w.chore(cfg)
+				rep.Running = true
+				p.shared().chores.mu.Lock()
+				p.shared().chores.report = rep
+				p.shared().chores.mu.Unlock()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// MaintenanceStatus returns the report of the last maintenance round
+func (p *MyPlainKV) MaintenanceStatus() MaintenanceReport {
+	p.shared().chores.mu.Lock()
+	defer p.shared().chores.mu.Unlock()
+	rep := p.shared().chores.report
+	rep.Corrupt = append([]string{}, rep.Corrupt...)
+	return rep
+}
+
+// chore runs one maintenance round if this instance wins the lock
+func (p *MyPlainKV) chore(cfg MaintenanceConfig) (rep MaintenanceReport) {
+	var (
+		err    error
+		leader bool
+	)
+	defer func() {
+		rep.LastRun = time.Now()
+		if err != nil {
+			rep.LastError = err.Error()
+			p.noteErr(err)
+		}
+	}()
+	if err = p.Open(); err != nil {
+		return rep
+	}
+	if on, _, _ := p.maintenance(); on {
+		return rep
+	}
+	// A zero timeout makes the instances that lose the lock skip the round
+	err = p.WithAdvisoryLock(`plainkv-chores:`+p.defTableName, 0, func() error {
+		leader = true
+		if cfg.Orphans {
+			n, err := p.dropOrphans()
+			rep.Orphans = n
+			if err != nil {
+				return err
+			}
+		}
+		if cfg.ChecksumSample > 0 {
+			if err := p.sampleChunks(cfg.ChecksumSample, &rep); err != nil {
+				return err
+			}
+		}
+		if cfg.Analyze {
+			if err := p.adminTable(`ANALYZE`); err != nil {
+				return err
+			}
+			if p.BucketStats {
+				if err := p.rebuildStats(); err != nil {
+					return err
+				}
+			}
+		}
+		if cfg.Vacuum {
+			return p.adminTable(`OPTIMIZE`)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrLockTimeout) {
+		err = nil
+	}
+	rep.Leader = leader
+	return rep
+}
+
+// adminTable runs a table maintenance statement, such as ANALYZE,
+// and discards the status rows it returns
+func (p *MyPlainKV) adminTable(stmt string) error {
+	sqr, err := p.db.Query(stmt + ` TABLE ` + p.defTableName + `;`)
+	if err != nil {
+		return err
+	}
+	defer sqr.Close()
+	for sqr.Next() {
+	}
+	return sqr.Err()
+}
+
+// dropOrphans deletes chunk manifests whose key no longer exists, then
+// the parts left without a manifest, and returns the number of rows
+// deleted
+func (p *MyPlainKV) dropOrphans() (int64, error) {
+	var total int64
+	t := p.defTableName
+	stmts := []struct {
+		sqlstr string
+		args   []any
+	}{
+		{
+			// A manifest no longer matching the value of its key is stale
+			`DELETE c FROM ` + t + ` c
+			LEFT JOIN ` + t + ` v ON v.KeyID = c.KeyID AND v.Bucket = SUBSTRING(c.Bucket, ?)
+			WHERE c.Bucket LIKE ? AND (v.Bucket IS NULL OR v.Value <> c.Value);`,
+			[]any{len(chunkBuckt) + 1, chunkBuckt + `%`},
+		},
+		{
+			`DELETE pt FROM ` + t + ` pt
+			LEFT JOIN ` + t + ` c ON c.Bucket = CONCAT(?, SUBSTRING(pt.Bucket, ?))
+				AND c.KeyID = LEFT(pt.KeyID, CHAR_LENGTH(pt.KeyID) - ?)
+			WHERE pt.Bucket LIKE ? AND c.Bucket IS NULL;`,
+			[]any{chunkBuckt, len(partBuckt) + 1, len(partSuffix), partBuckt + `%`},
+		},
+	}
+	for _, s := range stmts {
+		res, err := p.exec(s.sqlstr, s.args...)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+// sampleChunks reads back n chunked values picked at random and
+// verifies them against their manifests
+func (p *MyPlainKV) sampleChunks(n int, rep *MaintenanceReport) error {
+	type sample struct {
+		bucket, key string
+		manifest    []byte
+	}
+	// Stale manifests are left to the orphan cleanup
+	sqlstr := `SELECT c.Bucket, c.KeyID, c.Value FROM ` + p.defTableName + ` c
+	JOIN ` + p.defTableName + ` v ON v.KeyID = c.KeyID AND v.Bucket = SUBSTRING(c.Bucket, ?) AND v.Value = c.Value
+	WHERE c.Bucket LIKE ? ORDER BY RAND() LIMIT ?;`
+	sqr, err := p.query(sqlstr, len(chunkBuckt)+1, chunkBuckt+`%`, n)
+	if err != nil {
+		return err
+	}
+	samples := make([]sample, 0, n)
+	for sqr.Next() {
+		var s sample
+		if err = sqr.Scan(&s.bucket, &s.key, &s.manifest); err != nil {
+			sqr.Close()
+			return err
+		}
+		s.bucket = strings.TrimPrefix(s.bucket, chunkBuckt)
+		samples = append(samples, s)
+	}
+	sqr.Close()
+	if err = sqr.Err(); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		err = p.readChunks(s.bucket, s.key, s.manifest, func(val sql.RawBytes) error {
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrChunkCorrupt) {
+			return err
+		}
+		rep.Sampled++
+		if err != nil {
+			rep.Corrupt = append(rep.Corrupt, s.bucket+`/`+s.key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package myplainkv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	chunkBuckt string = `--chunk--`
+	partBuckt  string = `--part--`
+	partSuffix string = `#______`
+
+	// chunkSize is the size of each part of a chunked value. It is kept well
+	// below the default max_allowed_packet of MySQL and MariaDB.
+	chunkSize int = 1 << 20
+)
+
+var (
+	ErrChunkCorrupt error = errors.New(`chunked value is corrupt`)
+)
+
+// chunkManifest describes a value stored in parts. It is stored both as
+// the value of the key and in the chunk bucket. A later plain Set
+// replaces the value, so a manifest that no longer matches the value
+// of its key is stale and ignored.
+type chunkManifest struct {
+	Parts  int    `json:"parts"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// chunkBucket returns the bucket holding the manifests of chunked values
+func chunkBucket(bucket string) string {
+	return chunkBuckt + bucket
+}
+
+// partBucket returns the bucket holding the parts of chunked values
+func partBucket(bucket string) string {
+	return partBuckt + bucket
+}
+
+// partKey returns the key of a part of a chunked value
+func partKey(key string, i int) string {
+	return fmt.Sprintf(`%s#%06d`, key, i)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// setChunked stores a value too large for a single row in parts,
+// in one transaction
+func (p *MyPlainKV) setChunked(bucket, key string, value []byte) error {
+	if len(key)+len(partSuffix) > 300 {
+		return ErrKeyTooLong
+	}
+	if len(chunkBucket(bucket)) > 50 {
+		return ErrBucketIdTooLong
+	}
+	sum := sha256.Sum256(value)
+	man, err := json.Marshal(chunkManifest{
+		Parts:  (len(value) + chunkSize - 1) / chunkSize,
+		Size:   int64(len(value)),
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return err
+	}
+	return p.atomic(func() error {
+		if err := p.dropParts(bucket, key); err != nil {
+			return err
+		}
+		for i := 0; i*chunkSize < len(value); i++ {
+			end := (i + 1) * chunkSize
+			if end > len(value) {
+				end = len(value)
+			}
+			if _, err := p.upsert(partBucket(bucket), partKey(key, i), value[i*chunkSize:end]); err != nil {
+				return err
+			}
+		}
+		return p.writeManifest(bucket, key, man)
+	})
+}
+
+// writeManifest stores the manifest of a chunked value both in the chunk
+// bucket and as the value of its key
+func (p *MyPlainKV) writeManifest(bucket, key string, man []byte) error {
+	if _, err := p.upsert(chunkBucket(bucket), key, man); err != nil {
+		return err
+	}
+	_, err := p.upsert(bucket, key, man)
+	return err
+}
+
+// unchunk deletes the manifests and parts of the keys stored in chunks,
+// so that setting them to plain values leaves nothing behind. It is to
+// run in the transaction of the write.
+func (p *MyPlainKV) unchunk(bucket string, keys []string) error {
+	var k string
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > batchSize {
+			n = batchSize
+		}
+		args := []any{chunkBucket(bucket)}
+		for _, k := range keys[:n] {
+			args = append(args, k)
+		}
+		sqlstr := `SELECT KeyID FROM ` + p.defTableName + `
+		WHERE Bucket = ? AND KeyID IN (` + placeholders(n, `?`) + `);`
+		sqr, err := p.query(sqlstr, args...)
+		if err != nil {
+			return err
+		}
+		chunked := make([]string, 0)
+		for sqr.Next() {
+			if err = sqr.Scan(&k); err != nil {
+				sqr.Close()
+				return err
+			}
+			chunked = append(chunked, k)
+		}
+		sqr.Close()
+		if err = sqr.Err(); err != nil {
+			return err
+		}
+		for _, k := range chunked {
+			if err = p.dropParts(bucket, k); err != nil {
+				return err
+			}
+			sqlstr = `DELETE FROM ` + p.defTableName + ` WHERE Bucket = ? AND KeyID = ?;`
+			if _, err = p.exec(sqlstr, chunkBucket(bucket), k); err != nil {
+				return err
+			}
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// dropParts deletes the parts of a chunked value
+func (p *MyPlainKV) dropParts(bucket, key string) error {
+	sqlstr := `DELETE FROM ` + p.defTableName + ` WHERE Bucket = ? AND KeyID LIKE ?;`
+	_, err := p.exec(sqlstr, partBucket(bucket), escapeLike(key)+partSuffix)
+	return err
+}
+
+// isManifest reports whether the value of a key is the manifest
+// stored for it in the chunk bucket
+func isManifest(val, manifest []byte) bool {
+	return manifest != nil && bytes.Equal(val, manifest)
+}
+
+// readChunks passes the parts of a chunked value to fn in order,
+// verifying them against the manifest. The parts are not held in
+// memory, so fn has seen them all by the time ErrChunkCorrupt is
+// returned; callers buffering the value discard it then.
+func (p *MyPlainKV) readChunks(bucket, key string, manifest []byte, fn func(val sql.RawBytes) error) error {
+	var (
+		err  error
+		man  chunkManifest
+		sqr  *sql.Rows
+		raw  sql.RawBytes
+		n    int
+		size int64
+	)
+	if err = json.Unmarshal(manifest, &man); err != nil {
+		return fmt.Errorf(`%w: %s`, ErrChunkCorrupt, err)
+	}
+	sqlstr := `
+	SELECT Value FROM ` + p.defTableName + `
+	WHERE Bucket = ? AND KeyID LIKE ?
+	ORDER BY KeyID;`
+	if sqr, err = p.query(sqlstr, partBucket(bucket), escapeLike(key)+partSuffix); err != nil {
+		return err
+	}
+	defer sqr.Close()
+	h := sha256.New()
+	for sqr.Next() {
+		if err = sqr.Scan(&raw); err != nil {
+			return err
+		}
+		h.Write(raw)
+		size += int64(len(raw))
+		n++
+		if err = fn(raw); err != nil {
+			return err
+		}
+	}
+	if err = sqr.Err(); err != nil {
+		return err
+	}
+	if n != man.Parts || size != man.Size || hex.EncodeToString(h.Sum(nil)) != man.SHA256 {
+		return fmt.Errorf(`%w: %s`, ErrChunkCorrupt, key)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	myplainkv "github.com/narsilworks/plainkv"
+)
+
+const (
+	// benchPrefix starts the keys bench writes, so they can be told from
+	// the keys of the bucket and deleted afterwards
+	benchPrefix string = `plainkv-bench-`
+)
+
+// benchStats holds what the workers of a bench run measured
+type benchStats struct {
+	reads, writes []time.Duration
+	errs          int
+}
+
+// bench runs a workload of reads and writes against the current bucket
+// and prints latency percentiles and throughput. The keys it writes are
+// deleted afterwards.
+func bench(kv *myplainkv.MyPlainKV, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet(`bench`, flag.ContinueOnError)
+	reads := fs.Int(`reads`, 80, `percentage of operations that read; the rest write`)
+	size := fs.Int(`size`, 256, `size of the values written, in bytes`)
+	conc := fs.Int(`concurrency`, 8, `number of concurrent workers`)
+	dur := fs.Duration(`duration`, 10*time.Second, `how long to run`)
+	keys := fs.Int(`keys`, 1000, `number of distinct keys`)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	if *reads < 0 || *reads > 100 || *size < 0 || *conc < 1 || *dur <= 0 || *keys < 1 {
+		return errUsage
+	}
+	// Every worker holds a connection at a time
+	kv.MaxOpenConns, kv.MaxIdleConns = *conc, *conc
+
+	names := make([]string, *keys)
+	vals := make(map[string][]byte, *keys)
+	for i := range names {
+		names[i] = benchPrefix + strconv.Itoa(i)
+		vals[names[i]] = make([]byte, *size)
+	}
+	if err := kv.MSet(vals); err != nil {
+		return err
+	}
+	defer kv.MDel(names)
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		all benchStats
+	)
+	start := time.Now()
+	deadline := start.Add(*dur)
+	for w := 0; w < *conc; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			var st benchStats
+			s := kv.Session()
+			defer s.Close()
+			rnd := rand.New(rand.NewSource(seed))
+			val := make([]byte, *size)
+			for time.Now().Before(deadline) {
+				key := names[rnd.Intn(len(names))]
+				t := time.Now()
+				if rnd.Intn(100) < *reads {
+					_, err := s.Get(key)
+					st.reads = append(st.reads, time.Since(t))
+					if err != nil {
+						st.errs++
+					}
+					continue
+				}
+				rnd.Read(val)
+				err := s.Set(key, val)
+				st.writes = append(st.writes, time.Since(t))
+				if err != nil {
+					st.errs++
+				}
+			}
+			mu.Lock()
+			all.reads = append(all.reads, st.reads...)
+			all.writes = append(all.writes, st.writes...)
+			all.errs += st.errs
+			mu.Unlock()
+		}(start.UnixNano() + int64(w))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	fmt.Fprintf(out, "%-6s %10s %10s %10s %10s %10s\n", `op`, `count`, `p50`, `p90`, `p99`, `max`)
+	for _, r := range []struct {
+		op string
+		d  []time.Duration
+	}{{`read`, all.reads}, {`write`, all.writes}} {
+		if len(r.d) == 0 {
+			continue
+		}
+		sort.Slice(r.d, func(i, j int) bool { return r.d[i] < r.d[j] })
+		fmt.Fprintf(out, "%-6s %10d %10s %10s %10s %10s\n", r.op, len(r.d),
+			percentile(r.d, 0.50), percentile(r.d, 0.90), percentile(r.d, 0.99), r.d[len(r.d)-1])
+	}
+	n := len(all.reads) + len(all.writes)
+	_, err := fmt.Fprintf(out, "%d operations in %s, %.0f ops/s, %d errors\n",
+		n, elapsed.Round(time.Millisecond), float64(n)/elapsed.Seconds(), all.errs)
+	return err
+}
+
+// percentile returns the q-th quantile of sorted durations, rounded for
+// printing
+func percentile(d []time.Duration, q float64) time.Duration {
+	return d[int(q*float64(len(d)-1))].Round(time.Microsecond)
+}
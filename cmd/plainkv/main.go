@@ -0,0 +1,176 @@
+// Command plainkv inspects and edits a MyPlainKV table from the shell.
+//
+//	plainkv [-dsn DSN] [-table TABLE] [-bucket BUCKET] COMMAND [ARGS]
+//
+// The DSN defaults to the PLAINKV_DSN environment variable, and the table
+// to KeyValueTBL. Commands:
+//
+//	get KEY              print the value of a key
+//	set KEY [VALUE]      set a key, reading the value from stdin if omitted
+//	del KEY...           delete keys
+//	list [PATTERN]       list the keys starting with the pattern
+//	buckets              list the buckets
+//	export [BUCKET...]   write the keys of the buckets as JSON Lines
+//	import               read keys written by export from stdin
+//	tally KEY [DELTA]    print a tally, adding delta to it first if given
+//	bench [FLAGS]        run a read and write workload and print latencies
+//
+// The bench flags are -reads (percentage of reads, 80), -size (value
+// size, 256), -concurrency (8), -duration (10s) and -keys (1000). Its
+// keys are written to the bucket and deleted afterwards.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	myplainkv "github.com/narsilworks/plainkv"
+)
+
+var (
+	errUsage    error = errors.New(`usage`)
+	errNotFound error = errors.New(`key not found`)
+)
+
+func main() {
+	fs := flag.NewFlagSet(`plainkv`, flag.ExitOnError)
+	dsn := fs.String(`dsn`, os.Getenv(`PLAINKV_DSN`), `Data Source Name of the database`)
+	table := fs.String(`table`, `KeyValueTBL`, `table holding the keys, optionally qualified by a schema`)
+	bucket := fs.String(`bucket`, ``, `bucket to use, the default bucket if empty`)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `usage: plainkv [-dsn DSN] [-table TABLE] [-bucket BUCKET] get|set|del|list|buckets|export|import|tally|bench [ARGS]`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+	if fs.NArg() == 0 || *dsn == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	kv, err := myplainkv.NewMyPlainKVTable(*dsn, *table, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "plainkv: %s\n", err)
+		os.Exit(2)
+	}
+	kv.SetBucket(*bucket)
+	err = run(kv, fs.Arg(0), fs.Args()[1:], os.Stdin, os.Stdout)
+	kv.Close()
+	switch {
+	case errors.Is(err, errUsage):
+		fs.Usage()
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "plainkv: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// run executes a command
+func run(kv *myplainkv.MyPlainKV, cmd string, args []string, in io.Reader, out io.Writer) error {
+	switch cmd {
+	case `get`:
+		if len(args) != 1 {
+			return errUsage
+		}
+		ok, err := kv.Exists(args[0])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf(`%w: %s`, errNotFound, args[0])
+		}
+		_, err = kv.GetTo(args[0], out)
+		return err
+	case `set`:
+		var (
+			val []byte
+			err error
+		)
+		switch len(args) {
+		case 1:
+			if val, err = io.ReadAll(in); err != nil {
+				return err
+			}
+		case 2:
+			val = []byte(args[1])
+		default:
+			return errUsage
+		}
+		return kv.Set(args[0], val)
+	case `del`:
+		if len(args) == 0 {
+			return errUsage
+		}
+		return kv.MDel(args)
+	case `list`:
+		if len(args) > 1 {
+			return errUsage
+		}
+		pattern := ""
+		if len(args) == 1 {
+			pattern = args[0]
+		}
+		keys, err := kv.ListKeys(pattern)
+		if err != nil {
+			return err
+		}
+		return lines(out, keys)
+	case `buckets`:
+		if len(args) != 0 {
+			return errUsage
+		}
+		buckets, err := kv.ListBuckets()
+		if err != nil {
+			return err
+		}
+		return lines(out, buckets)
+	case `export`:
+		return kv.Export(out, args...)
+	case `import`:
+		if len(args) != 0 {
+			return errUsage
+		}
+		return kv.Import(in)
+	case `tally`:
+		var (
+			n   int64
+			err error
+		)
+		switch len(args) {
+		case 1:
+			var t int
+			t, err = kv.Tally(args[0], 0)
+			n = int64(t)
+		case 2:
+			var delta int64
+			if delta, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return err
+			}
+			n, err = kv.TallyIncrBy(args[0], delta)
+		default:
+			return errUsage
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, n)
+		return err
+	case `bench`:
+		return bench(kv, args, out)
+	}
+	return errUsage
+}
+
+// lines writes each string on its own line
+func lines(out io.Writer, ss []string) error {
+	w := bufio.NewWriter(out)
+	for _, s := range ss {
+		fmt.Fprintln(w, s)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,96 @@
+package myplainkv
+
+import (
+	"context"
+)
+
+// Conn is a MyPlainKV pinned to a single database session. Everything
+// done through it, including GET_LOCK, temporary tables and session
+// variables, happens on the same connection until Close releases it.
+// As with a Session, everything registered on the store is shared:
+// views, upgraders, key orders, erasure subjects, the miss cache, the
+// access log and maintenance.
+type Conn struct {
+	*MyPlainKV
+	ownDB bool
+}
+
+// AcquireConn takes a connection from the pool and returns a handle with
+// the full API bound to it. The handle starts in the current bucket of
+// the store. If the store closes automatically, the handle gets a pool
+// of its own, so it outlives the store's connection.
+func (p *MyPlainKV) AcquireConn(ctx context.Context) (*Conn, error) {
+	var err error
+	c := &Conn{
+		MyPlainKV: p.detached(),
+	}
+	c.root = p.shared()
+	c.currBuckt = p.currBuckt
+	if p.autoClose {
+		if err = c.MyPlainKV.Open(); err != nil {
+			return nil, err
+		}
+		c.ownDB = true
+	} else {
+		if err = p.Open(); err != nil {
+			return nil, err
+		}
+		c.db = p.db
+	}
+	if c.conn, err = c.db.Conn(ctx); err != nil {
+		if c.ownDB {
+			c.db.Close()
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// detached returns a store with the same settings that does not share
+// the connection pool, transaction or in-memory state of p
+func (p *MyPlainKV) detached() *MyPlainKV {
+	return &MyPlainKV{
+		DSN:              p.DSN,
+		SurrogateKey:     p.SurrogateKey,
+		ChunkOversized:   p.ChunkOversized,
+		MissTTL:          p.MissTTL,
+		TTLJitter:        p.TTLJitter,
+		RefDelete:        p.RefDelete,
+		ReverseKeys:      p.ReverseKeys,
+		RecencyIndex:     p.RecencyIndex,
+		BucketStats:      p.BucketStats,
+		AccessResolution: p.AccessResolution,
+		StrictNotFound:   p.StrictNotFound,
+		KeyStatsSample:   p.KeyStatsSample,
+		MaxOpenConns:     p.MaxOpenConns,
+		MaxIdleConns:     p.MaxIdleConns,
+		ConnMaxLifetime:  p.ConnMaxLifetime,
+		DebugLogSize:     p.DebugLogSize,
+		ErasureSecret:    p.ErasureSecret,
+		defBuckt:         p.defBuckt,
+		defTableName:     p.defTableName,
+		extDB:            p.extDB,
+	}
+}
+
+// Close rolls back any transaction left open and returns the connection
+// to the pool. The handle must not be used afterwards.
+func (c *Conn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	if c.inTransaction {
+		c.Rollback()
+	}
+	err := c.conn.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn = nil
+	if c.ownDB {
+		if cerr := c.db.Close(); err == nil {
+			err = cerr
+		}
+	}
+	c.db = nil
+	return err
+}
@@ -0,0 +1,106 @@
+package myplainkv
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	tokenMySQL   string = `mysql`
+	tokenMariaDB string = `mariadb`
+
+	// readWait is how long WithReadConsistency waits for the server to
+	// apply the writes of a session token
+	readWait time.Duration = 10 * time.Second
+)
+
+var (
+	ErrGTIDDisabled    error = errors.New(`server does not record GTIDs`)
+	ErrInvalidToken    error = errors.New(`invalid session token`)
+	ErrTokenNotApplied error = errors.New(`server has not applied the session token`)
+)
+
+// SessionToken returns a token covering every write committed on the
+// server so far, encoding its GTID set. Take it after writing, pass it
+// along with the request, and read through WithReadConsistency on
+// another process, possibly on a replica, to see those writes. The
+// server must have GTIDs enabled.
+func (p *MyPlainKV) SessionToken() (tok string, err error) {
+	var (
+		set string
+		me  *mysql.MySQLError
+	)
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return "", err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	flavor := tokenMySQL
+	err = p.queryRow(`SELECT @@GLOBAL.gtid_executed;`).Scan(&set)
+	if errors.As(err, &me) && me.Number == 1193 {
+		// MariaDB names its GTID position differently
+		flavor = tokenMariaDB
+		err = p.queryRow(`SELECT @@GLOBAL.gtid_current_pos;`).Scan(&set)
+	}
+	if err != nil {
+		return "", err
+	}
+	// Whitespace is dropped, as MySQL breaks long GTID sets into lines
+	set = strings.Join(strings.Fields(set), ``)
+	if set == "" {
+		return "", ErrGTIDDisabled
+	}
+	return flavor + `:` + set, nil
+}
+
+// WithReadConsistency waits until the server has applied the writes
+// covered by a token from SessionToken, then runs fn. Reads in fn see
+// those writes. An empty token runs fn at once. If the server does not
+// catch up within ten seconds, fn is not run and ErrTokenNotApplied is
+// returned.
+func (p *MyPlainKV) WithReadConsistency(token string, fn func() error) error {
+	if token == "" {
+		return fn()
+	}
+	flavor, set, ok := strings.Cut(token, `:`)
+	if !ok || set == "" {
+		return ErrInvalidToken
+	}
+	var sqlstr string
+	switch flavor {
+	case tokenMySQL:
+		sqlstr = `SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?) = 0;`
+	case tokenMariaDB:
+		sqlstr = `SELECT MASTER_GTID_WAIT(?, ?) = 0;`
+	default:
+		return ErrInvalidToken
+	}
+	if err := p.waitGTID(sqlstr, set); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// waitGTID runs a GTID wait function for the set
+func (p *MyPlainKV) waitGTID(sqlstr, set string) (err error) {
+	var done bool
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	if err = p.queryRow(sqlstr, set, readWait.Seconds()).Scan(&done); err != nil {
+		return err
+	}
+	if !done {
+		return ErrTokenNotApplied
+	}
+	return nil
+}
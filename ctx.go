@@ -0,0 +1,92 @@
+package myplainkv
+
+import (
+	"context"
+)
+
+// callCtx returns the context of the current call, if any
+func (p *MyPlainKV) callCtx() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// withCtx runs fn with every statement it issues bound to ctx. Outside a
+// transaction or pinned connection, fn runs on a session of its own, so
+// concurrent calls do not bind each other's statements to their
+// contexts. Inside one, fn runs on a handle sharing the transaction or
+// connection, so p itself is never changed. The result and error of the
+// handle are kept on p.
+func (p *MyPlainKV) withCtx(ctx context.Context, fn func(q *MyPlainKV) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var q *MyPlainKV
+	// Open, Close and the transaction methods set the state under mu
+	p.mu.Lock()
+	if p.inTransaction || p.conn != nil {
+		q = p.detached()
+		q.root = p.shared()
+		q.currBuckt = p.currBuckt
+		q.sharedPool = true
+		q.db, q.conn, q.tx, q.inTransaction = p.db, p.conn, p.tx, p.inTransaction
+	}
+	p.mu.Unlock()
+	if q == nil {
+		q = p.Session()
+		defer q.Close()
+	}
+	q.ctx = ctx
+	err := fn(q)
+	q.resMu.Lock()
+	res, lastErr, at := q.lastRes, q.lastErr, q.lastErrAt
+	q.resMu.Unlock()
+	p.resMu.Lock()
+	p.lastRes = res
+	if lastErr != nil {
+		p.lastErr, p.lastErrAt = lastErr, at
+	}
+	p.resMu.Unlock()
+	return err
+}
+
+// GetCtx retrieves a record using a key, cancelling the query when
+// ctx is done
+func (p *MyPlainKV) GetCtx(ctx context.Context, key string) ([]byte, error) {
+	var val []byte
+	err := p.withCtx(ctx, func(q *MyPlainKV) error {
+		var err error
+		val, err = q.getKey(q.currBuckt, key)
+		return err
+	})
+	return val, err
+}
+
+// SetCtx creates or updates the record by the value, cancelling the
+// statement when ctx is done
+func (p *MyPlainKV) SetCtx(ctx context.Context, key string, value []byte) error {
+	return p.withCtx(ctx, func(q *MyPlainKV) error {
+		return q.set(q.currBuckt, key, value)
+	})
+}
+
+// DelCtx deletes a record with the provided key, cancelling the
+// statement when ctx is done
+func (p *MyPlainKV) DelCtx(ctx context.Context, key string) error {
+	return p.withCtx(ctx, func(q *MyPlainKV) error {
+		return q.del(q.currBuckt, key)
+	})
+}
+
+// ListKeysCtx lists all keys containing the current pattern, cancelling
+// the query when ctx is done
+func (p *MyPlainKV) ListKeysCtx(ctx context.Context, pattern string) ([]string, error) {
+	var val []string
+	err := p.withCtx(ctx, func(q *MyPlainKV) error {
+		var err error
+		val, err = q.listKeys(q.currBuckt, pattern)
+		return err
+	})
+	return val, err
+}
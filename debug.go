@@ -0,0 +1,172 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxTracedArg is the most bytes of a string or []byte argument kept
+	// in the debug log
+	maxTracedArg int = 64
+)
+
+// DebugState is a snapshot of the internal state of a MyPlainKV
+type DebugState struct {
+	Open          bool              `json:"open"`
+	InTransaction bool              `json:"inTransaction"`
+	Table         string            `json:"table"`
+	DefaultBucket string            `json:"defaultBucket"`
+	Pool          sql.DBStats       `json:"pool"`
+	MissCache     CacheStats        `json:"missCache"`
+	Maintenance   MaintenanceReport `json:"maintenance"`
+	LastResult    Result            `json:"lastResult"`
+	LastError     string            `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time        `json:"lastErrorAt,omitempty"`
+}
+
+// CacheStats counts the use of an in-memory cache
+type CacheStats struct {
+	Entries int     `json:"entries"`
+	Lookups int64   `json:"lookups"`
+	Hits    int64   `json:"hits"`
+	HitRate float64 `json:"hitRate"`
+}
+
+// DebugState returns a snapshot of the connection pool, transaction
+// state, miss cache, maintenance worker, last operation and last error.
+// It can be published with expvar.Func for /debug/vars.
+func (p *MyPlainKV) DebugState() DebugState {
+	ds := DebugState{
+		MissCache:   p.shared().misses.stats(),
+		Maintenance: p.MaintenanceStatus(),
+	}
+	// Open, Close and the transaction methods set these under mu. The
+	// current bucket is left out, as the goroutine using the store sets
+	// it without a lock.
+	p.mu.Lock()
+	ds.Open = p.db != nil
+	ds.InTransaction = p.inTransaction
+	if p.db != nil {
+		ds.Pool = p.db.Stats()
+	}
+	p.mu.Unlock()
+
+	p.resMu.Lock()
+	defer p.resMu.Unlock()
+	ds.Table = p.defTableName
+	ds.DefaultBucket = p.bucket("")
+	ds.LastResult = p.lastRes
+	if p.lastErr != nil {
+		at := p.lastErrAt
+		ds.LastError = p.lastErr.Error()
+		ds.LastErrorAt = &at
+	}
+	return ds
+}
+
+// DebugHandler returns an http.Handler serving DebugState as JSON.
+// Mount it on an existing mux, for example at /debug/plainkv.
+func (p *MyPlainKV) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Content-Type`, `application/json`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent(``, `  `)
+		if err := enc.Encode(p.DebugState()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// DebugEntry is a statement recorded in the debug log
+type DebugEntry struct {
+	At            time.Time     `json:"at"`
+	SQL           string        `json:"sql"`
+	Args          []string      `json:"args,omitempty"`
+	Duration      time.Duration `json:"duration"`
+	InTransaction bool          `json:"inTransaction"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// debugRing holds the most recent statements run
+type debugRing struct {
+	mu      sync.Mutex
+	entries []DebugEntry
+	next    int
+}
+
+// add records a statement, replacing the oldest once size are held
+func (r *debugRing) add(e DebugEntry, size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next == 0 && len(r.entries) < size {
+		r.entries = append(r.entries, e)
+		return
+	}
+	// Once the ring has wrapped, it keeps its length
+	if r.next >= len(r.entries) {
+		r.next = 0
+	}
+	r.entries[r.next] = e
+	r.next++
+}
+
+// list returns the statements held, oldest first
+func (r *debugRing) list() []DebugEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	val := make([]DebugEntry, 0, len(r.entries))
+	val = append(val, r.entries[r.next:]...)
+	return append(val, r.entries[:r.next]...)
+}
+
+// trace records a statement in the debug log
+func (p *MyPlainKV) trace(start time.Time, sqlstr string, args []any, err *error) {
+	e := DebugEntry{
+		At:            start,
+		SQL:           strings.Join(strings.Fields(sqlstr), ` `),
+		Args:          make([]string, len(args)),
+		Duration:      time.Since(start),
+		InTransaction: p.inTransaction,
+	}
+	for i, a := range args {
+		e.Args[i] = traceArg(a)
+	}
+	if *err != nil {
+		e.Error = (*err).Error()
+	}
+	p.shared().trail.add(e, p.DebugLogSize)
+}
+
+// traceArg formats an argument for the debug log. Strings and byte
+// slices are quoted, and cut short with their length if long.
+func traceArg(a any) string {
+	var s string
+	switch v := a.(type) {
+	case nil:
+		return `NULL`
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Sprint(v)
+	}
+	if len(s) > maxTracedArg {
+		return fmt.Sprintf(`%q... (%d bytes)`, s[:maxTracedArg], len(s))
+	}
+	return fmt.Sprintf(`%q`, s)
+}
+
+// DebugLog returns the statements most recently run, oldest first, with
+// their arguments, duration and error. Statements are recorded when
+// DebugLogSize is set, which keeps that many. Arguments are recorded
+// too, so values stored are visible in the log, cut short if long.
+func (p *MyPlainKV) DebugLog() []DebugEntry {
+	return p.shared().trail.list()
+}
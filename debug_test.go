@@ -0,0 +1,55 @@
+package myplainkv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebugRing(t *testing.T) {
+	var r debugRing
+	for _, s := range []string{`a`, `b`, `c`, `d`, `e`} {
+		r.add(DebugEntry{SQL: s}, 3)
+	}
+	got := ``
+	for _, e := range r.list() {
+		got += e.SQL
+	}
+	if got != `cde` {
+		t.Logf(`Expected the last three statements oldest first, got %q`, got)
+		t.Fail()
+	}
+}
+
+func TestTraceArg(t *testing.T) {
+	long := make([]byte, 100)
+	for i := range long {
+		long[i] = 'x'
+	}
+	for _, c := range []struct {
+		arg  any
+		want string
+	}{
+		{nil, `NULL`},
+		{42, `42`},
+		{`key`, `"key"`},
+		{[]byte(`val`), `"val"`},
+		{long, `"` + string(long[:maxTracedArg]) + `"... (100 bytes)`},
+	} {
+		if got := traceArg(c.arg); got != c.want {
+			t.Logf(`Expected %s, got %s`, c.want, got)
+			t.Fail()
+		}
+	}
+}
+
+func TestDebugStateMissCache(t *testing.T) {
+	pkv := NewMyPlainKV("", false)
+	pkv.shared().misses.add(`default`, `gone`, time.Minute)
+	pkv.shared().misses.has(`default`, `gone`)
+	pkv.shared().misses.has(`default`, `other`)
+	ds := pkv.DebugState()
+	if ds.Open || ds.MissCache.Entries != 1 || ds.MissCache.Hits != 1 || ds.MissCache.HitRate != 0.5 {
+		t.Logf(`Expected a closed store with one hit in two lookups, got %+v`, ds)
+		t.Fail()
+	}
+}
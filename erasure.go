@@ -0,0 +1,175 @@
+package myplainkv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	erasureBuckt       string = `--erasure--`
+	subjectPlaceholder string = `{subject}`
+)
+
+var (
+	ErrNoSubjectKeys error = errors.New(`no key patterns registered for subjects`)
+	ErrNoPlaceholder error = errors.New(`key pattern has no {subject} placeholder`)
+	ErrNoErasureKey  error = errors.New(`ErasureSecret is not set`)
+)
+
+// subjectRule is a pattern of the keys holding the data of a subject
+type subjectRule struct {
+	bucket  string
+	pattern string
+}
+
+// subjectRules holds the subject key patterns registered on a store
+type subjectRules struct {
+	mu    sync.RWMutex
+	rules []subjectRule
+}
+
+// ErasureReport lists what EraseSubject deleted
+type ErasureReport struct {
+	SubjectHash string              `json:"subjectHash"` // HMAC-SHA-256 of the subject ID keyed by ErasureSecret
+	ErasedAt    time.Time           `json:"erasedAt"`
+	Keys        map[string][]string `json:"keys,omitempty"` // Keys deleted, by bucket
+	Count       int                 `json:"count"`
+}
+
+// RegisterSubjectKeys registers a LIKE pattern of the keys in the bucket
+// holding the data of a subject. The pattern must contain {subject},
+// which is replaced by the subject ID, as in users/{subject}/%.
+// Patterns are kept in memory on the store and shared by its sessions
+// and connections, but not by other instances.
+func (p *MyPlainKV) RegisterSubjectKeys(bucket, pattern string) error {
+	if !strings.Contains(pattern, subjectPlaceholder) {
+		return ErrNoPlaceholder
+	}
+	p.shared().subjects.mu.Lock()
+	defer p.shared().subjects.mu.Unlock()
+	p.shared().subjects.rules = append(p.shared().subjects.rules, subjectRule{
+		bucket:  p.bucket(bucket),
+		pattern: pattern,
+	})
+	return nil
+}
+
+// EraseSubject deletes every key matching the registered patterns for
+// the subject, with their aliases, chunks and references, in one
+// transaction. It stores a proof of erasure holding the HMAC of the
+// subject ID, the time and the number of keys deleted, but not the keys
+// themselves, and returns the full report. The HMAC is keyed by
+// ErasureSecret, so subject IDs cannot be recovered from proofs by
+// hashing guesses; without it, EraseSubject fails with ErrNoErasureKey.
+// The secret must stay the same for ErasureProof to find the proofs.
+func (p *MyPlainKV) EraseSubject(subjectID string) (rep ErasureReport, err error) {
+	defer func() { p.noteErr(err) }()
+	hash, err := p.subjectHash(subjectID)
+	if err != nil {
+		return rep, err
+	}
+	p.shared().subjects.mu.RLock()
+	rules := append([]subjectRule{}, p.shared().subjects.rules...)
+	p.shared().subjects.mu.RUnlock()
+	if len(rules) == 0 {
+		return rep, ErrNoSubjectKeys
+	}
+
+	rep = ErasureReport{
+		SubjectHash: hash,
+		Keys:        make(map[string][]string),
+	}
+	err = p.atomic(func() error {
+		if err := p.checkMaintenance(); err != nil {
+			return err
+		}
+		for _, r := range rules {
+			like := strings.ReplaceAll(r.pattern, subjectPlaceholder, escapeLike(subjectID))
+			keys, err := p.matchKeys(r.bucket, like)
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				n, err := p.remove(r.bucket, k)
+				if err != nil {
+					return err
+				}
+				if n > 0 {
+					rep.Keys[r.bucket] = append(rep.Keys[r.bucket], k)
+					rep.Count++
+				}
+			}
+		}
+		rep.ErasedAt = time.Now().UTC()
+		proof, err := json.Marshal(ErasureReport{
+			SubjectHash: rep.SubjectHash,
+			ErasedAt:    rep.ErasedAt,
+			Count:       rep.Count,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = p.upsert(erasureBuckt, rep.SubjectHash, proof)
+		return err
+	})
+	return rep, err
+}
+
+// ErasureProof returns the proof of erasure stored for the subject,
+// and whether there is one
+func (p *MyPlainKV) ErasureProof(subjectID string) (ErasureReport, bool, error) {
+	var rep ErasureReport
+	hash, err := p.subjectHash(subjectID)
+	if err != nil {
+		return rep, false, err
+	}
+	val, err := p.get(erasureBuckt, hash)
+	if err != nil || len(val) == 0 {
+		return rep, false, err
+	}
+	if err = json.Unmarshal(val, &rep); err != nil {
+		return rep, false, err
+	}
+	return rep, true, nil
+}
+
+// subjectHash returns the HMAC of the subject ID proofs of erasure are
+// stored under
+func (p *MyPlainKV) subjectHash(subjectID string) (string, error) {
+	if len(p.ErasureSecret) == 0 {
+		return "", ErrNoErasureKey
+	}
+	m := hmac.New(sha256.New, p.ErasureSecret)
+	m.Write([]byte(subjectID))
+	return hex.EncodeToString(m.Sum(nil)), nil
+}
+
+// matchKeys lists the keys of a bucket matching a full LIKE pattern,
+// including expired keys. The connection must be open.
+func (p *MyPlainKV) matchKeys(bucket, like string) ([]string, error) {
+	var (
+		k   string
+		sqr *sql.Rows
+		err error
+	)
+	sqlstr := `SELECT KeyID FROM ` + p.defTableName + ` WHERE Bucket=? AND KeyID LIKE ?;`
+	if sqr, err = p.query(sqlstr, bucket, like); err != nil {
+		return nil, err
+	}
+	defer sqr.Close()
+	keys := make([]string, 0)
+	for sqr.Next() {
+		if err = sqr.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, sqr.Err()
+}
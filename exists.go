@@ -0,0 +1,71 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Exists reports whether the key holds a value, without reading it.
+// Aliases are followed to their target.
+func (p *MyPlainKV) Exists(key string) (bool, error) {
+	return p.exists(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) exists(bucket, key string) (ok bool, err error) {
+	var (
+		alias  bool
+		target sql.NullString
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return false, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if src, pats := p.shared().views.chain(bucket); pats != nil {
+		if !inView(key, pats) {
+			return false, nil
+		}
+		bucket = src
+	}
+	if p.MissTTL > 0 && p.shared().misses.has(bucket, key) {
+		p.record(start, 0)
+		return false, nil
+	}
+
+	// Only the target of an alias is transferred, never a value
+	sqlstr := `
+	SELECT Bucket = ?, IF(Bucket = ?, Value, NULL) FROM ` + p.defTableName + `
+	WHERE Bucket IN (?, ?) AND KeyID = ? AND ` + notExpired + `
+	ORDER BY Bucket = ? LIMIT 1;`
+	ab := aliasBucket(bucket)
+	seen := make(map[string]bool)
+	for {
+		err = p.queryRow(sqlstr, ab, ab, bucket, ab, key, ab).Scan(&alias, &target)
+		if errors.Is(err, sql.ErrNoRows) {
+			p.record(start, 0)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !alias {
+			p.record(start, 1)
+			return true, nil
+		}
+		seen[key] = true
+		if seen[target.String] || len(seen) > maxAliasDepth {
+			return false, ErrAliasLoop
+		}
+		key = target.String
+	}
+}
+
+// Exists reports whether the key holds a value in the bucket
+func (b *Bucket) Exists(key string) (bool, error) {
+	return b.kv.exists(b.name, key)
+}
@@ -0,0 +1,156 @@
+package myplainkv
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExportRecord is a line written by Export. The value is base64-encoded
+// in JSON. Mime is empty if no MIME type was set for the key.
+type ExportRecord struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Value  []byte `json:"value"`
+	Mime   string `json:"mime,omitempty"`
+}
+
+// Export writes the live keys of the buckets to w as JSON Lines, one
+// ExportRecord per key, in key order. With no buckets, every bucket
+// listed by ListBuckets is written. Rows are read a page at a time, so
+// buckets of any size can be exported.
+func (p *MyPlainKV) Export(w io.Writer, buckets ...string) (err error) {
+	var n int64
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		// Keep the connection across the pages
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	if len(buckets) == 0 {
+		if buckets, err = p.ListBuckets(); err != nil {
+			return err
+		}
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, b := range buckets {
+		c, err := p.exportBucket(enc, p.bucket(b))
+		n += c
+		if err != nil {
+			return err
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	p.record(start, n)
+	return nil
+}
+
+// exportBucket writes the keys of a bucket with their MIME types,
+// reading chunked values whole. The connection must be open.
+func (p *MyPlainKV) exportBucket(enc *json.Encoder, bucket string) (int64, error) {
+	type entry struct {
+		rec     ExportRecord
+		chunked bool
+	}
+	var n int64
+	from, op := "", `>=`
+	for {
+		sqlstr := `
+		SELECT v.KeyID, v.Value, COALESCE(c.Value = v.Value, 0), COALESCE(v.Mime, '')
+		FROM ` + p.defTableName + ` v
+		LEFT JOIN ` + p.defTableName + ` c ON c.Bucket = ? AND c.KeyID = v.KeyID
+		WHERE v.Bucket = ? AND v.KeyID ` + op + ` ?
+		AND (v.ExpiresAt IS NULL OR v.ExpiresAt > NOW(6))
+		ORDER BY v.KeyID LIMIT ?;`
+		sqr, err := p.query(sqlstr, chunkBucket(bucket), bucket, from, scanPageSize)
+		if err != nil {
+			return n, err
+		}
+		page := make([]entry, 0, scanPageSize)
+		for sqr.Next() {
+			e := entry{rec: ExportRecord{Bucket: bucket}}
+			if err = sqr.Scan(&e.rec.Key, &e.rec.Value, &e.chunked, &e.rec.Mime); err != nil {
+				sqr.Close()
+				return n, err
+			}
+			page = append(page, e)
+		}
+		sqr.Close()
+		if err = sqr.Err(); err != nil {
+			return n, err
+		}
+
+		for _, e := range page {
+			if e.chunked {
+				if e.rec.Value, err = p.get(bucket, e.rec.Key); err != nil {
+					return n, err
+				}
+			}
+			if err = enc.Encode(e.rec); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(page) < scanPageSize {
+			return n, nil
+		}
+		from, op = page[len(page)-1].rec.Key, `>`
+	}
+}
+
+// Import reads the JSON Lines written by Export from r and sets each
+// key, along with its MIME type if it has one. Keys are set one at a
+// time, so a failed import leaves the keys before the bad record set.
+// The error names the record that failed.
+func (p *MyPlainKV) Import(r io.Reader) (err error) {
+	var n int64
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	dec := json.NewDecoder(r)
+	for {
+		var rec ExportRecord
+		if err = dec.Decode(&rec); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf(`record %d: %w`, n+1, err)
+		}
+		err = p.atomic(func() error {
+			if err := p.set(rec.Bucket, rec.Key, rec.Value); err != nil {
+				return err
+			}
+			if rec.Mime == "" {
+				return nil
+			}
+			return p.setMime(rec.Bucket, rec.Key, rec.Mime)
+		})
+		if err != nil {
+			return fmt.Errorf(`record %d: %w`, n+1, err)
+		}
+		n++
+	}
+	p.record(start, n)
+	return nil
+}
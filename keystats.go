@@ -0,0 +1,200 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// hitFlushEvery is the longest counted hits are held in memory before
+	// they are written
+	hitFlushEvery time.Duration = 10 * time.Second
+)
+
+// KeyStat holds the counted reads and writes of a key. With sampling,
+// the counts are estimates.
+type KeyStat struct {
+	Reads     int64     // Reads of the key
+	Writes    int64     // Writes to the key
+	LastRead  time.Time // Time of the last counted read, zero if none
+	LastWrite time.Time // Time of the last counted write, zero if none
+}
+
+// hits holds the reads and writes of a key counted since the last flush
+type hits struct {
+	reads, writes int64
+}
+
+// hitLog holds the hits counted since they were last written
+type hitLog struct {
+	mu      sync.Mutex
+	keys    map[string]map[string]*hits
+	n       int
+	flushed time.Time
+}
+
+// add counts n reads or writes of a key and reports whether the log is
+// due to be written
+func (l *hitLog) add(bucket, key string, write bool, n int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.keys == nil {
+		l.keys = make(map[string]map[string]*hits)
+		l.flushed = time.Now()
+	}
+	if l.keys[bucket] == nil {
+		l.keys[bucket] = make(map[string]*hits)
+	}
+	h := l.keys[bucket][key]
+	if h == nil {
+		h = &hits{}
+		l.keys[bucket][key] = h
+		l.n++
+	}
+	if write {
+		h.writes += n
+	} else {
+		h.reads += n
+	}
+	return l.n >= accessBatch || time.Since(l.flushed) >= hitFlushEvery
+}
+
+// take empties the log and returns the hits it held by bucket
+func (l *hitLog) take() map[string]map[string]*hits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := l.keys
+	l.keys, l.n, l.flushed = nil, 0, time.Now()
+	return keys
+}
+
+// keyStatsTable returns the name of the table holding per-key counters
+func (p *MyPlainKV) keyStatsTable() string {
+	return p.defTableName + `KeyStats`
+}
+
+// keyStats creates the table holding per-key counters. The connection
+// must be open.
+func (p *MyPlainKV) keyStats() error {
+	_, err := p.db.Exec(
+		`CREATE TABLE IF NOT EXISTS ` + p.keyStatsTable() + ` (
+			Bucket VARCHAR(50) NOT NULL,
+			KeyID VARCHAR(300) NOT NULL,
+			ReadCount BIGINT NOT NULL DEFAULT 0,
+			WriteCount BIGINT NOT NULL DEFAULT 0,
+			LastRead DATETIME NULL,
+			LastWrite DATETIME NULL,
+			PRIMARY KEY (Bucket, KeyID)
+		);`)
+	return err
+}
+
+// hit counts a read or write of a key, one in KeyStatsSample of them
+// standing for KeyStatsSample hits, and writes the counts gathered so far
+// once enough have. Internal buckets are not counted. Errors are
+// dropped, as a lost batch only makes keys look less used. The
+// connection must be open.
+func (p *MyPlainKV) hit(bucket, key string, write bool) {
+	n := int64(p.KeyStatsSample)
+	if strings.HasPrefix(bucket, `--`) || (n > 1 && rand.Int63n(n) != 0) {
+		return
+	}
+	if !p.shared().hits.add(bucket, key, write, n) || p.inTransaction {
+		// Writing from a transaction would hold row locks until it ends
+		return
+	}
+	p.flushHits()
+}
+
+// flushHits writes the counted hits, one statement per 500 keys. Keys
+// are sorted so concurrent flushes lock rows in the same order. The
+// connection must be open.
+func (p *MyPlainKV) flushHits() error {
+	for bucket, keys := range p.shared().hits.take() {
+		batch := make([]string, 0, len(keys))
+		for k := range keys {
+			batch = append(batch, k)
+		}
+		sort.Strings(batch)
+		for len(batch) > 0 {
+			n := len(batch)
+			if n > batchSize {
+				n = batchSize
+			}
+			args := make([]any, 0, n*6)
+			for _, k := range batch[:n] {
+				h := keys[k]
+				args = append(args, bucket, k, h.reads, h.writes, h.reads, h.writes)
+			}
+			sqlstr := `
+			INSERT INTO ` + p.keyStatsTable() + ` (Bucket, KeyID, ReadCount, WriteCount, LastRead, LastWrite)
+			VALUES ` + placeholders(n, `(?, ?, ?, ?, IF(? > 0, NOW(), NULL), IF(? > 0, NOW(), NULL))`) + `
+			ON DUPLICATE KEY UPDATE
+				ReadCount = ReadCount + VALUES(ReadCount),
+				WriteCount = WriteCount + VALUES(WriteCount),
+				LastRead = COALESCE(VALUES(LastRead), LastRead),
+				LastWrite = COALESCE(VALUES(LastWrite), LastWrite);`
+			if _, err := p.exec(sqlstr, args...); err != nil {
+				return err
+			}
+			batch = batch[n:]
+		}
+	}
+	return nil
+}
+
+// KeyStats returns the counted reads and writes of a key, including
+// those not yet written. Keys are counted when KeyStatsSample is set;
+// a key never counted has a zero KeyStat.
+func (p *MyPlainKV) KeyStats(key string) (KeyStat, error) {
+	return p.keyStat(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) keyStat(bucket, key string) (ks KeyStat, err error) {
+	var (
+		lastRead  sql.NullInt64
+		lastWrite sql.NullInt64
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return ks, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	if p.KeyStatsSample < 1 {
+		return ks, nil
+	}
+	if err = p.flushHits(); err != nil {
+		return ks, err
+	}
+	sqlstr := `
+	SELECT ReadCount, WriteCount, UNIX_TIMESTAMP(LastRead), UNIX_TIMESTAMP(LastWrite) FROM ` + p.keyStatsTable() + `
+	WHERE Bucket = ? AND KeyID = ?;`
+	err = p.queryRow(sqlstr, p.bucket(bucket), key).Scan(&ks.Reads, &ks.Writes, &lastRead, &lastWrite)
+	if err == sql.ErrNoRows {
+		p.record(start, 0)
+		return ks, nil
+	}
+	if err != nil {
+		return KeyStat{}, err
+	}
+	if lastRead.Valid {
+		ks.LastRead = time.Unix(lastRead.Int64, 0)
+	}
+	if lastWrite.Valid {
+		ks.LastWrite = time.Unix(lastWrite.Int64, 0)
+	}
+	p.record(start, 1)
+	return ks, nil
+}
+
+// KeyStats returns the counted reads and writes of a key of the bucket
+func (b *Bucket) KeyStats(key string) (KeyStat, error) {
+	return b.kv.keyStat(b.name, key)
+}
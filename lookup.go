@@ -0,0 +1,99 @@
+package myplainkv
+
+import (
+	"time"
+)
+
+// LoadBucket reads every live key of a bucket into a map, for small
+// buckets used as lookup tables. The keys and values are read with one
+// query; only values stored in parts take more.
+func (p *MyPlainKV) LoadBucket(bucket string) (vals map[string][]byte, err error) {
+	var (
+		k       string
+		v       []byte
+		chunked bool
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	vals = make(map[string][]byte)
+	if err = p.Open(); err != nil {
+		return vals, err
+	}
+	if p.autoClose {
+		// Keep the connection for the values stored in parts
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	bucket = p.bucket(bucket)
+	sqlstr := `
+	SELECT v.KeyID, v.Value, COALESCE(c.Value = v.Value, 0)
+	FROM ` + p.defTableName + ` v
+	LEFT JOIN ` + p.defTableName + ` c ON c.Bucket = ? AND c.KeyID = v.KeyID
+	WHERE v.Bucket = ? AND (v.ExpiresAt IS NULL OR v.ExpiresAt > NOW(6));`
+	sqr, err := p.query(sqlstr, chunkBucket(bucket), bucket)
+	if err != nil {
+		return vals, err
+	}
+	large := make([]string, 0)
+	for sqr.Next() {
+		if err = sqr.Scan(&k, &v, &chunked); err != nil {
+			sqr.Close()
+			return make(map[string][]byte), err
+		}
+		if chunked {
+			large = append(large, k)
+			continue
+		}
+		vals[k] = v
+	}
+	sqr.Close()
+	if err = sqr.Err(); err != nil {
+		return make(map[string][]byte), err
+	}
+	for _, k := range large {
+		if vals[k], err = p.get(bucket, k); err != nil {
+			return make(map[string][]byte), err
+		}
+	}
+	p.record(start, int64(len(vals)))
+	return vals, nil
+}
+
+// SaveBucket sets the keys of the map in a bucket in one transaction,
+// sending one statement per 500 keys. With replace, keys of the bucket
+// missing from the map are deleted in the same transaction, so readers
+// see either the old contents or the new, never a mix.
+func (p *MyPlainKV) SaveBucket(bucket string, vals map[string][]byte, replace bool) (err error) {
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return ErrReadOnlyView
+	}
+	return p.atomic(func() error {
+		if replace {
+			keys, err := p.listKeys(bucket, "")
+			if err != nil {
+				return err
+			}
+			stale := make([]string, 0)
+			for _, k := range keys {
+				if _, ok := vals[k]; !ok {
+					stale = append(stale, k)
+				}
+			}
+			if err = p.mdel(bucket, stale); err != nil {
+				return err
+			}
+		}
+		return p.mset(bucket, vals)
+	})
+}
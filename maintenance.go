@@ -0,0 +1,129 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	maintBuckt string = `--maintenance--`
+	maintKey   string = `mode`
+
+	// maintCacheFor is how long a read of the maintenance flag is
+	// trusted before writes read it again
+	maintCacheFor time.Duration = time.Second
+)
+
+var (
+	ErrMaintenance error = errors.New(`store is in maintenance`)
+)
+
+// maintCache holds the last read of the maintenance flag, so writes do
+// not read it every time
+type maintCache struct {
+	mu   sync.Mutex
+	on   bool
+	msg  string
+	read time.Time
+}
+
+// get returns the cached flag and reports whether it is still fresh
+func (mc *maintCache) get() (bool, string, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.on, mc.msg, time.Since(mc.read) < maintCacheFor
+}
+
+// put caches a read of the flag
+func (mc *maintCache) put(on bool, msg string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.on, mc.msg, mc.read = on, msg, time.Now()
+}
+
+// SetMaintenance turns the maintenance mode on or off.
+// While on, all instances sharing the store reject mutating operations
+// with ErrMaintenance, including the message provided. Other instances
+// notice the change within a second, as they cache the flag that long.
+func (p *MyPlainKV) SetMaintenance(on bool, message string) error {
+	if on {
+		if err := p.set(maintBuckt, maintKey, []byte(message)); err != nil {
+			return err
+		}
+		p.shared().maint.put(true, message)
+		return nil
+	}
+
+	var err error
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	sqlstr := `DELETE FROM ` + p.defTableName + ` WHERE Bucket = ? AND KeyID = ?;`
+	if _, err = p.exec(sqlstr, maintBuckt, maintKey); err != nil {
+		return err
+	}
+	p.shared().maint.put(false, "")
+	return nil
+}
+
+// InMaintenance reports whether the store is in maintenance mode
+// and the message set with it
+func (p *MyPlainKV) InMaintenance() (bool, string, error) {
+	if err := p.Open(); err != nil {
+		return false, "", err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	return p.maintenance()
+}
+
+// maintenance reads the maintenance flag. The connection must be open.
+func (p *MyPlainKV) maintenance() (bool, string, error) {
+	var (
+		err error
+		msg []byte
+	)
+	sqlstr := `SELECT Value FROM ` + p.defTableName + ` WHERE Bucket=? AND KeyID=?;`
+	if err = p.queryRow(sqlstr, maintBuckt, maintKey).Scan(&msg); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, "", nil
+		}
+		return false, "", err
+	}
+	return true, string(msg), nil
+}
+
+// checkWrite is checkMaintenance for a write to bucket. Rate limiter
+// counters are exempt, as limiters treating errors as allowed would
+// otherwise stop limiting during maintenance.
+func (p *MyPlainKV) checkWrite(bucket string) error {
+	if bucket == rateBuckt {
+		return nil
+	}
+	return p.checkMaintenance()
+}
+
+// checkMaintenance returns ErrMaintenance with the maintenance message
+// if the store is in maintenance mode. The flag is read at most once a
+// second. The connection must be open.
+func (p *MyPlainKV) checkMaintenance() error {
+	on, msg, fresh := p.shared().maint.get()
+	if !fresh {
+		var err error
+		if on, msg, err = p.maintenance(); err != nil {
+			return err
+		}
+		p.shared().maint.put(on, msg)
+	}
+	if on {
+		return fmt.Errorf(`%w: %s`, ErrMaintenance, msg)
+	}
+	return nil
+}
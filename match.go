@@ -0,0 +1,63 @@
+package myplainkv
+
+// KeyMatch is how ListKeysMatch matches keys against a pattern
+type KeyMatch int
+
+const (
+	// MatchPrefix matches the keys starting with the pattern, where %
+	// and _ are wildcards. It is how ListKeys matches.
+	MatchPrefix KeyMatch = iota
+
+	// MatchLike matches the keys against the pattern with LIKE as it is,
+	// without appending %
+	MatchLike
+
+	// MatchExact matches the keys equal to the pattern, with no
+	// wildcards. Keys are compared in the collation of the table, so
+	// under a case-insensitive collation, keys differing only in case
+	// all match.
+	MatchExact
+)
+
+// like returns the LIKE pattern matching keys against pattern
+func (m KeyMatch) like(pattern string) string {
+	switch m {
+	case MatchLike:
+		return pattern
+	case MatchExact:
+		return escapeLike(pattern)
+	}
+	return pattern + `%`
+}
+
+// ListKeysMatch lists the keys matching the pattern as match says
+func (p *MyPlainKV) ListKeysMatch(pattern string, match KeyMatch) ([]string, error) {
+	return p.listKeysMatch(p.currBuckt, pattern, match)
+}
+
+// ListAllKeys lists every key of the current bucket
+func (p *MyPlainKV) ListAllKeys() ([]string, error) {
+	return p.listKeysMatch(p.currBuckt, "", MatchPrefix)
+}
+
+// KeysEqual lists the keys equal to key in the collation of the table.
+// Unlike ListKeys, % and _ in key are not wildcards.
+func (p *MyPlainKV) KeysEqual(key string) ([]string, error) {
+	return p.listKeysMatch(p.currBuckt, key, MatchExact)
+}
+
+// ListKeysMatch lists the keys of the bucket matching the pattern as
+// match says
+func (b *Bucket) ListKeysMatch(pattern string, match KeyMatch) ([]string, error) {
+	return b.kv.listKeysMatch(b.name, pattern, match)
+}
+
+// ListAllKeys lists every key of the bucket
+func (b *Bucket) ListAllKeys() ([]string, error) {
+	return b.kv.listKeysMatch(b.name, "", MatchPrefix)
+}
+
+// KeysEqual lists the keys of the bucket equal to key
+func (b *Bucket) KeysEqual(key string) ([]string, error) {
+	return b.kv.listKeysMatch(b.name, key, MatchExact)
+}
@@ -0,0 +1,25 @@
+package myplainkv
+
+import "testing"
+
+func TestKeyMatchLike(t *testing.T) {
+	for _, c := range []struct {
+		match   KeyMatch
+		pattern string
+		key     string
+		want    bool
+	}{
+		{MatchPrefix, `user_`, `user_1`, true},
+		{MatchPrefix, `user_`, `users`, true},
+		{MatchLike, `user_`, `user_1`, false},
+		{MatchLike, `%_1`, `user_1`, true},
+		{MatchExact, `user_1`, `user_1`, true},
+		{MatchExact, `user_1`, `userX1`, false},
+		{MatchExact, `50%`, `50% off`, false},
+	} {
+		if got := likeMatch(c.key, c.match.like(c.pattern)); got != c.want {
+			t.Logf(`Matching %q against %q with %d: got %v, expected %v`, c.key, c.pattern, c.match, got, c.want)
+			t.Fail()
+		}
+	}
+}
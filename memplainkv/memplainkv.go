@@ -0,0 +1,522 @@
+// Package memplainkv is a package implementing PlainKVer in memory,
+// with injectable latencies and errors for testing
+package memplainkv
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/narsilworks/plainkv/plainkver"
+)
+
+// MemPlainKV is a deterministic in-memory key-value store with the same
+// method set and semantics as MyPlainKV. Faults can be injected per
+// operation to exercise the error handling of applications.
+type MemPlainKV struct {
+	mu        sync.Mutex
+	data      map[string]map[string][]byte
+	mime      map[string]map[string]string
+	snap      *state
+	currBuckt string
+	faults    []Fault
+	calls     map[string]int
+}
+
+// state is a copy of the data taken when a transaction begins
+type state struct {
+	data map[string]map[string][]byte
+	mime map[string]map[string]string
+}
+
+// Fault is a failure or delay injected into matching operations
+type Fault struct {
+	Op      string        // Operation name, such as "Get" or "Set". Empty matches all operations
+	Key     string        // Key to match. Empty matches all keys
+	Err     error         // Error returned instead of running the operation
+	Latency time.Duration // Delay before the operation runs or fails
+	Times   int           // Number of calls affected. Zero affects every call
+}
+
+const (
+	tallyKey string = `_______#tally-`
+)
+
+const (
+	// DefaultMime is the MIME type GetMime returns for keys without one
+	DefaultMime string = `application/octet-stream`
+)
+
+var (
+	ErrNotOpen error = errors.New(`store is not open`)
+)
+
+var _ plainkver.PlainKVer = (*MemPlainKV)(nil)
+
+// NewMemPlainKV creates a new MemPlainKV object
+func NewMemPlainKV() *MemPlainKV {
+	return &MemPlainKV{
+		currBuckt: `default`,
+		calls:     make(map[string]int),
+	}
+}
+
+// Inject appends faults to the fault script. For every operation, the
+// first fault matching it with calls left is applied.
+func (m *MemPlainKV) Inject(faults ...Fault) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = append(m.faults, faults...)
+}
+
+// ClearFaults removes all injected faults
+func (m *MemPlainKV) ClearFaults() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = nil
+}
+
+// Calls returns the number of times an operation was called,
+// including calls that failed
+func (m *MemPlainKV) Calls(op string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[op]
+}
+
+// enter counts the call and applies the first matching fault.
+// It must be called without holding the lock.
+func (m *MemPlainKV) enter(op, key string) error {
+	return m.enterCtx(context.Background(), op, key)
+}
+
+// enterCtx is enter, returning early if ctx is done before or during
+// an injected latency
+func (m *MemPlainKV) enterCtx(ctx context.Context, op, key string) error {
+	var f *Fault
+	m.mu.Lock()
+	m.calls[op]++
+	for i := range m.faults {
+		c := &m.faults[i]
+		if c.Op != "" && c.Op != op {
+			continue
+		}
+		if c.Key != "" && c.Key != key {
+			continue
+		}
+		if c.Times < 0 {
+			continue // exhausted
+		}
+		if c.Times > 0 {
+			c.Times--
+			if c.Times == 0 {
+				c.Times = -1
+			}
+		}
+		f = c
+		break
+	}
+	var (
+		lat time.Duration
+		err error
+	)
+	if f != nil {
+		lat, err = f.Latency, f.Err
+	}
+	m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if lat > 0 {
+		t := time.NewTimer(lat)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func (m *MemPlainKV) bucket() string {
+	if m.currBuckt == "" {
+		return `default`
+	}
+	return m.currBuckt
+}
+
+// Open initializes the store
+func (m *MemPlainKV) Open() error {
+	if err := m.enter(`Open`, ""); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		m.data = make(map[string]map[string][]byte)
+		m.mime = make(map[string]map[string]string)
+	}
+	return nil
+}
+
+// Close closes the store. The data is kept until the object is discarded.
+func (m *MemPlainKV) Close() error {
+	if err := m.enter(`Close`, ""); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snap = nil
+	return nil
+}
+
+// Get retrieves a record using a key
+func (m *MemPlainKV) Get(key string) ([]byte, error) {
+	return m.GetCtx(context.Background(), key)
+}
+
+// GetCtx is Get, failing with the error of ctx if it is done
+func (m *MemPlainKV) GetCtx(ctx context.Context, key string) ([]byte, error) {
+	if err := m.enterCtx(ctx, `Get`, key); err != nil {
+		return []byte{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return []byte{}, ErrNotOpen
+	}
+	v, ok := m.data[m.bucket()][key]
+	if !ok {
+		return []byte{}, nil
+	}
+	return append([]byte{}, v...), nil
+}
+
+// Exists reports whether the key holds a value, telling an empty value
+// from a missing key
+func (m *MemPlainKV) Exists(key string) (bool, error) {
+	if err := m.enter(`Exists`, key); err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return false, ErrNotOpen
+	}
+	_, ok := m.data[m.bucket()][key]
+	return ok, nil
+}
+
+// Set creates or updates the record by the value
+func (m *MemPlainKV) Set(key string, value []byte) error {
+	return m.SetCtx(context.Background(), key, value)
+}
+
+// SetCtx is Set, failing with the error of ctx if it is done
+func (m *MemPlainKV) SetCtx(ctx context.Context, key string, value []byte) error {
+	if err := m.enterCtx(ctx, `Set`, key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return ErrNotOpen
+	}
+	m.put(m.bucket(), key, value)
+	return nil
+}
+
+func (m *MemPlainKV) put(bucket, key string, value []byte) {
+	bk, ok := m.data[bucket]
+	if !ok {
+		bk = make(map[string][]byte)
+		m.data[bucket] = bk
+	}
+	bk[key] = append([]byte{}, value...)
+}
+
+// GetMime gets the mime of the value stored. For a key without one, it
+// returns DefaultMime along with plainkver.ErrNoMime.
+func (m *MemPlainKV) GetMime(key string) (string, error) {
+	if err := m.enter(`GetMime`, key); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return "", ErrNotOpen
+	}
+	mt, ok := m.mime[m.bucket()][key]
+	if !ok || mt == "" {
+		return DefaultMime, plainkver.ErrNoMime
+	}
+	return mt, nil
+}
+
+// SetMime sets the mime of the value stored. As with MyPlainKV, the key
+// must exist, or ErrKeyNotFound is returned.
+func (m *MemPlainKV) SetMime(key string, mime string) error {
+	if err := m.enter(`SetMime`, key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return ErrNotOpen
+	}
+	if _, ok := m.data[m.bucket()][key]; !ok {
+		return plainkver.ErrKeyNotFound
+	}
+	bk, ok := m.mime[m.bucket()]
+	if !ok {
+		bk = make(map[string]string)
+		m.mime[m.bucket()] = bk
+	}
+	bk[key] = mime
+	return nil
+}
+
+// SetBucket sets the current bucket.
+func (m *MemPlainKV) SetBucket(bucket string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.currBuckt = bucket
+}
+
+// Del deletes a record with the provided key
+func (m *MemPlainKV) Del(key string) error {
+	return m.DelCtx(context.Background(), key)
+}
+
+// DelCtx is Del, failing with the error of ctx if it is done
+func (m *MemPlainKV) DelCtx(ctx context.Context, key string) error {
+	if err := m.enterCtx(ctx, `Del`, key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return ErrNotOpen
+	}
+	delete(m.data[m.bucket()], key)
+	delete(m.mime[m.bucket()], key)
+	return nil
+}
+
+// ListKeys lists all keys starting with the pattern, in key order. As
+// in MyPlainKV, the pattern is matched with LIKE, so % and _ in it are
+// wildcards and case is ignored.
+func (m *MemPlainKV) ListKeys(pattern string) ([]string, error) {
+	return m.ListKeysCtx(context.Background(), pattern)
+}
+
+// ListKeysCtx is ListKeys, failing with the error of ctx if it is done
+func (m *MemPlainKV) ListKeysCtx(ctx context.Context, pattern string) ([]string, error) {
+	if err := m.enterCtx(ctx, `ListKeys`, pattern); err != nil {
+		return []string{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return []string{}, ErrNotOpen
+	}
+	val := make([]string, 0)
+	for k := range m.data[m.bucket()] {
+		if likeMatch(k, pattern+`%`) {
+			val = append(val, k)
+		}
+	}
+	sort.Strings(val)
+	return val, nil
+}
+
+// likeMatch reports whether s matches a LIKE pattern the way MySQL does
+// with its default collation: % matches any run of characters, _ any
+// one character, \ escapes the next character, and case is ignored
+func likeMatch(s, pattern string) bool {
+	sr := []rune(strings.ToLower(s))
+	pr := []rune(strings.ToLower(pattern))
+	var match func(i, j int) bool
+	match = func(i, j int) bool {
+		for j < len(pr) {
+			switch pr[j] {
+			case '%':
+				for k := i; k <= len(sr); k++ {
+					if match(k, j+1) {
+						return true
+					}
+				}
+				return false
+			case '_':
+				if i >= len(sr) {
+					return false
+				}
+			case '\\':
+				if j+1 < len(pr) {
+					j++
+				}
+				fallthrough
+			default:
+				if i >= len(sr) || sr[i] != pr[j] {
+					return false
+				}
+			}
+			i++
+			j++
+		}
+		return i == len(sr)
+	}
+	return match(0, 0)
+}
+
+// Tally gets the current tally of a key.
+// To start with a pre-defined number, set the offset variable
+// It automatically creates new key if it does not exist
+func (m *MemPlainKV) Tally(key string, offset int) (int, error) {
+	if err := m.enter(`Tally`, key); err != nil {
+		return -1, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.add(key, int64(offset), 0)
+	return int(n), err
+}
+
+// TallyIncr increments the tally
+func (m *MemPlainKV) TallyIncr(key string) (int, error) {
+	if err := m.enter(`TallyIncr`, key); err != nil {
+		return -1, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.add(key, 0, 1)
+	return int(n), err
+}
+
+// TallyDecr decrements the tally
+func (m *MemPlainKV) TallyDecr(key string) (int, error) {
+	if err := m.enter(`TallyDecr`, key); err != nil {
+		return -1, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.add(key, 0, -1)
+	return int(n), err
+}
+
+// TallyIncrBy adds delta to the tally
+func (m *MemPlainKV) TallyIncrBy(key string, delta int64) (int64, error) {
+	if err := m.enter(`TallyIncrBy`, key); err != nil {
+		return -1, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.add(key, 0, delta)
+}
+
+// TallyDecrBy subtracts delta from the tally
+func (m *MemPlainKV) TallyDecrBy(key string, delta int64) (int64, error) {
+	if err := m.enter(`TallyDecrBy`, key); err != nil {
+		return -1, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.add(key, 0, -delta)
+}
+
+// TallyReset resets tally to zero
+func (m *MemPlainKV) TallyReset(key string) error {
+	if err := m.enter(`TallyReset`, key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return ErrNotOpen
+	}
+	m.put(m.bucket(), tallyKey+key, []byte(`0`))
+	return nil
+}
+
+// add adds delta to a tally, creating it at offset if it does not exist.
+// The lock must be held.
+func (m *MemPlainKV) add(key string, offset, delta int64) (int64, error) {
+	if m.data == nil {
+		return -1, ErrNotOpen
+	}
+	tv := offset
+	if v, ok := m.data[m.bucket()][tallyKey+key]; ok {
+		tv, _ = strconv.ParseInt(string(v), 10, 64)
+	}
+	tv += delta
+	m.put(m.bucket(), tallyKey+key, []byte(strconv.FormatInt(tv, 10)))
+	return tv, nil
+}
+
+// Begin a transaction
+func (m *MemPlainKV) Begin() error {
+	return m.BeginCtx(context.Background())
+}
+
+// BeginCtx is Begin, failing with the error of ctx if it is done
+func (m *MemPlainKV) BeginCtx(ctx context.Context) error {
+	if err := m.enterCtx(ctx, `Begin`, ""); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return ErrNotOpen
+	}
+	m.snap = &state{
+		data: make(map[string]map[string][]byte),
+		mime: make(map[string]map[string]string),
+	}
+	for b, kvs := range m.data {
+		cp := make(map[string][]byte, len(kvs))
+		for k, v := range kvs {
+			cp[k] = v
+		}
+		m.snap.data[b] = cp
+	}
+	for b, kvs := range m.mime {
+		cp := make(map[string]string, len(kvs))
+		for k, v := range kvs {
+			cp[k] = v
+		}
+		m.snap.mime[b] = cp
+	}
+	return nil
+}
+
+// Commit transaction
+func (m *MemPlainKV) Commit() error {
+	if err := m.enter(`Commit`, ""); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snap = nil
+	return nil
+}
+
+// Rollback transaction
+func (m *MemPlainKV) Rollback() error {
+	if err := m.enter(`Rollback`, ""); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snap == nil {
+		return nil // silently rollback
+	}
+	m.data, m.mime = m.snap.data, m.snap.mime
+	m.snap = nil
+	return nil
+}
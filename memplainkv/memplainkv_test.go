@@ -0,0 +1,154 @@
+package memplainkv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/narsilworks/plainkv/plainkver"
+)
+
+func TestSetGet(t *testing.T) {
+	kv := NewMemPlainKV()
+	if err := kv.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := kv.Set(`sample_key`, []byte(`Sample value`)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := kv.Get(`sample_key`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `Sample value` {
+		t.Fatalf(`Expected Sample value, got %s`, b)
+	}
+
+	kv.SetBucket(`other`)
+	if b, _ = kv.Get(`sample_key`); len(b) != 0 {
+		t.Fatalf(`Expected empty value from another bucket, got %s`, b)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	kv := NewMemPlainKV()
+	kv.Open()
+	kv.Set(`sample_key`, []byte(`before`))
+
+	kv.Begin()
+	kv.Set(`sample_key`, []byte(`after`))
+	kv.Rollback()
+
+	b, _ := kv.Get(`sample_key`)
+	if string(b) != `before` {
+		t.Fatalf(`Expected before, got %s`, b)
+	}
+}
+
+func TestTally(t *testing.T) {
+	kv := NewMemPlainKV()
+	kv.Open()
+
+	tally, _ := kv.Tally(`sample`, 10)
+	if tally != 10 {
+		t.Fatalf(`Expected offset 10, got %d`, tally)
+	}
+	kv.TallyIncr(`sample`)
+	tally, _ = kv.TallyIncr(`sample`)
+	if tally != 12 {
+		t.Fatalf(`Expected 12, got %d`, tally)
+	}
+	if n, _ := kv.TallyIncrBy(`sample`, 1<<40); n != 12+1<<40 {
+		t.Fatalf(`Expected %d, got %d`, 12+1<<40, n)
+	}
+	if n, _ := kv.TallyDecrBy(`sample`, 1<<40); n != 12 {
+		t.Fatalf(`Expected 12, got %d`, n)
+	}
+}
+
+func TestInjectedFaults(t *testing.T) {
+	errDown := errors.New(`down`)
+	kv := NewMemPlainKV()
+	kv.Open()
+	kv.Inject(
+		Fault{Op: `Get`, Err: errDown, Times: 2},
+		Fault{Op: `Set`, Key: `slow`, Latency: 10 * time.Millisecond},
+	)
+
+	for i := 0; i < 2; i++ {
+		if _, err := kv.Get(`sample_key`); !errors.Is(err, errDown) {
+			t.Fatalf(`Call %d: expected injected error, got %v`, i, err)
+		}
+	}
+	if _, err := kv.Get(`sample_key`); err != nil {
+		t.Fatalf(`Expected the fault to be exhausted, got %v`, err)
+	}
+	if n := kv.Calls(`Get`); n != 3 {
+		t.Fatalf(`Expected 3 calls, got %d`, n)
+	}
+
+	start := time.Now()
+	kv.Set(`slow`, nil)
+	if time.Since(start) < 10*time.Millisecond {
+		t.Fatalf(`Expected injected latency`)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	kv := NewMemPlainKV()
+	kv.Open()
+	kv.Inject(Fault{Op: `Set`, Latency: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := kv.SetCtx(ctx, `sample_key`, []byte(`x`)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf(`Expected deadline exceeded, got %v`, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf(`Expected the injected latency to be cut short`)
+	}
+	if b, _ := kv.Get(`sample_key`); len(b) != 0 {
+		t.Fatalf(`Expected no value after a cancelled set, got %s`, b)
+	}
+}
+
+func TestGetMime(t *testing.T) {
+	kv := NewMemPlainKV()
+	kv.Open()
+	kv.Set(`page`, []byte(`<p>hi</p>`))
+	if mt, err := kv.GetMime(`page`); mt != DefaultMime || !errors.Is(err, plainkver.ErrNoMime) {
+		t.Fatalf(`Expected %s and ErrNoMime, got %s (%v)`, DefaultMime, mt, err)
+	}
+	kv.SetMime(`page`, `text/html`)
+	if mt, err := kv.GetMime(`page`); mt != `text/html` || err != nil {
+		t.Fatalf(`Expected text/html, got %s (%v)`, mt, err)
+	}
+	if err := kv.SetMime(`missing`, `text/html`); !errors.Is(err, plainkver.ErrKeyNotFound) {
+		t.Fatalf(`Expected ErrKeyNotFound for a missing key, got %v`, err)
+	}
+}
+
+func TestListKeysLike(t *testing.T) {
+	kv := NewMemPlainKV()
+	kv.Open()
+	for _, k := range []string{`user_1`, `userX1`, `User_2`, `order_1`} {
+		kv.Set(k, []byte(`v`))
+	}
+
+	// As with MySQL, _ is a wildcard unless escaped, and case is ignored
+	keys, _ := kv.ListKeys(`user_`)
+	if len(keys) != 3 {
+		t.Fatalf(`Expected 3 keys for user_, got %v`, keys)
+	}
+	keys, _ = kv.ListKeys(`user\_`)
+	if len(keys) != 2 {
+		t.Fatalf(`Expected 2 keys for user\_, got %v`, keys)
+	}
+	keys, _ = kv.ListKeys(`%_1`)
+	if len(keys) != 3 {
+		t.Fatalf(`Expected 3 keys for %%_1, got %v`, keys)
+	}
+}
@@ -0,0 +1,65 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"time"
+)
+
+// KeyMeta holds what is known of a record besides its value
+type KeyMeta struct {
+	Mime      string    // MIME type of the value, empty if none was set
+	CreatedAt time.Time // Time the key was first set
+	UpdatedAt time.Time // Time the record last changed. Reads do not change it
+}
+
+// Meta returns the MIME type and write times of a key, read from its
+// record with one query. A missing key fails with ErrKeyNotFound.
+func (p *MyPlainKV) Meta(key string) (KeyMeta, error) {
+	return p.meta(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) meta(bucket, key string) (km KeyMeta, err error) {
+	var (
+		mime      sql.NullString
+		createdAt int64
+		updatedAt int64
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return km, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if src, pats := p.shared().views.chain(bucket); pats != nil {
+		if !inView(key, pats) {
+			return km, ErrKeyNotFound
+		}
+		bucket = src
+	}
+	// Microseconds are kept, as records are often written within a second
+	sqlstr := `
+	SELECT Mime, CAST(UNIX_TIMESTAMP(CreatedAt) * 1000000 AS SIGNED), CAST(UNIX_TIMESTAMP(UpdatedAt) * 1000000 AS SIGNED)
+	FROM ` + p.defTableName + `
+	WHERE Bucket = ? AND KeyID = ? AND ` + notExpired + `;`
+	err = p.queryRow(sqlstr, bucket, key).Scan(&mime, &createdAt, &updatedAt)
+	if err == sql.ErrNoRows {
+		p.record(start, 0)
+		return km, ErrKeyNotFound
+	}
+	if err != nil {
+		return KeyMeta{}, err
+	}
+	km.Mime = mime.String
+	km.CreatedAt = time.UnixMicro(createdAt)
+	km.UpdatedAt = time.UnixMicro(updatedAt)
+	p.record(start, 1)
+	return km, nil
+}
+
+// Meta returns the MIME type and write times of a key of the bucket
+func (b *Bucket) Meta(key string) (KeyMeta, error) {
+	return b.kv.meta(b.name, key)
+}
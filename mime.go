@@ -0,0 +1,58 @@
+package myplainkv
+
+import (
+	"sync"
+
+	"github.com/narsilworks/plainkv/plainkver"
+)
+
+const (
+	// DefaultMime is the MIME type GetMime returns for keys without one,
+	// unless their bucket has a default of its own
+	DefaultMime string = `application/octet-stream`
+)
+
+var (
+	ErrNoMime error = plainkver.ErrNoMime
+)
+
+// mimeDefaults holds the default MIME types set on a store by bucket
+type mimeDefaults struct {
+	mu    sync.RWMutex
+	mimes map[string]string
+}
+
+// SetDefaultMime sets the MIME type GetMime returns for keys of the
+// bucket without one. An empty mime restores DefaultMime. Defaults are
+// held in memory, shared by the store and its sessions and connections,
+// and not stored in the database.
+func (p *MyPlainKV) SetDefaultMime(bucket, mime string) {
+	md := &p.shared().mimes
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if mime == "" {
+		delete(md.mimes, p.bucket(bucket))
+		return
+	}
+	if md.mimes == nil {
+		md.mimes = make(map[string]string)
+	}
+	md.mimes[p.bucket(bucket)] = mime
+}
+
+// defaultMime returns the MIME type of keys of the bucket without one
+func (p *MyPlainKV) defaultMime(bucket string) string {
+	md := &p.shared().mimes
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+	if mime, ok := md.mimes[p.bucket(bucket)]; ok {
+		return mime
+	}
+	return DefaultMime
+}
+
+// SetDefaultMime sets the MIME type GetMime returns for keys of the
+// bucket without one
+func (b *Bucket) SetDefaultMime(mime string) {
+	b.kv.SetDefaultMime(b.name, mime)
+}
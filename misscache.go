@@ -0,0 +1,82 @@
+package myplainkv
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	maxMisses int = 10000
+)
+
+// missCache remembers keys recently found missing
+type missCache struct {
+	mu      sync.Mutex
+	keys    map[string]time.Time
+	lookups int64
+	hits    int64
+}
+
+func missKey(bucket, key string) string {
+	return bucket + "\x00" + key
+}
+
+// has reports whether the key was found missing within the TTL
+func (c *missCache) has(bucket, key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lookups++
+	exp, ok := c.keys[missKey(bucket, key)]
+	if !ok {
+		return false
+	}
+	if time.Now().After(exp) {
+		delete(c.keys, missKey(bucket, key))
+		return false
+	}
+	c.hits++
+	return true
+}
+
+// stats returns the number of keys held, and the lookups and hits so far
+func (c *missCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs := CacheStats{
+		Entries: len(c.keys),
+		Lookups: c.lookups,
+		Hits:    c.hits,
+	}
+	if c.lookups > 0 {
+		cs.HitRate = float64(c.hits) / float64(c.lookups)
+	}
+	return cs
+}
+
+// add remembers a missing key for the TTL
+func (c *missCache) add(bucket, key string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]time.Time)
+	}
+	if len(c.keys) >= maxMisses {
+		now := time.Now()
+		for k, exp := range c.keys {
+			if now.After(exp) {
+				delete(c.keys, k)
+			}
+		}
+		if len(c.keys) >= maxMisses {
+			c.keys = make(map[string]time.Time)
+		}
+	}
+	c.keys[missKey(bucket, key)] = time.Now().Add(ttl)
+}
+
+// forget removes a key, typically because it was just written
+func (c *missCache) forget(bucket, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.keys, missKey(bucket, key))
+}
@@ -2,84 +2,177 @@
 package myplainkv
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/narsilworks/plainkv/plainkver"
 )
 
 // PlainKV is a key-value database that uses
-// MySQL/MariaDB as its storage backend
+// MySQL/MariaDB as its storage backend.
+//
+// A MyPlainKV is not safe for concurrent use. Its current bucket,
+// transaction and last result are kept on it, so goroutines sharing one
+// race on them. Each goroutine should use a Session of its own. The Ctx
+// methods run on a session when no transaction is open, so they alone
+// may be called concurrently on a shared store.
 type MyPlainKV struct {
-	DSN           string // Data Source Name
-	db            *sql.DB
-	tx            *sql.Tx
-	currBuckt     string
-	defTableName  string
-	autoClose     bool
-	inTransaction bool
+	DSN              string        // Data Source Name
+	SurrogateKey     bool          // Create the table with an AUTO_INCREMENT primary key
+	ChunkOversized   bool          // Split values larger than a MEDIUMBLOB across several rows. Set on every instance of such a store
+	MissTTL          time.Duration // Remember keys found missing for this long. Zero disables
+	TTLJitter        float64       // Spread each TTL randomly by up to this fraction of it either way, such as 0.1. Zero disables
+	RefDelete        RefMode       // What Del does to keys referencing the deleted key
+	ReverseKeys      bool          // Add an indexed reversed-key column for ListKeysBySuffix
+	RecencyIndex     bool          // Add an index on (Bucket, UpdatedAt) for queries by write time
+	BucketStats      bool          // Maintain per-bucket key counts and sizes with triggers
+	AccessResolution time.Duration // Record read times at this resolution for EvictIdle. Zero disables
+	StrictNotFound   bool          // Get returns ErrKeyNotFound for missing keys instead of an empty value
+	KeyStatsSample   int           // Count one in this many reads and writes per key for KeyStats. Zero disables
+	MaxOpenConns     int           // Most connections the pool opens. Zero means 10, negative means no limit
+	MaxIdleConns     int           // Most idle connections the pool keeps. Zero means 10, negative means none
+	ConnMaxLifetime  time.Duration // Longest a connection is reused. Zero means 3 minutes, negative means forever
+	DebugLogSize     int           // Keep the SQL of this many statements for DebugLog. Zero disables
+	ErasureSecret    []byte        // Key of the HMAC naming subjects in proofs of erasure. EraseSubject needs it
+	db               *sql.DB
+	tx               *sql.Tx
+	currBuckt        string
+	defBuckt         string
+	defTableName     string
+	extDB            *sql.DB
+	autoClose        bool
+	inTransaction    bool
+	lastRes          Result
+	lastErr          error
+	lastErrAt        time.Time
+	misses           missCache
+	views            viewSet
+	conn             *sql.Conn
+	subjects         subjectRules
+	upgraders        upgraderSet
+	chores           choreState
+	accesses         accessLog
+	hits             hitLog
+	trail            debugRing
+	orders           orderSet
+	mimes            mimeDefaults
+	maint            maintCache
+	root             *MyPlainKV
+	sharedPool       bool
+	mu               sync.Mutex
+	resMu            sync.Mutex
+	ctx              context.Context
 }
 
 const (
-	mimeBuckt string = `--mime--`
-	tallyKey  string = `_______#tally-%s`
+	// defMaxConns and defConnMaxLifetime size the pool when the fields
+	// setting them are zero
+	defMaxConns        int           = 10
+	defConnMaxLifetime time.Duration = 3 * time.Minute
 )
 
+const (
+	mimeBuckt   string = `--mime--`
+	tallyKey    string = `_______#tally-%s`
+	maxValueLen int    = 16777215
+	maxMimeLen  int    = 255
+)
+
+// Result holds the metadata of a completed operation
+type Result struct {
+	RowsAffected int64         // Rows affected, or rows returned for reads
+	Duration     time.Duration // Time spent executing the operation
+	Retries      int           // Number of retries before the operation completed
+}
+
 var (
 	ErrBucketIdTooLong error = errors.New(`bucket id too long`)
 	ErrKeyTooLong      error = errors.New(`key too long`)
+	ErrMimeTooLong     error = errors.New(`mime too long`)
+	ErrKeyNotFound     error = plainkver.ErrKeyNotFound
 	ErrValueTooLong    error = errors.New(`value too large`)
 )
 
+var _ plainkver.PlainKVer = (*MyPlainKV)(nil)
+
 // NewMyPlainKV creates a new MyPlainKV object
 // This is the recommended method
 func NewMyPlainKV(dsn string, autoClose bool) *MyPlainKV {
 	return &MyPlainKV{
 		DSN:          dsn,
-		currBuckt:    `default`,
+		defBuckt:     `default`,
 		autoClose:    autoClose,
 		defTableName: `KeyValueTBL`,
 	}
 }
 
-func (p *MyPlainKV) get(bucket, key string) ([]byte, error) {
+// NewFromDB creates a new MyPlainKV object using a connection pool the
+// application already manages, such as one with custom TLS, tracing or
+// IAM authentication. The pool's settings are left as they are, and
+// Close does not close it. NewFromDBTable also sets the table name.
+func NewFromDB(db *sql.DB) *MyPlainKV {
+	p := NewMyPlainKV("", false)
+	p.extDB = db
+	return p
+}
 
-	var (
-		err error
-		val []byte
-	)
-	val = make([]byte, 0)
-	if err = p.Open(); err != nil {
-		return val, err
+// bucket returns the bucket an operation should use:
+// the bucket provided, or the default bucket if it is empty
+func (p *MyPlainKV) bucket(bucket string) string {
+	if bucket != "" {
+		return bucket
 	}
-	if p.autoClose {
-		defer p.Close()
+	if p.defBuckt != "" {
+		return p.defBuckt
 	}
-	if bucket == "" {
-		bucket = "default"
+	return `default`
+}
+
+func (p *MyPlainKV) get(bucket, key string) ([]byte, error) {
+	if up := p.shared().upgraders.get(p.bucket(bucket)); up != nil {
+		return p.getUpgraded(bucket, key, up)
 	}
-	sqlstr := `
-	SELECT Value FROM KeyValueTBL
-	WHERE Bucket=? AND KeyID=?;`
-	if p.inTransaction {
-		err = p.tx.QueryRow(sqlstr, bucket, key).Scan(&val)
-	} else {
-		err = p.db.QueryRow(sqlstr, bucket, key).Scan(&val)
+	return p.fetch(bucket, key)
+}
+
+// getKey reads the value of a key for a caller. With StrictNotFound, a
+// missing key fails with ErrKeyNotFound, while an empty value does not.
+func (p *MyPlainKV) getKey(bucket, key string) ([]byte, error) {
+	val, err := p.get(bucket, key)
+	if err != nil || len(val) > 0 || !p.StrictNotFound {
+		return val, err
 	}
+	// An empty result is either an empty value or no value at all
+	ok, err := p.exists(bucket, key)
 	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return val, err
-		}
+		return val, err
+	}
+	if !ok {
+		return val, ErrKeyNotFound
 	}
 	return val, nil
 }
 
+// fetch reads the value of a key into a new slice. Nothing read is
+// returned on error.
+func (p *MyPlainKV) fetch(bucket, key string) ([]byte, error) {
+	val, _, err := p.appendValue(bucket, key, make([]byte, 0))
+	return val, err
+}
+
 // Set creates or updates the record by the value
-func (p *MyPlainKV) set(bucket, key string, value []byte) error {
-	var err error
+func (p *MyPlainKV) set(bucket, key string, value []byte) (err error) {
+	var (
+		res sql.Result
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
 
 	if err = p.Open(); err != nil {
 		return err
@@ -87,60 +180,234 @@ func (p *MyPlainKV) set(bucket, key string, value []byte) error {
 	if p.autoClose {
 		defer p.Close()
 	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return ErrReadOnlyView
+	}
+	if p.KeyStatsSample > 0 {
+		defer func() {
+			if err == nil {
+				p.hit(bucket, key, true)
+			}
+		}()
+	}
 	if len(bucket) > 50 {
 		return ErrBucketIdTooLong
 	}
 	if len(key) > 300 {
 		return ErrKeyTooLong
 	}
-	if len(value) > 16777215 {
+	if len(value) > maxValueLen && !p.ChunkOversized {
 		return ErrValueTooLong
 	}
+	if bucket != maintBuckt {
+		if err = p.checkMaintenance(); err != nil {
+			return err
+		}
+	}
+	p.shared().misses.forget(bucket, key)
+	if len(value) > maxValueLen {
+		if err = p.setChunked(bucket, key, value); err != nil {
+			return err
+		}
+		p.record(start, 1)
+		return nil
+	}
 
-	sqlstr := `
-	INSERT INTO KeyValueTBL VALUES (?, ?, ?)
-	ON DUPLICATE KEY UPDATE Value=?;`
-	if p.inTransaction {
-		_, err = p.tx.Exec(sqlstr, bucket, key, value)
+	if p.ChunkOversized {
+		// The key may hold a chunked value, whose parts go with it
+		err = p.atomic(func() error {
+			if err := p.unchunk(bucket, []string{key}); err != nil {
+				return err
+			}
+			res, err = p.upsert(bucket, key, value)
+			return err
+		})
 	} else {
-		_, err = p.db.Exec(sqlstr, bucket, key, value)
+		res, err = p.upsert(bucket, key, value)
 	}
 	if err != nil {
 		return err
 	}
+	ra, _ := res.RowsAffected()
+	p.record(start, ra)
 	return nil
 }
 
-// Get retrieves a record using a key
+// renewed are the assignments of an upsert giving an expired row it
+// replaces the MIME type and creation time of a new key. They must come
+// before ExpiresAt is cleared, as later assignments see earlier ones.
+const renewed string = `Mime = IF(ExpiresAt <= NOW(6), NULL, Mime),
+	CreatedAt = IF(ExpiresAt <= NOW(6), NOW(6), CreatedAt)`
+
+// upsert creates or updates a record without any checks
+func (p *MyPlainKV) upsert(bucket, key string, value []byte) (sql.Result, error) {
+	sqlstr := `
+	INSERT INTO ` + p.defTableName + ` (Bucket, KeyID, Value) VALUES (?, ?, ?)
+	ON DUPLICATE KEY UPDATE ` + renewed + `, Value=?, ExpiresAt=NULL, Version=Version+1;`
+	return p.exec(sqlstr, bucket, key, value, value)
+}
+
+// exec runs a statement in the current transaction, if any,
+// or on the pinned connection, if any
+func (p *MyPlainKV) exec(sqlstr string, args ...any) (_ sql.Result, err error) {
+	if p.DebugLogSize > 0 {
+		defer p.trace(time.Now(), sqlstr, args, &err)
+	}
+	switch {
+	case p.inTransaction:
+		return p.tx.ExecContext(p.callCtx(), sqlstr, args...)
+	case p.conn != nil:
+		return p.conn.ExecContext(p.callCtx(), sqlstr, args...)
+	}
+	return p.db.ExecContext(p.callCtx(), sqlstr, args...)
+}
+
+// query runs a query in the current transaction, if any,
+// or on the pinned connection, if any
+func (p *MyPlainKV) query(sqlstr string, args ...any) (_ *sql.Rows, err error) {
+	if p.DebugLogSize > 0 {
+		defer p.trace(time.Now(), sqlstr, args, &err)
+	}
+	switch {
+	case p.inTransaction:
+		return p.tx.QueryContext(p.callCtx(), sqlstr, args...)
+	case p.conn != nil:
+		return p.conn.QueryContext(p.callCtx(), sqlstr, args...)
+	}
+	return p.db.QueryContext(p.callCtx(), sqlstr, args...)
+}
+
+// queryRow runs a single-row query in the current transaction, if any,
+// or on the pinned connection, if any
+func (p *MyPlainKV) queryRow(sqlstr string, args ...any) (row *sql.Row) {
+	if p.DebugLogSize > 0 {
+		defer func(start time.Time) {
+			// Only errors running the query show before the row is scanned
+			err := row.Err()
+			p.trace(start, sqlstr, args, &err)
+		}(time.Now())
+	}
+	switch {
+	case p.inTransaction:
+		return p.tx.QueryRowContext(p.callCtx(), sqlstr, args...)
+	case p.conn != nil:
+		return p.conn.QueryRowContext(p.callCtx(), sqlstr, args...)
+	}
+	return p.db.QueryRowContext(p.callCtx(), sqlstr, args...)
+}
+
+// beginTx begins a transaction on the pinned connection, if any
+func (p *MyPlainKV) beginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if p.conn != nil {
+		return p.conn.BeginTx(ctx, opts)
+	}
+	return p.db.BeginTx(ctx, opts)
+}
+
+// Get retrieves a record using a key. A missing key reads as an empty
+// value, unless StrictNotFound is set.
 func (p *MyPlainKV) Get(key string) ([]byte, error) {
-	return p.get(p.currBuckt, key)
+	return p.getKey(p.currBuckt, key)
 }
 
-// Get retrieves a record using a key
+// GetMime gets the mime of the value stored. For a key without one, it
+// returns the default MIME type of the bucket along with ErrNoMime.
 func (p *MyPlainKV) GetMime(key string) (string, error) {
-	val, err := p.get(mimeBuckt, key)
-	if err != nil || len(val) == 0 {
-		return "text/html", err
+	return p.getMime(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) getMime(bucket, key string) (mime string, err error) {
+	var (
+		val sql.NullString
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return "", err
 	}
-	return string(val), nil
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if src, pats := p.shared().views.chain(bucket); pats != nil {
+		if !inView(key, pats) {
+			return p.defaultMime(src), ErrNoMime
+		}
+		bucket = src
+	}
+	sqlstr := `SELECT Mime FROM ` + p.defTableName + ` WHERE Bucket = ? AND KeyID = ? AND ` + notExpired + `;`
+	err = p.queryRow(sqlstr, bucket, key).Scan(&val)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if err == sql.ErrNoRows || !val.Valid || val.String == "" {
+		p.record(start, 0)
+		return p.defaultMime(bucket), ErrNoMime
+	}
+	p.record(start, 1)
+	return val.String, nil
 }
 
 // Set creates or updates the record by the value
 func (p *MyPlainKV) Set(key string, value []byte) error {
-	if p.currBuckt == "" {
-		p.currBuckt = "default"
-	}
 	if err := p.set(p.currBuckt, key, value); err != nil {
 		return err
 	}
 	return nil
 }
 
-// SetMime sets the mime of the value stored
+// SetMime sets the mime of the value stored. The MIME type is kept in
+// the record of the key, so the key must exist, or ErrKeyNotFound is
+// returned: set the value first. The MIME type is kept when the value
+// is set again, and deleted with the key or once it expires. An empty
+// mime clears it.
 func (p *MyPlainKV) SetMime(key string, mime string) error {
-	if err := p.set(mimeBuckt, key, []byte(mime)); err != nil {
+	return p.setMime(p.currBuckt, key, mime)
+}
+
+func (p *MyPlainKV) setMime(bucket, key, mime string) (err error) {
+	var (
+		val any
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
 		return err
 	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return ErrReadOnlyView
+	}
+	if len(mime) > maxMimeLen {
+		return ErrMimeTooLong
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return err
+	}
+	if mime != "" {
+		val = mime
+	}
+	sqlstr := `UPDATE ` + p.defTableName + ` SET Mime = ? WHERE Bucket = ? AND KeyID = ? AND ` + notExpired + `;`
+	res, err := p.exec(sqlstr, val, bucket, key)
+	if err != nil {
+		return err
+	}
+	ra, _ := res.RowsAffected()
+	if ra == 0 {
+		// Setting the MIME type a key already has affects no rows
+		ok, err := p.exists(bucket, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrKeyNotFound
+		}
+	}
+	p.record(start, ra)
 	return nil
 }
 
@@ -150,48 +417,129 @@ func (p *MyPlainKV) SetBucket(bucket string) {
 	p.currBuckt = bucket
 }
 
+// SetDefaultBucket sets the bucket used when no current bucket is set
+func (p *MyPlainKV) SetDefaultBucket(bucket string) {
+	p.defBuckt = bucket
+}
+
 // Del deletes a record with the provided key
 func (p *MyPlainKV) Del(key string) error {
-	var err error
+	return p.del(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) del(bucket, key string) (err error) {
+	var (
+		ra int64
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
 	if err = p.Open(); err != nil {
 		return err
 	}
 	if p.autoClose {
 		defer p.Close()
 	}
-	if p.currBuckt == "" {
-		p.currBuckt = "default"
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return ErrReadOnlyView
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return err
 	}
-	sqlstr := `DELETE FROM ` + p.defTableName + ` WHERE Bucket = ? AND KeyID = ?;`
 
-	if p.inTransaction {
-		if _, err = p.tx.Exec(sqlstr, p.currBuckt, key); err != nil {
-			return err
-		}
-		if _, err = p.tx.Exec(sqlstr, mimeBuckt, key); err != nil {
+	if p.RefDelete == RefCascade {
+		err = p.atomic(func() error {
+			keys, err := p.referrers(bucket, key)
+			if err != nil {
+				return err
+			}
+			for _, k := range append(keys, key) {
+				n, err := p.remove(bucket, k)
+				if err != nil {
+					return err
+				}
+				ra += n
+			}
+			return nil
+		})
+		if err != nil {
 			return err
 		}
+		p.record(start, ra)
 		return nil
 	}
 
-	if _, err = p.db.Exec(sqlstr, p.currBuckt, key); err != nil {
+	// The record and what is attached to it go together
+	err = p.atomic(func() error {
+		if p.RefDelete == RefBlock {
+			rr, err := p.linked(rrefBucket(bucket), key)
+			if err != nil {
+				return err
+			}
+			if len(rr) > 0 {
+				return ErrReferenced
+			}
+		}
+		n, err := p.remove(bucket, key)
+		ra = n
 		return err
-	}
-	if _, err = p.db.Exec(sqlstr, mimeBuckt, key); err != nil {
+	})
+	if err != nil {
 		return err
 	}
+	p.record(start, ra)
 	return nil
 }
 
-// ListKeys lists all keys containing the current pattern
+// remove deletes a record with everything attached to it
+// and returns the number of records deleted
+func (p *MyPlainKV) remove(bucket, key string) (int64, error) {
+	sqlstr := `DELETE FROM ` + p.defTableName + ` WHERE Bucket = ? AND KeyID = ?;`
+	res, err := p.exec(sqlstr, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	if err = p.detach(bucket, key); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// detach deletes the alias, chunks and references of a key. The parts
+// of a value are only looked for when it had a chunk manifest.
+func (p *MyPlainKV) detach(bucket, key string) error {
+	sqlstr := `DELETE FROM ` + p.defTableName + ` WHERE Bucket IN (?, ?) AND KeyID = ?;`
+	res, err := p.exec(sqlstr, aliasBucket(bucket), chunkBucket(bucket), key)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if err = p.dropParts(bucket, key); err != nil {
+			return err
+		}
+	}
+	return p.unlinkRefs(bucket, key)
+}
+
+// ListKeys lists the keys starting with the pattern. The pattern is
+// matched with LIKE, so % and _ in it are wildcards. ListKeysMatch
+// matches keys in other ways.
 func (p *MyPlainKV) ListKeys(pattern string) ([]string, error) {
+	return p.listKeys(p.currBuckt, pattern)
+}
+
+func (p *MyPlainKV) listKeys(bucket, pattern string) ([]string, error) {
+	return p.listKeysMatch(bucket, pattern, MatchPrefix)
+}
+
+func (p *MyPlainKV) listKeysMatch(bucket, pattern string, match KeyMatch) (val []string, err error) {
 	var (
-		err error
-		val []string
 		k   string
 		sqr *sql.Rows
 	)
 
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
 	val = make([]string, 0)
 	if err = p.Open(); err != nil {
 		return val, err
@@ -199,19 +547,14 @@ func (p *MyPlainKV) ListKeys(pattern string) ([]string, error) {
 	if p.autoClose {
 		defer p.Close()
 	}
-	if p.currBuckt == "" {
-		p.currBuckt = "default"
-	}
-	sqlstr := `SELECT KeyID FROM KeyValueTBL WHERE Bucket=? AND KeyID LIKE ?;`
-	if p.inTransaction {
-		sqr, err = p.tx.Query(sqlstr, p.currBuckt, pattern+"%")
-	} else {
-		sqr, err = p.db.Query(sqlstr, p.currBuckt, pattern+"%")
+	bucket = p.bucket(bucket)
+	if v := p.shared().views.get(bucket); v != nil {
+		return p.listView(v, match.like(pattern))
 	}
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return val, err
-		}
+	order := p.shared().orders.get(bucket)
+	sqlstr := `SELECT KeyID FROM ` + p.defTableName + ` WHERE Bucket=? AND KeyID LIKE ? AND ` + notExpired + orderBy(order) + `;`
+	if sqr, err = p.query(sqlstr, bucket, match.like(pattern)); err != nil {
+		return val, err
 	}
 	defer sqr.Close()
 	for sqr.Next() {
@@ -223,7 +566,46 @@ func (p *MyPlainKV) ListKeys(pattern string) ([]string, error) {
 	if err = sqr.Err(); err != nil {
 		return val, err
 	}
+	if order == OrderNatural {
+		sortNatural(val)
+	}
+	p.record(start, int64(len(val)))
+	return val, nil
+}
 
+// ListBuckets lists the buckets holding keys, leaving out the internal
+// buckets of aliases, chunks and other metadata
+func (p *MyPlainKV) ListBuckets() (val []string, err error) {
+	var (
+		b   string
+		sqr *sql.Rows
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	val = make([]string, 0)
+	if err = p.Open(); err != nil {
+		return val, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	sqlstr := `SELECT DISTINCT Bucket FROM ` + p.defTableName + `
+	WHERE Bucket NOT LIKE '--%' AND ` + notExpired + `
+	ORDER BY Bucket;`
+	if sqr, err = p.query(sqlstr); err != nil {
+		return val, err
+	}
+	defer sqr.Close()
+	for sqr.Next() {
+		if err = sqr.Scan(&b); err != nil {
+			return val, err
+		}
+		val = append(val, b)
+	}
+	if err = sqr.Err(); err != nil {
+		return val, err
+	}
+	p.record(start, int64(len(val)))
 	return val, nil
 }
 
@@ -231,59 +613,120 @@ func (p *MyPlainKV) ListKeys(pattern string) ([]string, error) {
 // To start with a pre-defined number, set the offset variable
 // It automatically creates new key if it does not exist
 func (p *MyPlainKV) Tally(key string, offset int) (int, error) {
+	return p.tally(p.currBuckt, key, offset)
+}
+
+// Incr increments the tally
+func (p *MyPlainKV) TallyIncr(key string) (int, error) {
+	return p.tallyIncr(p.currBuckt, key)
+}
+
+// Decr decrements the tally
+func (p *MyPlainKV) TallyDecr(key string) (int, error) {
+	return p.tallyDecr(p.currBuckt, key)
+}
+
+// TallyIncrBy adds delta to the tally and returns the new value
+func (p *MyPlainKV) TallyIncrBy(key string, delta int64) (int64, error) {
+	return p.tallyAdd(p.currBuckt, key, delta)
+}
+
+// TallyDecrBy subtracts delta from the tally and returns the new value
+func (p *MyPlainKV) TallyDecrBy(key string, delta int64) (int64, error) {
+	return p.tallyAdd(p.currBuckt, key, -delta)
+}
+
+// Reset resets tally to zero
+func (p *MyPlainKV) TallyReset(key string) error {
+	return p.tallyReset(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) tally(bucket, key string, offset int) (int, error) {
 	tk := fmt.Sprintf(tallyKey, key)
-	tlly, err := p.get(p.currBuckt, tk)
+	tlly, err := p.get(bucket, tk)
 	if err != nil {
 		return -1, err
 	}
 	if len(tlly) == 0 {
-		if err = p.set(p.currBuckt, tk, []byte(strconv.Itoa(offset))); err != nil {
+		// Another caller may create the tally first, so it is read again
+		// if this one loses
+		var ok bool
+		if ok, err = p.setNX(bucket, tk, []byte(strconv.Itoa(offset))); err != nil {
 			return -1, err
 		}
+		if !ok {
+			if tlly, err = p.get(bucket, tk); err != nil {
+				return -1, err
+			}
+		}
 	}
 	tv := string(tlly)
 	tvv, _ := strconv.Atoi(tv)
 	return tvv, nil
 }
 
-// Incr increments the tally
-func (p *MyPlainKV) TallyIncr(key string) (int, error) {
+func (p *MyPlainKV) tallyIncr(bucket, key string) (int, error) {
+	n, err := p.tallyAdd(bucket, key, 1)
+	return int(n), err
+}
 
-	tlly, err := p.Tally(key, 0)
-	if err != nil {
-		return tlly, err
+func (p *MyPlainKV) tallyDecr(bucket, key string) (int, error) {
+	n, err := p.tallyAdd(bucket, key, -1)
+	return int(n), err
+}
+
+// tallyAdd adds delta to the tally in a single statement and returns the
+// new value. A missing tally starts at zero. The new value of an existing
+// tally comes back as the insert ID, through LAST_INSERT_ID(expr).
+func (p *MyPlainKV) tallyAdd(bucket, key string, delta int64) (n int64, err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return -1, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return -1, ErrReadOnlyView
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return -1, err
 	}
 	tk := fmt.Sprintf(tallyKey, key)
-	if err = p.set(
-		p.currBuckt,
-		tk,
-		[]byte(strconv.Itoa(tlly+1))); err != nil {
-		return tlly, err
+	if len(tk) > 300 {
+		return -1, ErrKeyTooLong
 	}
-	return tlly + 1, nil
-}
+	p.shared().misses.forget(bucket, tk)
 
-// Decr decrements the tally
-func (p *MyPlainKV) TallyDecr(key string) (int, error) {
-	tlly, err := p.Tally(key, 0)
+	// An expired tally starts again from zero
+	sqlstr := `
+	INSERT INTO ` + p.defTableName + ` (Bucket, KeyID, Value) VALUES (?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		Value = LAST_INSERT_ID(IF(ExpiresAt <= NOW(6), 0, CAST(Value AS SIGNED)) + ?),
+		ExpiresAt = IF(ExpiresAt <= NOW(6), NULL, ExpiresAt),
+		Version = Version + 1;`
+	res, err := p.exec(sqlstr, bucket, tk, []byte(strconv.FormatInt(delta, 10)), delta)
 	if err != nil {
-		return tlly, err
+		return -1, err
 	}
-	tk := fmt.Sprintf(tallyKey, key)
-	if err = p.set(
-		p.currBuckt,
-		tk,
-		[]byte(strconv.Itoa(tlly-1))); err != nil {
-		return tlly, err
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
 	}
-	return tlly - 1, nil
+	p.record(start, ra)
+	if ra == 1 {
+		// Inserted
+		return delta, nil
+	}
+	return res.LastInsertId()
 }
 
-// Reset resets tally to zero
-func (p *MyPlainKV) TallyReset(key string) error {
+func (p *MyPlainKV) tallyReset(bucket, key string) error {
 	tk := fmt.Sprintf(tallyKey, key)
 	if err := p.set(
-		p.currBuckt,
+		bucket,
 		tk,
 		[]byte("0")); err != nil {
 		return err
@@ -291,43 +734,186 @@ func (p *MyPlainKV) TallyReset(key string) error {
 	return nil
 }
 
-// Open a connection to a MySQL database database
-func (p *MyPlainKV) Open() error {
+// LastResult returns the metadata of the last completed operation
+func (p *MyPlainKV) LastResult() Result {
+	p.resMu.Lock()
+	defer p.resMu.Unlock()
+	return p.lastRes
+}
+
+// noteErr keeps the last error met by an operation for debugging
+func (p *MyPlainKV) noteErr(err error) {
+	if err == nil {
+		return
+	}
+	p.resMu.Lock()
+	defer p.resMu.Unlock()
+	p.lastErr = err
+	p.lastErrAt = time.Now()
+}
+
+// record stores the result of an operation started at start
+func (p *MyPlainKV) record(start time.Time, rows int64) {
+	p.recordRetries(start, rows, 0)
+}
+
+// recordRetries stores the result of an operation started at start that
+// was retried the given number of times
+func (p *MyPlainKV) recordRetries(start time.Time, rows int64, retries int) {
+	p.resMu.Lock()
+	defer p.resMu.Unlock()
+	p.lastRes = Result{
+		RowsAffected: rows,
+		Duration:     time.Since(start),
+		Retries:      retries,
+	}
+}
+
+// Open a connection to a MySQL database database. It fails if the
+// server cannot be reached or the table cannot be created.
+func (p *MyPlainKV) Open() (err error) {
+	if p.sharedPool {
+		return p.openShared()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if p.db != nil {
 		return nil
 	}
-	var err error
 	p.inTransaction = false
-	p.db, err = sql.Open("mysql", p.DSN)
-	if err != nil {
+	if p.extDB != nil {
+		// The pool belongs to the application, settings and all
+		p.db = p.extDB
+	} else {
+		p.db, err = sql.Open("mysql", p.DSN)
+		if err != nil {
+			return err
+		}
+		// See "Important settings" section. database/sql takes negative
+		// settings as no limit, no idle connections and no expiry.
+		maxOpen, maxIdle, lifetime := p.MaxOpenConns, p.MaxIdleConns, p.ConnMaxLifetime
+		if maxOpen == 0 {
+			maxOpen = defMaxConns
+		}
+		if maxIdle == 0 {
+			maxIdle = defMaxConns
+		}
+		if lifetime == 0 {
+			lifetime = defConnMaxLifetime
+		}
+		p.db.SetConnMaxLifetime(lifetime)
+		p.db.SetMaxOpenConns(maxOpen)
+		p.db.SetMaxIdleConns(maxIdle)
+	}
+	// A store that cannot be used is not kept open
+	defer func() {
+		if err != nil {
+			if p.extDB == nil {
+				p.db.Close()
+			}
+			p.db = nil
+		}
+	}()
+
+	// sql.Open does not connect, so a bad DSN or an unreachable server
+	// would otherwise only show on the first operation
+	if err = p.db.PingContext(p.callCtx()); err != nil {
 		return err
 	}
-	// See "Important settings" section.
-	p.db.SetConnMaxLifetime(time.Minute * 3)
-	p.db.SetMaxOpenConns(10)
-	p.db.SetMaxIdleConns(10)
 
 	// Check if table exists and create it if not
-	p.db.Exec(
-		`CREATE TABLE IF NOT EXISTS KeyValueTBL (
-			Bucket VARCHAR(50),
-			KeyID VARCHAR(300),
-			Value MEDIUMBLOB,
-			PRIMARY KEY (Bucket, KeyID)
-		);`)
+	if p.SurrogateKey {
+		_, err = p.db.Exec(
+			`CREATE TABLE IF NOT EXISTS ` + p.defTableName + ` (
+				ID BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+				Bucket VARCHAR(50) NOT NULL,
+				KeyID VARCHAR(300) NOT NULL,
+				Value MEDIUMBLOB,
+				ExpiresAt DATETIME(6) NULL,
+				Version BIGINT UNSIGNED NOT NULL DEFAULT 1,
+				AccessedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				Mime VARCHAR(255) NULL,
+				CreatedAt DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				UpdatedAt DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+				PRIMARY KEY (ID),
+				UNIQUE KEY UX_BucketKeyID (Bucket, KeyID),
+				KEY IX_ExpiresAt (ExpiresAt),
+				KEY IX_BucketAccessedAt (Bucket, AccessedAt)
+			);`)
+	} else {
+		_, err = p.db.Exec(
+			`CREATE TABLE IF NOT EXISTS ` + p.defTableName + ` (
+				Bucket VARCHAR(50),
+				KeyID VARCHAR(300),
+				Value MEDIUMBLOB,
+				ExpiresAt DATETIME(6) NULL,
+				Version BIGINT UNSIGNED NOT NULL DEFAULT 1,
+				AccessedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				Mime VARCHAR(255) NULL,
+				CreatedAt DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				UpdatedAt DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+				PRIMARY KEY (Bucket, KeyID),
+				KEY IX_ExpiresAt (ExpiresAt),
+				KEY IX_BucketAccessedAt (Bucket, AccessedAt)
+			);`)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Refuse to work on a schema written by a newer library
+	if err = p.checkSchema(); err != nil {
+		return err
+	}
+	if p.ReverseKeys {
+		if err = p.reverseKeys(); err != nil {
+			return err
+		}
+	}
+	if p.RecencyIndex {
+		// Lets Query find recently written keys without a table scan
+		if err = p.alter(`ADD INDEX IX_BucketUpdatedAt (Bucket, UpdatedAt)`); err != nil {
+			return err
+		}
+	}
+	if p.BucketStats {
+		if err = p.bucketStats(); err != nil {
+			return err
+		}
+	}
+	if p.KeyStatsSample > 0 {
+		if err = p.keyStats(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // Begin a transaction
 func (p *MyPlainKV) Begin() error {
-	var err error
-	if p.tx, err = p.db.Begin(); err != nil {
+	return p.BeginCtx(p.callCtx())
+}
+
+// BeginCtx begins a transaction bound to ctx. If ctx is done before the
+// transaction is committed, the transaction is rolled back.
+func (p *MyPlainKV) BeginCtx(ctx context.Context) error {
+	tx, err := p.beginTx(ctx, nil)
+	if err != nil {
 		return err
 	}
-	p.inTransaction = true
+	p.setTx(tx)
 	return nil
 }
 
+// setTx records the transaction in progress, or that none is when tx is
+// nil. DebugState and the Ctx methods read it from other goroutines,
+// under mu.
+func (p *MyPlainKV) setTx(tx *sql.Tx) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tx, p.inTransaction = tx, tx != nil
+}
+
 // Commit transaction
 func (p *MyPlainKV) Commit() error {
 	if p.tx == nil {
@@ -336,7 +922,7 @@ func (p *MyPlainKV) Commit() error {
 	if err := p.tx.Commit(); err != nil {
 		return err
 	}
-	p.inTransaction = false
+	p.setTx(nil)
 	return nil
 }
 
@@ -348,18 +934,70 @@ func (p *MyPlainKV) Rollback() error {
 	if err := p.tx.Rollback(); err != nil {
 		return err
 	}
-	p.inTransaction = false
+	p.setTx(nil)
 	return nil
 }
 
-// Close closes the database
+// atomic runs fn in a transaction, committing if fn succeeds and rolling
+// back otherwise. If a transaction is already in progress, fn joins it
+// and committing is left to the caller.
+func (p *MyPlainKV) atomic(fn func() error) error {
+	var err error
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		// Keep the connection until the transaction completes
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	if p.inTransaction {
+		return fn()
+	}
+	if err = p.Begin(); err != nil {
+		return err
+	}
+	if err = fn(); err != nil {
+		p.Rollback()
+		return err
+	}
+	return p.Commit()
+}
+
+// Ping checks that the database can still be reached, opening the
+// connection if needed
+func (p *MyPlainKV) Ping() (err error) {
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	return p.db.PingContext(p.callCtx())
+}
+
+// Close closes the database. A session of a store that stays open only
+// lets go of the shared pool.
 func (p *MyPlainKV) Close() error {
-	if p.tx != nil {
-		p.tx = nil
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tx, p.inTransaction = nil, false
+	if p.sharedPool {
+		p.db = nil
+		return nil
 	}
 	if p.db == nil {
 		return nil
 	}
+	if p.extDB != nil {
+		// Closing the pool is left to the application
+		p.db = nil
+		return nil
+	}
 	if err := p.db.Close(); err != nil {
 		return err
 	}
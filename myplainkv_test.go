@@ -1,13 +1,35 @@
 package myplainkv
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+// testDSN returns the DSN of the database the tests run against, read
+// from PLAINKV_TEST_DSN. Tests needing a database are skipped without it.
+func testDSN(t testing.TB) string {
+	dsn := os.Getenv(`PLAINKV_TEST_DSN`)
+	if dsn == "" {
+		t.Skip(`PLAINKV_TEST_DSN is not set`)
+	}
+	return dsn
+}
+
 func TestOpen(t *testing.T) {
 
-	pkv := NewMyPlainKV("sample:password101@tcp(192.168.1.129)/kvdb", false)
+	pkv := NewMyPlainKV(testDSN(t), false)
 	if err := pkv.Open(); err != nil {
 		t.Logf(`%s`, err)
 		t.Fail()
@@ -37,7 +59,7 @@ func TestOpen(t *testing.T) {
 
 func TestOpenMime(t *testing.T) {
 
-	pkv := NewMyPlainKV("sample:password101@tcp(192.168.1.129)/kvdb", false)
+	pkv := NewMyPlainKV(testDSN(t), false)
 	if err := pkv.Open(); err != nil {
 		t.Logf(`%s`, err)
 		t.Fail()
@@ -69,7 +91,7 @@ func TestOpenMime(t *testing.T) {
 
 func TestOpenListKeys(t *testing.T) {
 
-	pkv := NewMyPlainKV("sample:password101@tcp(192.168.1.129)/kvdb", false)
+	pkv := NewMyPlainKV(testDSN(t), false)
 	if err := pkv.Open(); err != nil {
 		t.Logf(`%s`, err)
 		t.Fail()
@@ -95,7 +117,7 @@ func TestOpenListKeys(t *testing.T) {
 }
 
 func TestIncrement(t *testing.T) {
-	pkv := NewMyPlainKV("sample:password101@tcp(192.168.1.129)/kvdb", false)
+	pkv := NewMyPlainKV(testDSN(t), false)
 	if err := pkv.Open(); err != nil {
 		t.Logf(`%s`, err)
 		t.Fail()
@@ -122,7 +144,7 @@ func TestIncrement(t *testing.T) {
 }
 
 func TestDecrement(t *testing.T) {
-	pkv := NewMyPlainKV("sample:password101@tcp(192.168.1.129)/kvdb", false)
+	pkv := NewMyPlainKV(testDSN(t), false)
 	if err := pkv.Open(); err != nil {
 		t.Logf(`%s`, err)
 		t.Fail()
@@ -150,7 +172,7 @@ func TestDecrement(t *testing.T) {
 
 func BenchmarkPerformance(b *testing.B) {
 
-	pkv := NewMyPlainKV("sample:password101@tcp(192.168.1.129)/kvdb", false)
+	pkv := NewMyPlainKV(testDSN(b), false)
 	if err := pkv.Open(); err != nil {
 		b.Logf(`%s`, err)
 		b.Fail()
@@ -165,3 +187,1459 @@ func BenchmarkPerformance(b *testing.B) {
 
 	pkv.Close()
 }
+
+func TestLastResult(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	if err := pkv.Set(`sample_key`, []byte(`Sample value`)); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	res := pkv.LastResult()
+	if res.RowsAffected == 0 {
+		t.Logf(`Expected rows affected, got %d`, res.RowsAffected)
+		t.Fail()
+	}
+	t.Logf(`Set affected %d row(s) in %s`, res.RowsAffected, res.Duration)
+
+	if err := pkv.Del(`sample_key`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func TestMaintenance(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	if err := pkv.SetMaintenance(true, `upgrading`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	err := pkv.Set(`sample_key`, []byte(`Sample value`))
+	if !errors.Is(err, ErrMaintenance) {
+		t.Logf(`Expected ErrMaintenance, got %v`, err)
+		t.Fail()
+	}
+	t.Logf(`Set rejected: %s`, err)
+
+	if err := pkv.SetMaintenance(false, ``); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	on, _, err := pkv.InMaintenance()
+	if err != nil || on {
+		t.Logf(`Expected maintenance off, got %v (%v)`, on, err)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func BenchmarkGetInto(b *testing.B) {
+
+	pkv := NewMyPlainKV(testDSN(b), false)
+	if err := pkv.Open(); err != nil {
+		b.Logf(`%s`, err)
+		b.Fail()
+	}
+
+	if err := pkv.Set(`sample_key`, []byte(`Sample value`)); err != nil {
+		b.Logf(`%s`, err)
+		b.Fail()
+	}
+
+	var (
+		buf []byte
+		err error
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if buf, err = pkv.GetInto(`sample_key`, buf[:0]); err != nil {
+			b.Logf(`%s`, err)
+			b.Fail()
+		}
+	}
+
+	pkv.Close()
+}
+
+func TestBucketView(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	sess := pkv.In(`sessions`)
+	if err := sess.Set(`sample_key`, []byte(`Session value`)); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	// The view must not leak into the parent's current bucket
+	b, err := pkv.Get(`sample_key`)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if string(b) == `Session value` {
+		t.Logf(`Value of bucket %s read from the default bucket`, sess.Name())
+		t.Fail()
+	}
+
+	if err := sess.Del(`sample_key`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func TestAlias(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	if err := pkv.Set(`sample_key`, []byte(`Sample value`)); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if err := pkv.Alias(`sample_latest`, `sample_key`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b, err := pkv.Get(`sample_latest`)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if string(b) != `Sample value` {
+		t.Logf(`Expected the value of the target, got %s`, b)
+		t.Fail()
+	}
+
+	if err := pkv.Alias(`sample_key`, `sample_latest`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if _, err := pkv.ResolveAlias(`sample_latest`); !errors.Is(err, ErrAliasLoop) {
+		t.Logf(`Expected ErrAliasLoop, got %v`, err)
+		t.Fail()
+	}
+
+	if err := pkv.Del(`sample_key`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	pkv.Del(`sample_latest`)
+	pkv.Close()
+}
+
+func TestPublish(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	first, err := pkv.Publish(`sample_config`, []byte(`v1`))
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if _, err = pkv.Publish(`sample_config`, []byte(`v2`)); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	if err = pkv.PromoteRev(`sample_config`, first); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b, err := pkv.GetLatest(`sample_config`)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if string(b) != `v1` {
+		t.Logf(`Expected v1 after rollback, got %s`, b)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func TestChunkOversized(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	pkv.ChunkOversized = true
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	val := make([]byte, 20<<20)
+	for i := range val {
+		val[i] = byte(i)
+	}
+	if err := pkv.Set(`sample_large`, val); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b, err := pkv.Get(`sample_large`)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if len(b) != len(val) {
+		t.Logf(`Expected %d bytes, got %d`, len(val), len(b))
+		t.Fail()
+	}
+
+	if err = pkv.Del(`sample_large`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func TestSplitKeyspace(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b := pkv.Bucket(`sample_split`)
+	for i := 0; i < 100; i++ {
+		if err := b.Set(`key`+strconv.Itoa(i), []byte(strconv.Itoa(i))); err != nil {
+			t.Logf(`%s`, err)
+			t.Fail()
+		}
+	}
+
+	rngs, err := pkv.SplitKeyspace(`sample_split`, 4)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	seen := 0
+	for _, r := range rngs {
+		err = pkv.ScanRange(r, func(key string, value []byte) error {
+			seen++
+			return b.Del(key)
+		})
+		if err != nil {
+			t.Logf(`%s`, err)
+			t.Fail()
+		}
+	}
+	if seen != 100 {
+		t.Logf(`Expected 100 keys across %d ranges, got %d`, len(rngs), seen)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func TestRefCascade(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	pkv.RefDelete = RefCascade
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Set(`sample_order`, []byte(`order`))
+	pkv.Set(`sample_line`, []byte(`line`))
+	if err := pkv.AddRef(`sample_line`, `sample_order`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	refs, err := pkv.ReverseRefs(`sample_order`)
+	if err != nil || len(refs) != 1 {
+		t.Logf(`Expected one reverse reference, got %v (%v)`, refs, err)
+		t.Fail()
+	}
+
+	if err = pkv.Del(`sample_order`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	b, _ := pkv.Get(`sample_line`)
+	if len(b) != 0 {
+		t.Logf(`Expected the referencing key to be deleted, got %s`, b)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func TestBucketStats(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	pkv.BucketStats = true
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.SetBucket(`statstest`)
+	before, err := pkv.Count()
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	pkv.Set(`stats_key`, []byte(`12345`))
+	after, _ := pkv.Count()
+	if after != before+1 {
+		t.Logf(`Expected count %d, got %d`, before+1, after)
+		t.Fail()
+	}
+	pkv.Del(`stats_key`)
+
+	pkv.Close()
+}
+
+func TestTTL(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	if err := pkv.SetWithTTL(`sample_ttl`, []byte(`short lived`), time.Second); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if d, _ := pkv.TTL(`sample_ttl`); d <= 0 || d > time.Second {
+		t.Logf(`Expected a TTL up to a second, got %s`, d)
+		t.Fail()
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if b, _ := pkv.Get(`sample_ttl`); len(b) != 0 {
+		t.Logf(`Expected the key to have expired, got %s`, b)
+		t.Fail()
+	}
+
+	pkv.SetWithTTL(`sample_ttl`, []byte(`kept`), time.Second)
+	if ok, _ := pkv.Persist(`sample_ttl`); !ok {
+		t.Logf(`Expected Persist to remove the expiry`)
+		t.Fail()
+	}
+	if d, _ := pkv.TTL(`sample_ttl`); d != TTLNone {
+		t.Logf(`Expected no TTL, got %s`, d)
+		t.Fail()
+	}
+	pkv.Del(`sample_ttl`)
+
+	pkv.Close()
+}
+
+func TestEraseSubject(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	if _, err := pkv.EraseSubject(`u42`); !errors.Is(err, ErrNoErasureKey) {
+		t.Logf(`Expected ErrNoErasureKey without a secret, got %v`, err)
+		t.Fail()
+	}
+	pkv.ErasureSecret = []byte(`sample secret`)
+	pkv.RegisterSubjectKeys(``, `profile/{subject}`)
+	pkv.RegisterSubjectKeys(`orders`, `{subject}/%`)
+	pkv.Set(`profile/u42`, []byte(`{"name":"sample"}`))
+	pkv.In(`orders`).Set(`u42/1`, []byte(`order`))
+	pkv.In(`orders`).Set(`u421/1`, []byte(`other order`))
+
+	rep, err := pkv.EraseSubject(`u42`)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if rep.Count != 2 {
+		t.Logf(`Expected 2 keys erased, got %d: %v`, rep.Count, rep.Keys)
+		t.Fail()
+	}
+	if b, _ := pkv.In(`orders`).Get(`u421/1`); len(b) == 0 {
+		t.Logf(`Expected the keys of another subject to be kept`)
+		t.Fail()
+	}
+	if _, ok, _ := pkv.ErasureProof(`u42`); !ok {
+		t.Logf(`Expected a proof of erasure`)
+		t.Fail()
+	}
+	sum := sha256.Sum256([]byte(`u42`))
+	if rep.SubjectHash == hex.EncodeToString(sum[:]) {
+		t.Logf(`Expected the subject hash to be keyed`)
+		t.Fail()
+	}
+	pkv.In(`orders`).Del(`u421/1`)
+
+	pkv.Close()
+}
+
+func TestMSetMGetMDel(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	vals := make(map[string][]byte)
+	keys := make([]string, 0)
+	for i := 0; i < 1200; i++ {
+		k := `sample_batch_` + strconv.Itoa(i)
+		vals[k] = []byte(strconv.Itoa(i))
+		keys = append(keys, k)
+	}
+	if err := pkv.MSet(vals); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	got, err := pkv.MGet(append(keys, `sample_batch_missing`))
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if len(got) != len(vals) {
+		t.Logf(`Expected %d values, got %d`, len(vals), len(got))
+		t.Fail()
+	}
+	if string(got[`sample_batch_7`]) != `7` {
+		t.Logf(`Expected 7, got %s`, got[`sample_batch_7`])
+		t.Fail()
+	}
+	if err = pkv.MDel(keys); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if got, _ = pkv.MGet(keys); len(got) != 0 {
+		t.Logf(`Expected no values after MDel, got %d`, len(got))
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func TestSetNX(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Del(`sample_nx`)
+	if ok, err := pkv.SetNX(`sample_nx`, []byte(`first`)); !ok || err != nil {
+		t.Logf(`Expected the first SetNX to succeed (%v)`, err)
+		t.Fail()
+	}
+	if ok, _ := pkv.SetNX(`sample_nx`, []byte(`second`)); ok {
+		t.Logf(`Expected the second SetNX to fail`)
+		t.Fail()
+	}
+	if b, _ := pkv.Get(`sample_nx`); string(b) != `first` {
+		t.Logf(`Expected first, got %s`, b)
+		t.Fail()
+	}
+	pkv.Del(`sample_nx`)
+
+	pkv.Close()
+}
+
+func TestSetIfVersion(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Set(`sample_cas`, []byte(`v1`))
+	_, ver, err := pkv.GetWithVersion(`sample_cas`)
+	if err != nil || ver == 0 {
+		t.Logf(`Expected a version, got %d (%v)`, ver, err)
+		t.Fail()
+	}
+	if err = pkv.SetIfVersion(`sample_cas`, []byte(`v2`), ver); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if err = pkv.SetIfVersion(`sample_cas`, []byte(`v3`), ver); !errors.Is(err, ErrVersionConflict) {
+		t.Logf(`Expected a version conflict, got %v`, err)
+		t.Fail()
+	}
+	pkv.Del(`sample_cas`)
+
+	pkv.Close()
+}
+
+func TestAcquireConn(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	c, err := pkv.AcquireConn(context.Background())
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.FailNow()
+	}
+	var id1, id2 int64
+	c.queryRow(`SELECT CONNECTION_ID();`).Scan(&id1)
+	c.Set(`sample_conn`, []byte(`pinned`))
+	c.queryRow(`SELECT CONNECTION_ID();`).Scan(&id2)
+	if id1 != id2 {
+		t.Logf(`Expected one session, got %d and %d`, id1, id2)
+		t.Fail()
+	}
+	// Views registered on the store are seen through the handle
+	pkv.CreateView(`sample_conn_view`, ``, `sample_conn`, nil)
+	defer pkv.DropView(`sample_conn_view`)
+	c.SetBucket(`sample_conn_view`)
+	if val, err := c.Get(`sample_conn`); err != nil || string(val) != `pinned` {
+		t.Logf(`Expected the view to read the key, got %q (%v)`, val, err)
+		t.Fail()
+	}
+	if err = c.Set(`sample_conn`, []byte(`x`)); err != ErrReadOnlyView {
+		t.Logf(`Expected writes to the view to fail, got %v`, err)
+		t.Fail()
+	}
+	c.SetBucket(``)
+	c.Del(`sample_conn`)
+	c.Close()
+
+	pkv.Close()
+}
+
+func TestWithAdvisoryLock(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	other := NewMyPlainKV(testDSN(t), false)
+	err := pkv.WithAdvisoryLock(`sample_lock`, time.Second, func() error {
+		// A second session cannot take the lock while it is held
+		return other.WithAdvisoryLock(`sample_lock`, 0, func() error { return nil })
+	})
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Logf(`Expected a lock timeout, got %v`, err)
+		t.Fail()
+	}
+	if err = other.WithAdvisoryLock(`sample_lock`, time.Second, func() error { return nil }); err != nil {
+		t.Logf(`Expected the lock to be released, got %v`, err)
+		t.Fail()
+	}
+
+	other.Close()
+	pkv.Close()
+}
+
+func TestRateLimiter(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	rl := NewRateLimiter(pkv)
+	rl.FailClosed = true
+
+	key := `sample_user_` + strconv.FormatInt(time.Now().UnixNano(), 10)
+	for i := 0; i < 3; i++ {
+		if !rl.Allow(key, 3, time.Minute) {
+			t.Logf(`Expected request %d to be allowed (%v)`, i, rl.Err())
+			t.Fail()
+		}
+	}
+	if rl.Allow(key, 3, time.Minute) {
+		t.Logf(`Expected the fourth request to be denied`)
+		t.Fail()
+	}
+
+	// Concurrent requests still only let the limit through
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	key += `_concurrent`
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rl.Allow(key, 5, time.Minute) {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Logf(`Expected 5 of 20 concurrent requests to be allowed, got %d (%v)`, allowed, rl.Err())
+		t.Fail()
+	}
+	rl.Close()
+
+	// Counters expire when due and keep counting during maintenance
+	pkv.TTLJitter = 0.9
+	rl = NewRateLimiter(pkv)
+	defer rl.Close()
+	if err := pkv.SetMaintenance(true, `upgrading`); err != nil {
+		t.Fatal(err)
+	}
+	defer pkv.SetMaintenance(false, "")
+	s := rl.kv.Session()
+	defer s.Close()
+	key += `_maintenance`
+	now := time.Now()
+	if ok, err := allow(s, key, 3, time.Minute, now); !ok || err != nil {
+		t.Logf(`Expected the request to be counted during maintenance, got %v (%v)`, ok, err)
+		t.Fail()
+	}
+	idx := strconv.FormatInt(now.UnixNano()/int64(time.Minute), 10)
+	if d, err := s.ttl(rateBuckt, fmt.Sprintf(tallyKey, key+`#`+idx)); err != nil || d < 119*time.Second {
+		t.Logf(`Expected the counter to expire in two windows, got %s (%v)`, d, err)
+		t.Fail()
+	}
+}
+
+func TestPutGetReader(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.ChunkOversized = true
+	payload := bytes.Repeat([]byte(`0123456789`), 250000) // spans three parts
+	if err := pkv.PutReader(`sample_stream`, bytes.NewReader(payload)); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	rc, err := pkv.GetReader(`sample_stream`)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.FailNow()
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Logf(`Expected the payload back, got %d bytes (%v)`, len(got), err)
+		t.Fail()
+	}
+	pkv.Del(`sample_stream`)
+
+	// Without chunking, a payload must fit a single row
+	pkv.ChunkOversized = false
+	big := io.LimitReader(zeroReader{}, int64(maxValueLen)+1)
+	if err := pkv.PutReader(`sample_stream`, big); !errors.Is(err, ErrValueTooLong) {
+		t.Logf(`Expected ErrValueTooLong, got %v`, err)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+// zeroReader reads endless zeros
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+func TestExists(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Set(`sample_exists`, []byte(`here`))
+	pkv.Alias(`sample_exists_alias`, `sample_exists`)
+	for _, k := range []string{`sample_exists`, `sample_exists_alias`} {
+		if ok, err := pkv.Exists(k); !ok || err != nil {
+			t.Logf(`Expected %s to exist (%v)`, k, err)
+			t.Fail()
+		}
+	}
+	pkv.Del(`sample_exists`)
+	if ok, _ := pkv.Exists(`sample_exists_alias`); ok {
+		t.Logf(`Expected a dangling alias not to exist`)
+		t.Fail()
+	}
+	pkv.Del(`sample_exists_alias`)
+
+	pkv.Close()
+}
+
+func TestRegisterUpgrader(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.In(`upgradetest`).Set(`sample_legacy`, []byte(`plain`))
+	pkv.RegisterUpgrader(`upgradetest`, func(old []byte) ([]byte, bool) {
+		if bytes.HasPrefix(old, []byte(`v2:`)) {
+			return old, false
+		}
+		return append([]byte(`v2:`), old...), true
+	})
+	b, _ := pkv.In(`upgradetest`).Get(`sample_legacy`)
+	if string(b) != `v2:plain` {
+		t.Logf(`Expected v2:plain, got %s`, b)
+		t.Fail()
+	}
+
+	pkv.RegisterUpgrader(`upgradetest`, nil)
+	b, _ = pkv.In(`upgradetest`).Get(`sample_legacy`)
+	if string(b) != `v2:plain` {
+		t.Logf(`Expected the upgraded value to be written back, got %s`, b)
+		t.Fail()
+	}
+
+	// Upgrading a value keeps its expiry
+	pkv.In(`upgradetest`).SetWithTTL(`sample_legacy_ttl`, []byte(`plain`), time.Hour)
+	pkv.RegisterUpgrader(`upgradetest`, func(old []byte) ([]byte, bool) {
+		if bytes.HasPrefix(old, []byte(`v3:`)) {
+			return old, false
+		}
+		return append([]byte(`v3:`), old...), true
+	})
+	if b, _ = pkv.In(`upgradetest`).Get(`sample_legacy_ttl`); string(b) != `v3:plain` {
+		t.Logf(`Expected v3:plain, got %s`, b)
+		t.Fail()
+	}
+	if d, err := pkv.ttl(`upgradetest`, `sample_legacy_ttl`); err != nil || d <= 0 || d > time.Hour {
+		t.Logf(`Expected the upgraded key to keep its TTL, got %s (%v)`, d, err)
+		t.Fail()
+	}
+
+	// Streamed reads are upgraded too
+	pkv.In(`upgradetest`).Set(`sample_legacy_stream`, []byte(`plain`))
+	var w bytes.Buffer
+	if _, err := pkv.In(`upgradetest`).GetTo(`sample_legacy_stream`, &w); err != nil || w.String() != `v3:plain` {
+		t.Logf(`Expected GetTo to write v3:plain, got %s (%v)`, w.String(), err)
+		t.Fail()
+	}
+	pkv.In(`upgradetest`).Set(`sample_legacy_stream`, []byte(`plain`))
+	if rc, err := pkv.In(`upgradetest`).GetReader(`sample_legacy_stream`); err == nil {
+		b, _ = io.ReadAll(rc)
+		rc.Close()
+		if string(b) != `v3:plain` {
+			t.Logf(`Expected GetReader to read v3:plain, got %s`, b)
+			t.Fail()
+		}
+	}
+	pkv.In(`upgradetest`).Del(`sample_legacy_stream`)
+	pkv.RegisterUpgrader(`upgradetest`, nil)
+	pkv.In(`upgradetest`).Del(`sample_legacy`)
+	pkv.In(`upgradetest`).Del(`sample_legacy_ttl`)
+
+	pkv.Close()
+}
+
+func TestSize(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Set(`sample_size`, []byte(`12345`))
+	if n, err := pkv.Size(`sample_size`); n != 5 || err != nil {
+		t.Logf(`Expected size 5, got %d (%v)`, n, err)
+		t.Fail()
+	}
+	payload := bytes.Repeat([]byte(`x`), 3<<20)
+	pkv.PutReader(`sample_size`, bytes.NewReader(payload))
+	if n, _ := pkv.Size(`sample_size`); n != int64(len(payload)) {
+		t.Logf(`Expected size %d for a chunked value, got %d`, len(payload), n)
+		t.Fail()
+	}
+	pkv.Del(`sample_size`)
+
+	pkv.Close()
+}
+
+func TestEvictIdle(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	pkv.AccessResolution = time.Millisecond
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Set(`sample_idle_read`, []byte(`read`))
+	pkv.Set(`sample_idle_written`, []byte(`written`))
+	time.Sleep(2 * time.Second)
+	pkv.Get(`sample_idle_read`)
+	pkv.Set(`sample_idle_written`, []byte(`rewritten`))
+	if n, err := pkv.EvictIdle(time.Second); n < 1 || err != nil {
+		t.Logf(`Expected the rewritten key to be evicted, got %d (%v)`, n, err)
+		t.Fail()
+	}
+	if ok, _ := pkv.Exists(`sample_idle_written`); ok {
+		t.Logf(`Expected the rewritten key to be gone`)
+		t.Fail()
+	}
+	if ok, _ := pkv.Exists(`sample_idle_read`); !ok {
+		t.Logf(`Expected the read key to be kept`)
+		t.Fail()
+	}
+	pkv.Del(`sample_idle_read`)
+
+	pkv.Close()
+}
+
+func TestExportImport(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b := pkv.Bucket(`sample_export`)
+	b.Set(`page`, []byte(`<p>hi</p>`))
+	b.SetMime(`page`, `text/plain`)
+	b.Set(`data`, []byte{0, 1, 2})
+	var buf bytes.Buffer
+	if err := pkv.Export(&buf, `sample_export`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	b.MDel([]string{`page`, `data`})
+	if err := pkv.Import(&buf); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if v, _ := b.Get(`data`); !bytes.Equal(v, []byte{0, 1, 2}) {
+		t.Logf(`Expected the binary value to round-trip, got %v`, v)
+		t.Fail()
+	}
+	if m, _ := b.GetMime(`page`); m != `text/plain` {
+		t.Logf(`Expected the MIME type to round-trip, got %s`, m)
+		t.Fail()
+	}
+	b.MDel([]string{`page`, `data`})
+
+	pkv.Close()
+}
+
+func TestNewTx(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	tx1, err := pkv.NewTx(context.Background())
+	if err != nil {
+		t.Fatalf(`%s`, err)
+	}
+	tx2, err := pkv.NewTx(context.Background())
+	if err != nil {
+		t.Fatalf(`%s`, err)
+	}
+	tx1.Set(`sample_tx1`, []byte(`kept`))
+	tx2.Set(`sample_tx2`, []byte(`dropped`))
+	if ok, _ := pkv.Exists(`sample_tx1`); ok {
+		t.Logf(`Expected an uncommitted write to be invisible to the store`)
+		t.Fail()
+	}
+	if err = tx1.Commit(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	tx2.Rollback()
+	if ok, _ := pkv.Exists(`sample_tx1`); !ok {
+		t.Logf(`Expected the committed write to be kept`)
+		t.Fail()
+	}
+	if ok, _ := pkv.Exists(`sample_tx2`); ok {
+		t.Logf(`Expected the rolled back write to be dropped`)
+		t.Fail()
+	}
+	pkv.Del(`sample_tx1`)
+
+	pkv.Close()
+}
+
+func TestWithTransaction(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	fail := errors.New(`fail`)
+	err := pkv.WithTransaction(context.Background(), func(tx *Tx) error {
+		tx.Set(`sample_withtx`, []byte(`dropped`))
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Logf(`Expected the error of fn, got %v`, err)
+		t.Fail()
+	}
+	if ok, _ := pkv.Exists(`sample_withtx`); ok {
+		t.Logf(`Expected the write to be rolled back`)
+		t.Fail()
+	}
+	err = pkv.WithTransaction(context.Background(), func(tx *Tx) error {
+		return tx.Set(`sample_withtx`, []byte(`kept`))
+	})
+	if ok, _ := pkv.Exists(`sample_withtx`); err != nil || !ok {
+		t.Logf(`Expected the write to be committed (%v)`, err)
+		t.Fail()
+	}
+	pkv.Del(`sample_withtx`)
+
+	pkv.Close()
+}
+
+func TestGetMimeDefault(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b := pkv.Bucket(`sample_mime`)
+	b.Set(`page`, []byte(`<p>hi</p>`))
+	if mt, err := b.GetMime(`page`); mt != DefaultMime || !errors.Is(err, ErrNoMime) {
+		t.Logf(`Expected %s and ErrNoMime, got %s (%v)`, DefaultMime, mt, err)
+		t.Fail()
+	}
+	b.SetDefaultMime(`text/html`)
+	if mt, _ := b.GetMime(`page`); mt != `text/html` {
+		t.Logf(`Expected the bucket default, got %s`, mt)
+		t.Fail()
+	}
+	b.Del(`page`)
+
+	pkv.Close()
+}
+
+func TestSavepoint(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	if err := pkv.Savepoint(`outside`); err != ErrNoTransaction {
+		t.Logf(`Expected ErrNoTransaction, got %v`, err)
+		t.Fail()
+	}
+	err := pkv.WithTransaction(context.Background(), func(tx *Tx) error {
+		tx.Set(`sample_sp1`, []byte(`kept`))
+		if err := tx.Savepoint(`step`); err != nil {
+			return err
+		}
+		tx.Set(`sample_sp2`, []byte(`undone`))
+		if err := tx.Savepoint(`bad name`); err != ErrInvalidSavepoint {
+			t.Logf(`Expected ErrInvalidSavepoint, got %v`, err)
+			t.Fail()
+		}
+		return tx.RollbackTo(`step`)
+	})
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if ok, _ := pkv.Exists(`sample_sp1`); !ok {
+		t.Logf(`Expected the write before the savepoint to be kept`)
+		t.Fail()
+	}
+	if ok, _ := pkv.Exists(`sample_sp2`); ok {
+		t.Logf(`Expected the write after the savepoint to be undone`)
+		t.Fail()
+	}
+	pkv.Del(`sample_sp1`)
+
+	pkv.Close()
+}
+
+func TestTallyMany(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.TallyReset(`sample_views`)
+	vals, err := pkv.TallyIncrMany(map[string]int64{`sample_views`: 3, `sample_clicks`: 1})
+	if err != nil || vals[`sample_views`] != 3 || vals[`sample_clicks`] != 1 {
+		t.Logf(`Expected 3 views and 1 click, got %v (%v)`, vals, err)
+		t.Fail()
+	}
+	pkv.TallyIncrMany(map[string]int64{`sample_views`: 2})
+	vals, err = pkv.TallyGetMany([]string{`sample_views`, `sample_missing`})
+	if err != nil || vals[`sample_views`] != 5 || vals[`sample_missing`] != 0 {
+		t.Logf(`Expected 5 views and no missing tally, got %v (%v)`, vals, err)
+		t.Fail()
+	}
+	pkv.TallyReset(`sample_views`)
+	pkv.TallyReset(`sample_clicks`)
+
+	pkv.Close()
+}
+
+func TestStrictNotFound(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b := pkv.Bucket(`sample_strict`)
+	b.Del(`missing`)
+	if _, err := b.Get(`missing`); err != nil {
+		t.Logf(`Expected no error without StrictNotFound, got %v`, err)
+		t.Fail()
+	}
+	pkv.StrictNotFound = true
+	if _, err := b.Get(`missing`); !errors.Is(err, ErrKeyNotFound) {
+		t.Logf(`Expected ErrKeyNotFound, got %v`, err)
+		t.Fail()
+	}
+	if _, err := b.GetInto(`missing`, nil); !errors.Is(err, ErrKeyNotFound) {
+		t.Logf(`Expected ErrKeyNotFound from GetInto, got %v`, err)
+		t.Fail()
+	}
+	b.Set(`empty`, []byte{})
+	if val, err := b.Get(`empty`); err != nil || len(val) != 0 {
+		t.Logf(`Expected an empty value, got %q (%v)`, val, err)
+		t.Fail()
+	}
+	b.Del(`empty`)
+
+	pkv.Close()
+}
+
+func TestTallyIncrBounded(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.TallyReset(`sample_stock`)
+	if n, err := pkv.TallyIncrBounded(`sample_stock`, 5, 0, 10); err != nil || n != 5 {
+		t.Logf(`Expected 5, got %d (%v)`, n, err)
+		t.Fail()
+	}
+	if _, err := pkv.TallyIncrBounded(`sample_stock`, -6, 0, 10); !errors.Is(err, ErrTallyBound) {
+		t.Logf(`Expected ErrTallyBound below the floor, got %v`, err)
+		t.Fail()
+	}
+	if _, err := pkv.TallyIncrBounded(`sample_stock`, 6, 0, 10); !errors.Is(err, ErrTallyBound) {
+		t.Logf(`Expected ErrTallyBound above the ceiling, got %v`, err)
+		t.Fail()
+	}
+	if n, err := pkv.TallyIncrBounded(`sample_stock`, -5, 0, 10); err != nil || n != 0 {
+		t.Logf(`Expected 0, got %d (%v)`, n, err)
+		t.Fail()
+	}
+	pkv.TallyReset(`sample_stock`)
+
+	pkv.Close()
+}
+
+func TestOpenUnreachable(t *testing.T) {
+	pkv := NewMyPlainKV("sample:password101@tcp(127.0.0.1:1)/kvdb", false)
+	if err := pkv.Open(); err == nil {
+		t.Logf(`Expected Open to fail on an unreachable server`)
+		t.Fail()
+	}
+	if err := pkv.Ping(); err == nil {
+		t.Logf(`Expected Ping to fail on an unreachable server`)
+		t.Fail()
+	}
+}
+
+func TestTallyDelta(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b := pkv.Bucket(`sample_report`)
+	b.TallyReset(`views_home`)
+	b.TallyIncrBy(`views_home`, 3)
+	from, err := b.TallySnapshot(`views_`)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	// Snapshots are named to the second
+	time.Sleep(time.Second)
+	b.TallyIncrBy(`views_home`, 4)
+	b.TallyIncrBy(`views_about`, 2)
+	to, _ := b.TallySnapshot(`views_`)
+	delta, err := b.TallyDelta(`views_`, from, to)
+	if err != nil || delta[`views_home`] != 4 || delta[`views_about`] != 2 {
+		t.Logf(`Expected 4 home and 2 about views, got %v (%v)`, delta, err)
+		t.Fail()
+	}
+	b.DropTallySnapshot(from)
+	b.DropTallySnapshot(to)
+	b.TallyReset(`views_home`)
+	b.TallyReset(`views_about`)
+
+	pkv.Close()
+}
+
+func TestKeyStats(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	pkv.KeyStatsSample = 1
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b := pkv.Bucket(`sample_keystats`)
+	before, _ := b.KeyStats(`banner`)
+	b.Set(`banner`, []byte(`hello`))
+	b.Get(`banner`)
+	b.Get(`banner`)
+	ks, err := b.KeyStats(`banner`)
+	if err != nil || ks.Reads-before.Reads != 2 || ks.Writes-before.Writes != 1 || ks.LastRead.IsZero() {
+		t.Logf(`Expected 2 more reads and 1 more write, got %+v (%v)`, ks, err)
+		t.Fail()
+	}
+	b.Del(`banner`)
+
+	pkv.Close()
+}
+
+func TestKeysEqual(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b := pkv.Bucket(`sample_match`)
+	b.Set(`user_1`, []byte(`a`))
+	b.Set(`userX1`, []byte(`b`))
+	if keys, err := b.KeysEqual(`user_1`); err != nil || len(keys) != 1 || keys[0] != `user_1` {
+		t.Logf(`Expected only user_1, got %v (%v)`, keys, err)
+		t.Fail()
+	}
+	if keys, err := b.ListAllKeys(); err != nil || len(keys) != 2 {
+		t.Logf(`Expected 2 keys, got %v (%v)`, keys, err)
+		t.Fail()
+	}
+	b.Del(`user_1`)
+	b.Del(`userX1`)
+
+	pkv.Close()
+}
+
+func TestNewFromDB(t *testing.T) {
+	db, err := sql.Open(`mysql`, "sample:password101@tcp(127.0.0.1:1)/kvdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	pkv := NewFromDB(db)
+	if err := pkv.Open(); err == nil {
+		t.Logf(`Expected Open to fail on an unreachable server`)
+		t.Fail()
+	}
+	pkv.Close()
+	// The pool of the application must still be usable
+	if err := db.Ping(); err != nil && err.Error() == `sql: database is closed` {
+		t.Logf(`Expected the pool to stay open`)
+		t.Fail()
+	}
+}
+
+func TestPoolSettings(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	pkv.MaxOpenConns = 50
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.FailNow()
+	}
+	if n := pkv.db.Stats().MaxOpenConnections; n != 50 {
+		t.Logf(`Expected 50 connections at most, got %d`, n)
+		t.Fail()
+	}
+	pkv.Close()
+}
+
+func TestSaveBucket(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	err := pkv.SaveBucket(`sample_lookup`, map[string][]byte{`PH`: []byte(`Philippines`), `JP`: []byte(`Japan`)}, true)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	pkv.SaveBucket(`sample_lookup`, map[string][]byte{`PH`: []byte(`Philippines`), `KR`: []byte(`Korea`)}, true)
+	vals, err := pkv.LoadBucket(`sample_lookup`)
+	if err != nil || len(vals) != 2 || string(vals[`KR`]) != `Korea` || vals[`JP`] != nil {
+		t.Logf(`Expected PH and KR only, got %q (%v)`, vals, err)
+		t.Fail()
+	}
+	pkv.SaveBucket(`sample_lookup`, map[string][]byte{}, true)
+
+	pkv.Close()
+}
+
+func TestMeta(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	b := pkv.Bucket(`sample_meta`)
+	b.Del(`doc`)
+	if err := b.SetMime(`doc`, `text/plain`); !errors.Is(err, ErrKeyNotFound) {
+		t.Logf(`Expected ErrKeyNotFound for a missing key, got %v`, err)
+		t.Fail()
+	}
+	b.Set(`doc`, []byte(`v1`))
+	if err := b.SetMime(`doc`, `text/plain`); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	first, err := b.Meta(`doc`)
+	if err != nil || first.Mime != `text/plain` || first.CreatedAt.IsZero() {
+		t.Logf(`Expected text/plain with a creation time, got %+v (%v)`, first, err)
+		t.Fail()
+	}
+	time.Sleep(10 * time.Millisecond)
+	b.Set(`doc`, []byte(`v2`))
+	km, _ := b.Meta(`doc`)
+	if km.Mime != `text/plain` || !km.CreatedAt.Equal(first.CreatedAt) || !km.UpdatedAt.After(first.UpdatedAt) {
+		t.Logf(`Expected the MIME type and creation time kept and a later update, got %+v`, km)
+		t.Fail()
+	}
+	// A key set again once expired starts anew
+	b.SetWithTTL(`doc`, []byte(`v3`), time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	b.Set(`doc`, []byte(`v4`))
+	if km, _ = b.Meta(`doc`); km.Mime != "" || !km.CreatedAt.After(first.CreatedAt) {
+		t.Logf(`Expected the MIME type and creation time of a new key, got %+v`, km)
+		t.Fail()
+	}
+	b.Del(`doc`)
+	if _, err := b.Meta(`doc`); !errors.Is(err, ErrKeyNotFound) {
+		t.Logf(`Expected ErrKeyNotFound after Del, got %v`, err)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func TestMaintenanceCached(t *testing.T) {
+	// No connection is open, so a read of the flag would panic
+	pkv := NewMyPlainKV("", false)
+	pkv.shared().maint.put(true, `upgrading`)
+	if err := pkv.checkMaintenance(); !errors.Is(err, ErrMaintenance) {
+		t.Logf(`Expected the cached ErrMaintenance, got %v`, err)
+		t.Fail()
+	}
+	pkv.shared().maint.put(false, "")
+	if err := pkv.checkMaintenance(); err != nil {
+		t.Logf(`Expected the cached flag to be off, got %v`, err)
+		t.Fail()
+	}
+}
+
+func TestRecencyIndex(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	pkv.RecencyIndex = true
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	var n int
+	err := pkv.db.QueryRow(`SELECT COUNT(*) FROM information_schema.STATISTICS
+	WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = 'IX_BucketUpdatedAt';`,
+		pkv.defTableName).Scan(&n)
+	if err != nil || n == 0 {
+		t.Logf(`Expected the recency index, got %d columns (%v)`, n, err)
+		t.Fail()
+	}
+
+	pkv.Close()
+}
+
+func TestMigrateMime(t *testing.T) {
+	dsn := testDSN(t)
+	db, err := sql.Open(`mysql`, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The table as the first release wrote it, with MIME types kept in
+	// the shared MIME bucket for every bucket, and in MIME buckets of
+	// their own for some
+	for _, stmt := range []string{
+		`DROP TABLE IF EXISTS KVMigrateTBL;`,
+		`CREATE TABLE KVMigrateTBL (
+			Bucket VARCHAR(50),
+			KeyID VARCHAR(300),
+			Value MEDIUMBLOB,
+			PRIMARY KEY (Bucket, KeyID)
+		);`,
+		`INSERT INTO KVMigrateTBL (Bucket, KeyID, Value) VALUES
+			('default', 'a', 'x'), ('--mime--', 'a', 'text/plain'),
+			('orders', 'a', 'y'),
+			('images', 'b', 'z'), ('--mime--images', 'b', 'image/png'),
+			('pages', 'a', 'w'), ('--mime--pages', 'a', 'text/html');`,
+	} {
+		if _, err = db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer db.Exec(`DROP TABLE IF EXISTS KVMigrateTBL;`)
+
+	pkv, err := NewMyPlainKVTable(dsn, `KVMigrateTBL`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pkv.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer pkv.Close()
+
+	for _, c := range []struct{ bucket, key, mime string }{
+		{`default`, `a`, `text/plain`},
+		{`orders`, `a`, `text/plain`},
+		{`images`, `b`, `image/png`},
+		{`pages`, `a`, `text/html`},
+	} {
+		if mt, err := pkv.Bucket(c.bucket).GetMime(c.key); err != nil || mt != c.mime {
+			t.Logf(`Expected %s for %s/%s, got %s (%v)`, c.mime, c.bucket, c.key, mt, err)
+			t.Fail()
+		}
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM KVMigrateTBL WHERE Bucket LIKE '--mime--%';`).Scan(&n)
+	if n != 0 {
+		t.Logf(`Expected the MIME buckets dropped, %d rows left`, n)
+		t.Fail()
+	}
+}
+
+func TestReplayRecordedErrors(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	pkv.SetBucket(`sample_replay`)
+	pkv.Del(`page`)
+
+	var buf bytes.Buffer
+	rec := NewRecorder(pkv, &buf)
+	if err := rec.SetMime(`page`, `text/html`); !errors.Is(err, ErrKeyNotFound) {
+		t.Logf(`Expected ErrKeyNotFound, got %v`, err)
+		t.Fail()
+	}
+	rec.Set(`page`, []byte(`<p>hi</p>`))
+	rec.SetMime(`page`, `text/html`)
+	rec.Del(`page`)
+
+	// The failed SetMime fails the same way again, so the replay goes on
+	recording := buf.String()
+	if err := Replay(strings.NewReader(recording), pkv); err != nil {
+		t.Logf(`Expected the replay to finish, got %v`, err)
+		t.Fail()
+	}
+
+	// Once the key exists, the first SetMime no longer fails as recorded
+	pkv.Set(`page`, []byte(`x`))
+	if err := Replay(strings.NewReader(recording), pkv); !errors.Is(err, ErrReplayMismatch) {
+		t.Logf(`Expected ErrReplayMismatch, got %v`, err)
+		t.Fail()
+	}
+	pkv.Del(`page`)
+
+	pkv.Close()
+}
+
+func TestChunkedOverwrite(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	pkv.ChunkOversized = true
+	if err := pkv.Open(); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+
+	pkv.Set(`sample_large`, make([]byte, 20<<20))
+	if err := pkv.Set(`sample_large`, []byte(`small`)); err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	var n int
+	pkv.db.QueryRow(`SELECT COUNT(*) FROM `+pkv.defTableName+` WHERE Bucket IN (?, ?) AND KeyID LIKE ?;`,
+		partBucket(`default`), chunkBucket(`default`), `sample\_large%`).Scan(&n)
+	if n != 0 {
+		t.Logf(`Expected the parts and manifest dropped, %d rows left`, n)
+		t.Fail()
+	}
+	pkv.Del(`sample_large`)
+
+	pkv.Close()
+}
+
+func TestTTLJitter(t *testing.T) {
+	pkv := NewMyPlainKV("", false)
+	if d := pkv.jitter(time.Minute); d != time.Minute {
+		t.Logf(`Expected no jitter by default, got %s`, d)
+		t.Fail()
+	}
+	pkv.TTLJitter = 0.1
+	spread := false
+	for i := 0; i < 100; i++ {
+		d := pkv.jitter(time.Minute)
+		if d < 54*time.Second || d > 66*time.Second {
+			t.Logf(`Expected a TTL within 10%% of a minute, got %s`, d)
+			t.Fail()
+		}
+		spread = spread || d != time.Minute
+	}
+	if !spread {
+		t.Logf(`Expected the TTLs to be spread`)
+		t.Fail()
+	}
+}
@@ -0,0 +1,114 @@
+package myplainkv
+
+import (
+	"sort"
+	"sync"
+)
+
+// KeyOrder sets the order ListKeys returns the keys of a bucket in
+type KeyOrder int
+
+const (
+	OrderNone            KeyOrder = iota // Whatever order the database reads the keys in
+	OrderBinary                          // Byte by byte, so "B" sorts before "a"
+	OrderCaseInsensitive                 // Ignoring case, ties broken byte by byte
+	OrderNatural                         // Runs of digits compared as numbers, so "item2" sorts before "item10"
+)
+
+// orderSet holds the key orders set on a store
+type orderSet struct {
+	mu     sync.RWMutex
+	orders map[string]KeyOrder
+}
+
+func (ks *orderSet) get(bucket string) KeyOrder {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.orders[bucket]
+}
+
+// SetKeyOrder sets the order ListKeys returns the keys of the bucket
+// in. Key orders are kept in memory and apply to the store, its
+// sessions and connections, not to other instances.
+func (p *MyPlainKV) SetKeyOrder(bucket string, order KeyOrder) {
+	p.shared().orders.mu.Lock()
+	defer p.shared().orders.mu.Unlock()
+	if order == OrderNone {
+		delete(p.shared().orders.orders, p.bucket(bucket))
+		return
+	}
+	if p.shared().orders.orders == nil {
+		p.shared().orders.orders = make(map[string]KeyOrder)
+	}
+	p.shared().orders.orders[p.bucket(bucket)] = order
+}
+
+// orderBy returns the ORDER BY clause of a key order. Natural order has
+// no portable SQL expression, so its keys are sorted after reading.
+func orderBy(order KeyOrder) string {
+	switch order {
+	case OrderBinary:
+		return ` ORDER BY CAST(KeyID AS BINARY)`
+	case OrderCaseInsensitive:
+		return ` ORDER BY LOWER(KeyID), CAST(KeyID AS BINARY)`
+	}
+	return ``
+}
+
+// sortNatural sorts keys comparing runs of digits as numbers
+func sortNatural(keys []string) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		return naturalLess(keys[i], keys[j])
+	})
+}
+
+// naturalLess reports whether a sorts before b in natural order.
+// Numbers equal in value but not in zero padding fall back to
+// byte order.
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na, nb := trimZeros(a[si:i]), trimZeros(b[sj:j])
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	if i < len(a) || j < len(b) {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func trimZeros(s string) string {
+	for len(s) > 1 && s[0] == '0' {
+		s = s[1:]
+	}
+	return s
+}
+
+// SetKeyOrder sets the order ListKeys returns the keys of the bucket in
+func (b *Bucket) SetKeyOrder(order KeyOrder) {
+	b.kv.SetKeyOrder(b.name, order)
+}
@@ -0,0 +1,16 @@
+package myplainkv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSortNatural(t *testing.T) {
+	keys := []string{`item10`, `item2`, `Item1`, `item02`, `item`, `a10b2`, `a10b10`, `a9`}
+	sortNatural(keys)
+	want := `Item1 a9 a10b2 a10b10 item item02 item2 item10`
+	if got := strings.Join(keys, ` `); got != want {
+		t.Logf(`Expected %s, got %s`, want, got)
+		t.Fail()
+	}
+}
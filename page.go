@@ -0,0 +1,117 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// pageTokenVersion starts every page token, so the format can change
+	pageTokenVersion string = `1`
+)
+
+var (
+	ErrInvalidPageToken error = errors.New(`invalid page token`)
+)
+
+// ListKeysPage lists up to limit keys starting with the pattern, in
+// key order, beginning after the page the token ends. An empty token
+// starts at the first key. It returns the token of the next page, or
+// an empty token after the last page. Pages continue from the last key
+// returned, so keys set or deleted while paging never cause others to
+// be skipped or repeated. Tokens are opaque and only valid for the
+// bucket they came from.
+//
+// Keys are in the order the collation of the table compares them,
+// which is the order pages continue in. The order set by SetKeyOrder
+// does not apply. Views page through the keys read through them.
+func (p *MyPlainKV) ListKeysPage(pattern, token string, limit int) ([]string, string, error) {
+	return p.listKeysPage(p.currBuckt, pattern, token, limit)
+}
+
+func (p *MyPlainKV) listKeysPage(bucket, pattern, token string, limit int) (val []string, next string, err error) {
+	var (
+		k   string
+		sqr *sql.Rows
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	val = make([]string, 0)
+	bucket = p.bucket(bucket)
+	after, err := parsePageToken(bucket, token)
+	if err != nil {
+		return val, "", err
+	}
+	if limit < 1 {
+		limit = scanPageSize
+	}
+	if err = p.Open(); err != nil {
+		return val, "", err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	// A view pages through its source, the token staying with the view
+	src, pats := p.shared().views.chain(bucket)
+	args := []any{src, pattern + `%`}
+	like := ``
+	for _, pat := range pats {
+		like += ` AND KeyID LIKE ?`
+		args = append(args, pat+`%`)
+	}
+	// One more key is read to tell whether another page follows
+	sqlstr := `
+	SELECT KeyID FROM ` + p.defTableName + `
+	WHERE Bucket = ? AND KeyID LIKE ?` + like + ` AND KeyID > ? AND ` + notExpired + `
+	ORDER BY KeyID LIMIT ?;`
+	if sqr, err = p.query(sqlstr, append(args, after, limit+1)...); err != nil {
+		return val, "", err
+	}
+	defer sqr.Close()
+	for sqr.Next() {
+		if err = sqr.Scan(&k); err != nil {
+			return val, "", err
+		}
+		val = append(val, k)
+	}
+	if err = sqr.Err(); err != nil {
+		return val, "", err
+	}
+	if len(val) > limit {
+		val = val[:limit]
+		next = pageToken(bucket, val[limit-1])
+	}
+	p.record(start, int64(len(val)))
+	return val, next, nil
+}
+
+// pageToken encodes the bucket and the last key of a page
+func pageToken(bucket, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(pageTokenVersion + "\x00" + bucket + "\x00" + key))
+}
+
+// parsePageToken returns the key a page token ends with, or an empty
+// key for an empty token
+func parsePageToken(bucket, token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", ErrInvalidPageToken
+	}
+	parts := strings.SplitN(string(raw), "\x00", 3)
+	if len(parts) != 3 || parts[0] != pageTokenVersion || parts[1] != bucket {
+		return "", ErrInvalidPageToken
+	}
+	return parts[2], nil
+}
+
+// ListKeysPage lists up to limit keys of the bucket starting with the
+// pattern, beginning after the page the token ends
+func (b *Bucket) ListKeysPage(pattern, token string, limit int) ([]string, string, error) {
+	return b.kv.listKeysPage(b.name, pattern, token, limit)
+}
@@ -0,0 +1,19 @@
+package myplainkv
+
+import "testing"
+
+func TestPageToken(t *testing.T) {
+	tok := pageToken(`users`, "a\x00b")
+	if k, err := parsePageToken(`users`, tok); err != nil || k != "a\x00b" {
+		t.Logf(`Expected the key to round-trip, got %q (%v)`, k, err)
+		t.Fail()
+	}
+	if _, err := parsePageToken(`orders`, tok); err != ErrInvalidPageToken {
+		t.Logf(`Expected a token of another bucket to be refused, got %v`, err)
+		t.Fail()
+	}
+	if _, err := parsePageToken(`users`, `not a token`); err != ErrInvalidPageToken {
+		t.Logf(`Expected a malformed token to be refused, got %v`, err)
+		t.Fail()
+	}
+}
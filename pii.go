@@ -0,0 +1,119 @@
+package myplainkv
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PIIDetector finds one kind of personal data in values
+type PIIDetector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Valid   func(match []byte) bool // Rejects false positives of the pattern. Nil accepts all
+}
+
+// PIIFinding is the personal data of one kind found in a key
+type PIIFinding struct {
+	Key      string
+	Detector string
+	Count    int
+	Sample   string // First match, masked but its last four characters
+}
+
+// PIIReport lists the personal data found in a bucket
+type PIIReport struct {
+	Bucket      string
+	KeysScanned int
+	Findings    []PIIFinding
+}
+
+var (
+	// PIIEmail detects email addresses
+	PIIEmail = PIIDetector{
+		Name:    `email`,
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	}
+	// PIIPhone detects international and North American phone numbers
+	PIIPhone = PIIDetector{
+		Name:    `phone`,
+		Pattern: regexp.MustCompile(`\+[1-9][0-9]{7,14}\b|\(?\b[2-9][0-9]{2}\)?[\-. ][0-9]{3}[\-. ][0-9]{4}\b`),
+	}
+	// PIICard detects payment card numbers passing the Luhn check
+	PIICard = PIIDetector{
+		Name:    `card`,
+		Pattern: regexp.MustCompile(`\b[0-9](?:[ \-]?[0-9]){12,18}\b`),
+		Valid:   luhn,
+	}
+)
+
+// DefaultPIIDetectors are the detectors ScanPII uses when none are given
+var DefaultPIIDetectors = []PIIDetector{PIIEmail, PIIPhone, PIICard}
+
+// ScanPII scans every value of the bucket with the detectors, or with
+// DefaultPIIDetectors if none are given, and reports what they found
+func (p *MyPlainKV) ScanPII(bucket string, detectors ...PIIDetector) (PIIReport, error) {
+	if len(detectors) == 0 {
+		detectors = DefaultPIIDetectors
+	}
+	rep := PIIReport{
+		Bucket:   p.bucket(bucket),
+		Findings: make([]PIIFinding, 0),
+	}
+	err := p.ScanRange(Range{Bucket: bucket}, func(key string, value []byte) error {
+		rep.KeysScanned++
+		for _, d := range detectors {
+			if f, ok := d.find(key, value); ok {
+				rep.Findings = append(rep.Findings, f)
+			}
+		}
+		return nil
+	})
+	return rep, err
+}
+
+// find runs the detector on a value
+func (d PIIDetector) find(key string, value []byte) (PIIFinding, bool) {
+	f := PIIFinding{
+		Key:      key,
+		Detector: d.Name,
+	}
+	for _, m := range d.Pattern.FindAll(value, -1) {
+		if d.Valid != nil && !d.Valid(m) {
+			continue
+		}
+		if f.Count == 0 {
+			f.Sample = mask(string(m))
+		}
+		f.Count++
+	}
+	return f, f.Count > 0
+}
+
+// mask replaces all but the last four characters of s with asterisks
+func mask(s string) string {
+	r := []rune(s)
+	if len(r) <= 4 {
+		return strings.Repeat(`*`, len(r))
+	}
+	return strings.Repeat(`*`, len(r)-4) + string(r[len(r)-4:])
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum
+func luhn(s []byte) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
@@ -0,0 +1,30 @@
+package myplainkv
+
+import "testing"
+
+func TestPIIDetectors(t *testing.T) {
+	cases := []struct {
+		d     PIIDetector
+		value string
+		want  int
+	}{
+		{PIIEmail, `contact: jane.doe@example.com, ops@example.org`, 2},
+		{PIIEmail, `not an email @ all`, 0},
+		{PIIPhone, `call +639171234567 or (415) 555-0132`, 2},
+		{PIIPhone, `order 12345`, 0},
+		{PIICard, `card 4111 1111 1111 1111`, 1},
+		{PIICard, `card 4111 1111 1111 1112`, 0},
+	}
+	for _, c := range cases {
+		f, _ := c.d.find(`k`, []byte(c.value))
+		if f.Count != c.want {
+			t.Logf(`%s in %q: expected %d, got %d`, c.d.Name, c.value, c.want, f.Count)
+			t.Fail()
+		}
+	}
+
+	if m := mask(`4111111111111111`); m != `************1111` {
+		t.Logf(`Unexpected mask %s`, m)
+		t.Fail()
+	}
+}
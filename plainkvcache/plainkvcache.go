@@ -0,0 +1,275 @@
+// Package plainkvcache caches computed values in a bucket, protecting
+// the computation from stampedes. Concurrent misses of a key share one
+// computation, and a value past its TTL may still be served for a while
+// as it is recomputed in the background.
+//
+//	c := plainkvcache.New(kv, plainkvcache.Options{
+//		Bucket:   `report-cache`,
+//		TTL:      time.Minute,
+//		StaleTTL: 10 * time.Minute,
+//	})
+//	val, err := c.GetOrCompute(`daily`, buildDailyReport)
+package plainkvcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	myplainkv "github.com/narsilworks/plainkv"
+)
+
+const (
+	// envVersion starts every stored entry, so the format can change
+	envVersion byte = 1
+
+	// envHeader is the size of the header before the value: the version,
+	// then the times the value goes stale and expires, in Unix nanoseconds
+	envHeader int = 17
+
+	// defTTL is how long values are fresh when Options.TTL is zero
+	defTTL time.Duration = time.Minute
+)
+
+// Store is the part of a bucket the cache uses. A *myplainkv.Bucket
+// implements it. Stores that also implement SetWithTTL have entries
+// expire on their own once they can no longer be served.
+type Store interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	Del(key string) error
+}
+
+// ttlStore is a Store able to expire keys
+type ttlStore interface {
+	SetWithTTL(key string, value []byte, ttl time.Duration) error
+}
+
+// sessionStore is a bucket of a store whose operations each run on a
+// session of their own
+type sessionStore struct {
+	kv     *myplainkv.MyPlainKV
+	bucket string
+}
+
+func (s sessionStore) Get(key string) ([]byte, error) {
+	ss := s.kv.Session()
+	defer ss.Close()
+	return ss.Bucket(s.bucket).Get(key)
+}
+
+func (s sessionStore) Set(key string, value []byte) error {
+	ss := s.kv.Session()
+	defer ss.Close()
+	return ss.Bucket(s.bucket).Set(key, value)
+}
+
+func (s sessionStore) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	ss := s.kv.Session()
+	defer ss.Close()
+	return ss.Bucket(s.bucket).SetWithTTL(key, value, ttl)
+}
+
+func (s sessionStore) Del(key string) error {
+	ss := s.kv.Session()
+	defer ss.Close()
+	return ss.Bucket(s.bucket).Del(key)
+}
+
+// Options configure a Cache
+type Options struct {
+	Bucket   string        // Bucket holding the cached values. Empty means the default bucket
+	TTL      time.Duration // How long a computed value is fresh. Zero means one minute
+	StaleTTL time.Duration // How long past TTL a value is served while it is recomputed. Zero disables
+}
+
+// Metrics counts what a Cache did since it was created
+type Metrics struct {
+	Hits          int64 // Fresh values served
+	StaleHits     int64 // Stale values served while being recomputed
+	Misses        int64 // Lookups that had to wait for a computation
+	Shared        int64 // Misses that waited for a computation started by another
+	Computes      int64 // Computations run
+	ComputeErrors int64 // Computations that failed or panicked
+	StoreErrors   int64 // Values computed but not stored
+}
+
+// Cache caches computed values in a store. It is safe for concurrent
+// use.
+type Cache struct {
+	s     Store
+	opts  Options
+	mu    sync.Mutex
+	calls map[string]*call
+	m     struct {
+		hits, staleHits, misses, shared, computes, computeErrs, storeErrs atomic.Int64
+	}
+}
+
+// call is a computation in progress
+type call struct {
+	done chan struct{}
+	val  []byte
+	err  error
+}
+
+// New returns a cache keeping its values in a bucket of kv. As kv is
+// not safe for concurrent use, each operation runs on a session of its
+// own.
+func New(kv *myplainkv.MyPlainKV, opts Options) *Cache {
+	return FromStore(sessionStore{kv: kv, bucket: opts.Bucket}, opts)
+}
+
+// FromStore returns a cache keeping its values in a store. The Bucket
+// option is not used.
+func FromStore(s Store, opts Options) *Cache {
+	if opts.TTL <= 0 {
+		opts.TTL = defTTL
+	}
+	if opts.StaleTTL < 0 {
+		opts.StaleTTL = 0
+	}
+	return &Cache{
+		s:     s,
+		opts:  opts,
+		calls: make(map[string]*call),
+	}
+}
+
+// GetOrCompute returns the value cached under key. On a miss, fn
+// computes it and it is stored; callers missing the same key meanwhile
+// wait for that computation instead of running their own. A stale value
+// is returned at once, with fn run in the background to replace it.
+// Errors of fn are returned, and nothing is cached for them. A value
+// computed but not stored is still returned.
+func (c *Cache) GetOrCompute(key string, fn func() ([]byte, error)) ([]byte, error) {
+	raw, err := c.s.Get(key)
+	if err != nil && !errors.Is(err, myplainkv.ErrKeyNotFound) {
+		return nil, err
+	}
+	if val, fresh, stale, ok := decode(raw); ok {
+		now := time.Now()
+		switch {
+		case now.Before(fresh):
+			c.m.hits.Add(1)
+			return val, nil
+		case now.Before(stale):
+			c.m.staleHits.Add(1)
+			c.refresh(key, fn)
+			return val, nil
+		}
+	}
+	c.m.misses.Add(1)
+	cl, owner := c.start(key)
+	if owner {
+		c.compute(key, cl, fn)
+	} else {
+		c.m.shared.Add(1)
+		<-cl.done
+	}
+	return cl.val, cl.err
+}
+
+// Invalidate drops the value cached under key, so the next lookup
+// computes it again
+func (c *Cache) Invalidate(key string) error {
+	return c.s.Del(key)
+}
+
+// Metrics returns the counts of what the cache did so far
+func (c *Cache) Metrics() Metrics {
+	return Metrics{
+		Hits:          c.m.hits.Load(),
+		StaleHits:     c.m.staleHits.Load(),
+		Misses:        c.m.misses.Load(),
+		Shared:        c.m.shared.Load(),
+		Computes:      c.m.computes.Load(),
+		ComputeErrors: c.m.computeErrs.Load(),
+		StoreErrors:   c.m.storeErrs.Load(),
+	}
+}
+
+// refresh recomputes a stale value in the background, unless it is
+// already being computed
+func (c *Cache) refresh(key string, fn func() ([]byte, error)) {
+	cl, owner := c.start(key)
+	if owner {
+		go c.compute(key, cl, fn)
+	}
+}
+
+// start returns the computation of key in progress, or registers a new
+// one, reporting whether the caller owns it and must run it
+func (c *Cache) start(key string) (*call, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl, ok := c.calls[key]; ok {
+		return cl, false
+	}
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	return cl, true
+}
+
+// compute runs fn for the call and stores its value. Waiters are
+// released even if fn panics, and the panic is raised again.
+func (c *Cache) compute(key string, cl *call, fn func() ([]byte, error)) {
+	c.m.computes.Add(1)
+	defer func() {
+		if r := recover(); r != nil {
+			cl.err = errors.New(`plainkvcache: computation panicked`)
+			c.finish(key, cl)
+			c.m.computeErrs.Add(1)
+			panic(r)
+		}
+		c.finish(key, cl)
+	}()
+	if cl.val, cl.err = fn(); cl.err != nil {
+		c.m.computeErrs.Add(1)
+		return
+	}
+	if err := c.store(key, cl.val); err != nil {
+		c.m.storeErrs.Add(1)
+	}
+}
+
+// finish releases the waiters of a call and forgets it
+func (c *Cache) finish(key string, cl *call) {
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	close(cl.done)
+}
+
+// store writes a value with the times it goes stale and expires
+func (c *Cache) store(key string, val []byte) error {
+	now := time.Now()
+	keep := c.opts.TTL + c.opts.StaleTTL
+	raw := encode(val, now.Add(c.opts.TTL), now.Add(keep))
+	if ts, ok := c.s.(ttlStore); ok {
+		return ts.SetWithTTL(key, raw, keep)
+	}
+	return c.s.Set(key, raw)
+}
+
+// encode prefixes a value with the times it goes stale and expires
+func encode(val []byte, fresh, stale time.Time) []byte {
+	raw := make([]byte, envHeader, envHeader+len(val))
+	raw[0] = envVersion
+	binary.BigEndian.PutUint64(raw[1:9], uint64(fresh.UnixNano()))
+	binary.BigEndian.PutUint64(raw[9:17], uint64(stale.UnixNano()))
+	return append(raw, val...)
+}
+
+// decode splits a stored entry into its value and the times it goes
+// stale and expires. It reports false for a missing or foreign entry.
+func decode(raw []byte) ([]byte, time.Time, time.Time, bool) {
+	if len(raw) < envHeader || raw[0] != envVersion {
+		return nil, time.Time{}, time.Time{}, false
+	}
+	fresh := time.Unix(0, int64(binary.BigEndian.Uint64(raw[1:9])))
+	stale := time.Unix(0, int64(binary.BigEndian.Uint64(raw[9:17])))
+	return raw[envHeader:], fresh, stale, true
+}
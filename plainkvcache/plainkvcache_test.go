@@ -0,0 +1,140 @@
+package plainkvcache_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	myplainkv "github.com/narsilworks/plainkv"
+	"github.com/narsilworks/plainkv/memplainkv"
+	"github.com/narsilworks/plainkv/plainkvcache"
+)
+
+func TestGetOrCompute(t *testing.T) {
+	kv := memplainkv.NewMemPlainKV()
+	kv.Open()
+	c := plainkvcache.FromStore(kv, plainkvcache.Options{TTL: time.Hour})
+
+	var runs atomic.Int32
+	release := make(chan struct{})
+	fn := func() ([]byte, error) {
+		runs.Add(1)
+		<-release
+		return []byte(`report`), nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if val, err := c.GetOrCompute(`daily`, fn); err != nil || string(val) != `report` {
+				t.Logf(`Expected the computed value, got %q (%v)`, val, err)
+				t.Fail()
+			}
+		}()
+	}
+	// Let every caller join the computation before it ends
+	for c.Metrics().Shared < 7 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if n := runs.Load(); n != 1 {
+		t.Logf(`Expected one computation, got %d`, n)
+		t.Fail()
+	}
+	if val, _ := c.GetOrCompute(`daily`, fn); string(val) != `report` || c.Metrics().Hits != 1 {
+		t.Logf(`Expected a hit, got %q and %+v`, val, c.Metrics())
+		t.Fail()
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	kv := memplainkv.NewMemPlainKV()
+	kv.Open()
+	c := plainkvcache.FromStore(kv, plainkvcache.Options{TTL: time.Millisecond, StaleTTL: time.Hour})
+
+	c.GetOrCompute(`k`, func() ([]byte, error) { return []byte(`old`), nil })
+	time.Sleep(5 * time.Millisecond)
+	done := make(chan struct{})
+	val, err := c.GetOrCompute(`k`, func() ([]byte, error) {
+		defer close(done)
+		return []byte(`new`), nil
+	})
+	if err != nil || string(val) != `old` {
+		t.Logf(`Expected the stale value, got %q (%v)`, val, err)
+		t.Fail()
+	}
+	<-done
+	if m := c.Metrics(); m.StaleHits != 1 || m.Computes != 2 {
+		t.Logf(`Expected a stale hit and two computations, got %+v`, m)
+		t.Fail()
+	}
+}
+
+func TestComputeError(t *testing.T) {
+	kv := memplainkv.NewMemPlainKV()
+	kv.Open()
+	c := plainkvcache.FromStore(kv, plainkvcache.Options{})
+
+	errDown := errors.New(`backend down`)
+	if _, err := c.GetOrCompute(`k`, func() ([]byte, error) { return nil, errDown }); err != errDown {
+		t.Logf(`Expected the computation error, got %v`, err)
+		t.Fail()
+	}
+	if val, err := c.GetOrCompute(`k`, func() ([]byte, error) { return []byte(`v`), nil }); err != nil || string(val) != `v` {
+		t.Logf(`Expected the error not to be cached, got %q (%v)`, val, err)
+		t.Fail()
+	}
+	c.Invalidate(`k`)
+	c.GetOrCompute(`k`, func() ([]byte, error) { return []byte(`v2`), nil })
+	if c.Metrics().Misses != 3 {
+		t.Logf(`Expected a miss after Invalidate, got %+v`, c.Metrics())
+		t.Fail()
+	}
+}
+
+// TestNewConcurrent runs the cache over a store from many goroutines,
+// with stale values refreshed in the background. Run with -race.
+func TestNewConcurrent(t *testing.T) {
+	dsn := os.Getenv(`PLAINKV_TEST_DSN`)
+	if dsn == "" {
+		t.Skip(`PLAINKV_TEST_DSN is not set`)
+	}
+	kv := myplainkv.NewMyPlainKV(dsn, true)
+	c := plainkvcache.New(kv, plainkvcache.Options{
+		Bucket:   `cache-race`,
+		TTL:      time.Millisecond,
+		StaleTTL: time.Hour,
+	})
+	defer c.Invalidate(`k`)
+
+	if _, err := c.GetOrCompute(`k`, func() ([]byte, error) { return []byte(`v`), nil }); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := c.GetOrCompute(`k`, func() ([]byte, error) { return []byte(`v`), nil })
+			if err != nil || string(val) != `v` {
+				t.Logf(`Expected the cached value, got %q (%v)`, val, err)
+				t.Fail()
+			}
+		}()
+	}
+	wg.Wait()
+	// Wait for the background refresh to have started
+	for c.Metrics().Computes < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if m := c.Metrics(); m.StaleHits == 0 || m.StoreErrors != 0 {
+		t.Logf(`Expected stale hits without store errors, got %+v`, m)
+		t.Fail()
+	}
+}
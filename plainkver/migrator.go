@@ -0,0 +1,301 @@
+package plainkver
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// keyLocks is the number of locks keys are spread over
+	keyLocks int = 64
+)
+
+// exister is a backend able to tell an empty value from a missing key
+type exister interface {
+	Exists(key string) (bool, error)
+}
+
+// Migrator moves data from one backend to another while serving it.
+// Until Flip is called, the old backend is the source of truth: writes
+// go to both, and reads come from the old one, copying what they read
+// to the new one. Afterwards, everything goes to the new backend only.
+//
+// A key is copied under a lock it shares with Set and Del, so no write
+// lands between reading it from the old backend and copying it. Empty
+// values are copied like any other if the old backend has an Exists
+// method to tell them from missing keys, and are not copied otherwise.
+type Migrator struct {
+	old, new PlainKVer
+	locks    [keyLocks]sync.Mutex
+	mu       sync.Mutex
+	bucket   string
+	flipped  bool
+	progress map[string]*Progress
+	err      error
+}
+
+// Progress is the migration progress of a bucket
+type Progress struct {
+	Copied   int  // Keys copied to the new backend by reads and writes
+	Complete bool // Every key was copied by Backfill
+}
+
+// NewMigrator creates a Migrator from the old backend to the new one.
+// Both must use the same bucket names.
+func NewMigrator(old, new PlainKVer) *Migrator {
+	return &Migrator{
+		old:      old,
+		new:      new,
+		bucket:   `default`,
+		progress: make(map[string]*Progress),
+	}
+}
+
+// Err returns the last error met copying to the new backend. Reads and
+// writes that succeed on the old backend do not fail on such errors.
+func (m *Migrator) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// Progress returns the migration progress of a bucket
+func (m *Migrator) Progress(bucket string) Progress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if pr, ok := m.progress[bucket]; ok {
+		return *pr
+	}
+	return Progress{}
+}
+
+// Flip makes the new backend the only one in use
+func (m *Migrator) Flip() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flipped = true
+}
+
+// Flipped reports whether Flip was called
+func (m *Migrator) Flipped() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.flipped
+}
+
+// Backfill copies every key of the current bucket to the new backend
+// and marks the bucket complete
+func (m *Migrator) Backfill() error {
+	keys, err := m.old.ListKeys(``)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		k := k
+		_, err = m.fetch(k, func(v []byte) error {
+			if err := m.new.Set(k, v); err != nil {
+				return err
+			}
+			m.copied(1)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prog().Complete = true
+	return nil
+}
+
+// fetch reads a key from the old backend and passes its value to put,
+// holding the lock of the key. Keys missing from the old backend are not
+// passed on, so one deleted after being listed is not brought back.
+func (m *Migrator) fetch(key string, put func(v []byte) error) ([]byte, error) {
+	lk := m.lock(key)
+	lk.Lock()
+	defer lk.Unlock()
+	v, err := m.old.Get(key)
+	if err != nil {
+		return v, err
+	}
+	if len(v) == 0 {
+		// Without Exists, an empty value reads as a missing key
+		e, ok := m.old.(exister)
+		if !ok {
+			return v, nil
+		}
+		if ok, err = e.Exists(key); err != nil || !ok {
+			return v, err
+		}
+	}
+	return v, put(v)
+}
+
+// lock returns the lock of a key of the current bucket
+func (m *Migrator) lock(key string) *sync.Mutex {
+	m.mu.Lock()
+	bucket := m.bucket
+	m.mu.Unlock()
+	h := fnv.New32a()
+	h.Write([]byte(bucket))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return &m.locks[h.Sum32()%uint32(keyLocks)]
+}
+
+// prog returns the progress of the current bucket. The lock must be held.
+func (m *Migrator) prog() *Progress {
+	pr, ok := m.progress[m.bucket]
+	if !ok {
+		pr = &Progress{}
+		m.progress[m.bucket] = pr
+	}
+	return pr
+}
+
+// copied counts keys copied to the new backend
+func (m *Migrator) copied(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prog().Copied += n
+}
+
+// mirror notes the outcome of a copy to the new backend
+func (m *Migrator) mirror(err error) {
+	if err == nil {
+		m.copied(1)
+		return
+	}
+	m.fail(err)
+}
+
+// fail notes an error met on the new backend
+func (m *Migrator) fail(err error) {
+	if err == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Open opens both backends
+func (m *Migrator) Open() error {
+	if err := m.old.Open(); err != nil {
+		return err
+	}
+	return m.new.Open()
+}
+
+// Close closes both backends
+func (m *Migrator) Close() error {
+	err := m.old.Close()
+	if nerr := m.new.Close(); err == nil {
+		err = nerr
+	}
+	return err
+}
+
+// Get retrieves a record, from the old backend until flipped
+func (m *Migrator) Get(key string) ([]byte, error) {
+	if m.Flipped() {
+		return m.new.Get(key)
+	}
+	return m.fetch(key, func(v []byte) error {
+		m.mirror(m.new.Set(key, v))
+		return nil
+	})
+}
+
+// Set creates or updates the record, in both backends until flipped
+func (m *Migrator) Set(key string, value []byte) error {
+	if m.Flipped() {
+		return m.new.Set(key, value)
+	}
+	lk := m.lock(key)
+	lk.Lock()
+	defer lk.Unlock()
+	if err := m.old.Set(key, value); err != nil {
+		return err
+	}
+	m.mirror(m.new.Set(key, value))
+	return nil
+}
+
+// Del deletes a record, from both backends until flipped
+func (m *Migrator) Del(key string) error {
+	if m.Flipped() {
+		return m.new.Del(key)
+	}
+	lk := m.lock(key)
+	lk.Lock()
+	defer lk.Unlock()
+	if err := m.old.Del(key); err != nil {
+		return err
+	}
+	m.fail(m.new.Del(key))
+	return nil
+}
+
+// ListKeys lists all keys starting with the pattern, from the old
+// backend until flipped
+func (m *Migrator) ListKeys(pattern string) ([]string, error) {
+	if m.Flipped() {
+		return m.new.ListKeys(pattern)
+	}
+	return m.old.ListKeys(pattern)
+}
+
+// SetBucket sets the current bucket of both backends
+func (m *Migrator) SetBucket(bucket string) {
+	m.mu.Lock()
+	m.bucket = bucket
+	if bucket == "" {
+		m.bucket = `default`
+	}
+	m.mu.Unlock()
+	m.old.SetBucket(bucket)
+	m.new.SetBucket(bucket)
+}
+
+// Begin a transaction on both backends
+func (m *Migrator) Begin() error {
+	if m.Flipped() {
+		return m.new.Begin()
+	}
+	if err := m.old.Begin(); err != nil {
+		return err
+	}
+	if err := m.new.Begin(); err != nil {
+		m.old.Rollback()
+		return err
+	}
+	return nil
+}
+
+// Commit the transaction, on the old backend first until flipped
+func (m *Migrator) Commit() error {
+	if m.Flipped() {
+		return m.new.Commit()
+	}
+	if err := m.old.Commit(); err != nil {
+		m.new.Rollback()
+		return err
+	}
+	m.fail(m.new.Commit())
+	return nil
+}
+
+// Rollback the transaction on both backends
+func (m *Migrator) Rollback() error {
+	if m.Flipped() {
+		return m.new.Rollback()
+	}
+	err := m.old.Rollback()
+	if nerr := m.new.Rollback(); err == nil {
+		err = nerr
+	}
+	return err
+}
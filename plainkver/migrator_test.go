@@ -0,0 +1,91 @@
+package plainkver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/narsilworks/plainkv/memplainkv"
+	"github.com/narsilworks/plainkv/plainkver"
+)
+
+func TestMigrator(t *testing.T) {
+	old, new := memplainkv.NewMemPlainKV(), memplainkv.NewMemPlainKV()
+	old.Open()
+	old.Set(`a`, []byte(`1`))
+	old.Set(`b`, []byte(`2`))
+
+	m := plainkver.NewMigrator(old, new)
+	if err := m.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reads copy to the new backend, writes go to both
+	if v, _ := m.Get(`a`); string(v) != `1` {
+		t.Fatalf(`Expected 1, got %s`, v)
+	}
+	if v, _ := new.Get(`a`); string(v) != `1` {
+		t.Fatalf(`Expected the read to be copied, got %s`, v)
+	}
+	m.Set(`c`, []byte(`3`))
+	if v, _ := old.Get(`c`); string(v) != `3` {
+		t.Fatalf(`Expected the write in the old backend, got %s`, v)
+	}
+
+	if err := m.Backfill(); err != nil {
+		t.Fatal(err)
+	}
+	if pr := m.Progress(`default`); !pr.Complete {
+		t.Fatalf(`Expected the bucket to be complete, got %+v`, pr)
+	}
+
+	m.Flip()
+	m.Set(`d`, []byte(`4`))
+	if v, _ := old.Get(`d`); len(v) != 0 {
+		t.Fatalf(`Expected no writes to the old backend after Flip, got %s`, v)
+	}
+	if v, _ := m.Get(`b`); string(v) != `2` {
+		t.Fatalf(`Expected 2 from the new backend, got %s`, v)
+	}
+	if err := m.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigratorCopyRace(t *testing.T) {
+	old, new := memplainkv.NewMemPlainKV(), memplainkv.NewMemPlainKV()
+	m := plainkver.NewMigrator(old, new)
+	if err := m.Open(); err != nil {
+		t.Fatal(err)
+	}
+	old.Set(`a`, []byte(`1`))
+
+	// A Del landing between the read and the copy must win
+	new.Inject(memplainkv.Fault{Op: `Set`, Key: `a`, Latency: 50 * time.Millisecond, Times: 1})
+	done := make(chan struct{})
+	go func() {
+		m.Get(`a`)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := m.Del(`a`); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if ok, _ := new.Exists(`a`); ok {
+		t.Logf(`Expected the deleted key not to be copied back`)
+		t.Fail()
+	}
+
+	// Empty values are copied, missing keys are not
+	old.Set(`empty`, []byte{})
+	m.Get(`empty`)
+	m.Get(`missing`)
+	if ok, _ := new.Exists(`empty`); !ok {
+		t.Logf(`Expected the empty value to be copied`)
+		t.Fail()
+	}
+	if ok, _ := new.Exists(`missing`); ok {
+		t.Logf(`Expected the missing key not to be copied`)
+		t.Fail()
+	}
+}
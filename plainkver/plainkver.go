@@ -0,0 +1,30 @@
+// Package plainkver defines the interface shared by the PlainKV
+// backends, so applications can swap one for another
+package plainkver
+
+import "errors"
+
+var (
+	// ErrNoMime is returned with the default MIME type by GetMime for
+	// keys without a MIME type of their own
+	ErrNoMime error = errors.New(`no MIME type set for the key`)
+
+	// ErrKeyNotFound is returned for operations needing a key that does
+	// not exist
+	ErrKeyNotFound error = errors.New(`key not found`)
+)
+
+// PlainKVer is a bucketed key-value store. MyPlainKV and MemPlainKV
+// implement it.
+type PlainKVer interface {
+	Open() error
+	Close() error
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	Del(key string) error
+	ListKeys(pattern string) ([]string, error)
+	SetBucket(bucket string)
+	Begin() error
+	Commit() error
+	Rollback() error
+}
@@ -0,0 +1,301 @@
+// Package plainkvfs serves the keys of a bucket as a read-only file
+// system. Keys are slash-separated paths, as in plainkvtest fixtures,
+// and each prefix ending in a slash is a directory.
+package plainkvfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	myplainkv "github.com/narsilworks/plainkv"
+)
+
+var (
+	errIsDir error = errors.New(`is a directory`)
+)
+
+// Store is the part of a bucket the file system reads. A
+// *myplainkv.Bucket implements it.
+type Store interface {
+	Get(key string) ([]byte, error)
+	GetMime(key string) (string, error)
+	ListKeys(pattern string) ([]string, error)
+}
+
+// sessionStore is a bucket of a store whose reads each run on a
+// session of their own
+type sessionStore struct {
+	kv     *myplainkv.MyPlainKV
+	bucket string
+}
+
+func (s sessionStore) Get(key string) ([]byte, error) {
+	ss := s.kv.Session()
+	defer ss.Close()
+	return ss.Bucket(s.bucket).Get(key)
+}
+
+func (s sessionStore) GetMime(key string) (string, error) {
+	ss := s.kv.Session()
+	defer ss.Close()
+	return ss.Bucket(s.bucket).GetMime(key)
+}
+
+func (s sessionStore) ListKeys(pattern string) ([]string, error) {
+	ss := s.kv.Session()
+	defer ss.Close()
+	return ss.Bucket(s.bucket).ListKeys(pattern)
+}
+
+// FS is a read-only file system over the keys of a bucket. It
+// implements fs.FS, fs.ReadDirFS and fs.ReadFileFS.
+type FS struct {
+	s Store
+}
+
+// New returns a file system over the keys of a bucket. As kv is not
+// safe for concurrent use, and http.FileServer serves requests
+// concurrently, each read runs on a session of its own.
+func New(kv *myplainkv.MyPlainKV, bucket string) *FS {
+	return FromStore(sessionStore{kv: kv, bucket: bucket})
+}
+
+// FromStore returns a file system over the keys of a store. The store
+// must be safe for concurrent use to serve HTTP.
+func FromStore(s Store) *FS {
+	return &FS{s: s}
+}
+
+// Open opens the value of a key as a file, or a prefix shared by keys
+// as a directory
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: `open`, Path: name, Err: fs.ErrInvalid}
+	}
+	isFile, children, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: `open`, Path: name, Err: err}
+	}
+	if isFile {
+		val, err := f.s.Get(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: `open`, Path: name, Err: err}
+		}
+		return &file{
+			Reader: bytes.NewReader(val),
+			info:   fileInfo{name: path.Base(name), size: int64(len(val))},
+		}, nil
+	}
+	if children == nil {
+		return nil, &fs.PathError{Op: `open`, Path: name, Err: fs.ErrNotExist}
+	}
+	return &dir{
+		info:    fileInfo{name: path.Base(name), dir: true},
+		entries: children,
+	}, nil
+}
+
+// ReadDir lists the entries of a directory, sorted by name
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: `readdir`, Path: name, Err: fs.ErrInvalid}
+	}
+	_, children, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: `readdir`, Path: name, Err: err}
+	}
+	if children == nil {
+		return nil, &fs.PathError{Op: `readdir`, Path: name, Err: fs.ErrNotExist}
+	}
+	return children, nil
+}
+
+// ReadFile reads the value of a key
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, ok := file.(*dir); ok {
+		return nil, &fs.PathError{Op: `read`, Path: name, Err: errIsDir}
+	}
+	return io.ReadAll(file)
+}
+
+// HTTP returns the file system as an http.FileSystem
+func (f *FS) HTTP() http.FileSystem {
+	return http.FS(f)
+}
+
+// FileServer returns a handler serving the keys as http.FileServer
+// does, with the content type stored for each key by SetMime. Keys
+// without one are typed by their extension or content, as
+// http.FileServer does.
+func (f *FS) FileServer() http.Handler {
+	fsrv := http.FileServer(f.HTTP())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(`/`+r.URL.Path), `/`)
+		if name != "" && !strings.HasSuffix(r.URL.Path, `/`) {
+			if isFile, _, err := f.lookup(name); err == nil && isFile {
+				if mt, err := f.s.GetMime(name); err == nil && mt != "" {
+					w.Header().Set(`Content-Type`, mt)
+				}
+			}
+		}
+		fsrv.ServeHTTP(w, r)
+	})
+}
+
+// lookup reports whether name is a key, and lists the entries below it
+// if it is a directory. The entries are nil if it is not.
+func (f *FS) lookup(name string) (bool, []fs.DirEntry, error) {
+	prefix := ""
+	if name != `.` {
+		prefix = name + `/`
+	}
+	// ListKeys matches a LIKE pattern. Wildcards only widen the match and
+	// are filtered out below, but a backslash would escape what follows.
+	pattern := name
+	if name == `.` {
+		pattern = ""
+	}
+	if i := strings.IndexByte(pattern, '\\'); i >= 0 {
+		pattern = pattern[:i]
+	}
+	keys, err := f.s.ListKeys(pattern)
+	if err != nil {
+		return false, nil, err
+	}
+	var (
+		isFile   bool
+		children []fs.DirEntry
+	)
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if k == name {
+			isFile = true
+			continue
+		}
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		rest := k[len(prefix):]
+		child, isDir := rest, false
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			child, isDir = rest[:i], true
+		}
+		if child == "" || seen[child] {
+			continue
+		}
+		seen[child] = true
+		children = append(children, &dirEntry{fsys: f, key: prefix + child, dir: isDir})
+	}
+	if children != nil {
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Name() < children[j].Name()
+		})
+	} else if name == `.` {
+		children = []fs.DirEntry{}
+	}
+	return isFile, children, nil
+}
+
+// fileInfo describes a key or a directory. Sizes of directories are
+// not known without reading every key below them, so they are zero.
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() any           { return nil }
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// dirEntry is an entry of a directory. The value of a key is only read
+// when its size is asked for.
+type dirEntry struct {
+	fsys *FS
+	key  string
+	dir  bool
+}
+
+func (e *dirEntry) Name() string      { return path.Base(e.key) }
+func (e *dirEntry) IsDir() bool       { return e.dir }
+func (e *dirEntry) Type() fs.FileMode { return e.info().Mode().Type() }
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	fi := e.info()
+	if e.dir {
+		return fi, nil
+	}
+	val, err := e.fsys.s.Get(e.key)
+	if err != nil {
+		return nil, err
+	}
+	fi.size = int64(len(val))
+	return fi, nil
+}
+
+func (e *dirEntry) info() fileInfo {
+	return fileInfo{name: path.Base(e.key), dir: e.dir}
+}
+
+// file is an open key. Its value is read when opened, so it can be
+// seeked as http.FileServer requires.
+type file struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// dir is an open directory
+type dir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	off     int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: `read`, Path: d.info.name, Err: errIsDir}
+}
+
+// ReadDir lists the next n entries of the directory, or all the rest
+// if n is zero or less
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.off:]
+	if n <= 0 {
+		d.off = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.off += n
+	return rest[:n], nil
+}
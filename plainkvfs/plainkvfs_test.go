@@ -0,0 +1,37 @@
+package plainkvfs_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/narsilworks/plainkv/memplainkv"
+	"github.com/narsilworks/plainkv/plainkvfs"
+)
+
+func TestFS(t *testing.T) {
+	kv := memplainkv.NewMemPlainKV()
+	kv.Open()
+	kv.Set(`index.html`, []byte(`<p>home</p>`))
+	kv.Set(`css/site.css`, []byte(`p {}`))
+	kv.Set(`img/a/logo.svg`, []byte(`<svg/>`))
+	kv.SetMime(`css/site.css`, `text/css`)
+
+	fsys := plainkvfs.FromStore(kv)
+	if err := fstest.TestFS(fsys, `index.html`, `css/site.css`, `img/a/logo.svg`); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	fsys.FileServer().ServeHTTP(rec, httptest.NewRequest(`GET`, `/css/site.css`, nil))
+	body, _ := io.ReadAll(rec.Body)
+	if ct := rec.Header().Get(`Content-Type`); ct != `text/css` || string(body) != `p {}` {
+		t.Logf(`Expected the stored MIME type and value, got %q %q`, ct, body)
+		t.Fail()
+	}
+	if _, err := fsys.Open(`missing`); err == nil {
+		t.Logf(`Expected a missing key to fail`)
+		t.Fail()
+	}
+}
@@ -0,0 +1,96 @@
+package plainkvresp
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusOK and StatusError tell whether a command replied with an error
+	StatusOK    string = `OK`
+	StatusError string = `ERR`
+)
+
+// AccessEntry records a command a client ran. Values are not recorded.
+type AccessEntry struct {
+	Time      time.Time     `json:"time"`
+	Principal string        `json:"principal"`     // Address of the client, as RESP is not authenticated
+	Method    string        `json:"method"`        // Command, in upper case
+	Bucket    string        `json:"bucket"`        // Bucket served. Empty is the default bucket
+	Key       string        `json:"key,omitempty"` // First key or pattern of the command, if any
+	Status    string        `json:"status"`        // StatusOK or StatusError
+	Bytes     int64         `json:"bytes"`         // Size of the reply
+	Latency   time.Duration `json:"latency"`
+	Err       string        `json:"err,omitempty"`
+}
+
+// AccessLogger receives the entries of an access log. LogAccess is
+// called on the goroutine serving the client, so it must be safe for
+// concurrent use and should not block.
+type AccessLogger interface {
+	LogAccess(e AccessEntry)
+}
+
+// AccessLogFunc adapts a function to an AccessLogger
+type AccessLogFunc func(e AccessEntry)
+
+// LogAccess calls f(e)
+func (f AccessLogFunc) LogAccess(e AccessEntry) {
+	f(e)
+}
+
+// jsonLog writes entries as JSON Lines
+type jsonLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAccessLog returns an AccessLogger writing each entry to w as a
+// line of JSON. Write errors are ignored.
+func NewJSONAccessLog(w io.Writer) AccessLogger {
+	return &jsonLog{enc: json.NewEncoder(w)}
+}
+
+func (l *jsonLog) LogAccess(e AccessEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(e)
+}
+
+// entry builds the access log entry of a command
+func entry(start time.Time, addr net.Addr, bucket string, args []string, n int64, err error) AccessEntry {
+	e := AccessEntry{
+		Time:    start,
+		Method:  strings.ToUpper(args[0]),
+		Bucket:  bucket,
+		Status:  StatusOK,
+		Bytes:   n,
+		Latency: time.Since(start),
+	}
+	if addr != nil {
+		e.Principal = addr.String()
+	}
+	if len(args) > 1 && e.Method != `PING` {
+		e.Key = args[1]
+	}
+	if err != nil {
+		e.Status, e.Err = StatusError, err.Error()
+	}
+	return e
+}
+
+// countWriter counts the bytes written through it
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,445 @@
+// Package plainkvresp serves a MyPlainKV over the Redis protocol (RESP),
+// so redis-cli and Redis client libraries can use the store while
+// applications migrate. It implements GET, SET, DEL, EXISTS, INCR, KEYS,
+// SCAN, EXPIRE and TTL, along with PING, QUIT and the COMMAND probe
+// clients send on connect. SCAN pages through the keys in key order,
+// without the duplicates Redis may return. Commands can be logged to an
+// access log.
+package plainkvresp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	myplainkv "github.com/narsilworks/plainkv"
+)
+
+const (
+	// maxBulk is the largest argument a client may send, the size of
+	// the largest value MyPlainKV stores without chunking
+	maxBulk int = 16<<20 - 1
+
+	// defIdleTimeout is how long a client may stay idle when IdleTimeout
+	// is zero
+	defIdleTimeout time.Duration = 5 * time.Minute
+
+	// maxArgs is the most arguments a command may have
+	maxArgs int = 1 << 16
+)
+
+var (
+	ErrProtocol error = errors.New(`protocol error`)
+)
+
+// arity is the least number of arguments of each command served
+var arity = map[string]int{
+	`PING`: 0, `QUIT`: 0, `COMMAND`: 0,
+	`GET`: 1, `SET`: 2, `DEL`: 1, `EXISTS`: 1,
+	`INCR`: 1, `KEYS`: 1, `SCAN`: 1, `EXPIRE`: 2, `TTL`: 1,
+}
+
+// Server serves the keys of one bucket over RESP
+type Server struct {
+	Bucket      string        // Bucket the keys live in. Empty uses the default bucket
+	AccessLog   AccessLogger  // Receives an entry for every command run. Nil disables
+	IdleTimeout time.Duration // Drop clients sending nothing for this long. Zero means 5 minutes, negative means never
+	kv          *myplainkv.MyPlainKV
+}
+
+// NewServer returns a server for the store
+func NewServer(kv *myplainkv.MyPlainKV) *Server {
+	return &Server{kv: kv}
+}
+
+// ListenAndServe listens on the TCP address and serves clients until
+// listening fails
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen(`tcp`, addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
+
+// Serve accepts clients on the listener until it is closed. Each command
+// runs on a session of its own, so clients do not wait on each other,
+// and idle clients hold no database connection.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(nc)
+	}
+}
+
+// serveConn runs the commands of one client until it quits or drops
+func (s *Server) serveConn(nc net.Conn) {
+	defer nc.Close()
+	cw := &countWriter{w: nc}
+	w := bufio.NewWriter(cw)
+	var sc scanCursors
+	r := bufio.NewReader(nc)
+	idle := s.IdleTimeout
+	if idle == 0 {
+		idle = defIdleTimeout
+	}
+	for {
+		if idle > 0 {
+			nc.SetReadDeadline(time.Now().Add(idle))
+		}
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, ErrProtocol) {
+				writeError(w, err)
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := strings.EqualFold(args[0], `QUIT`)
+		start, sent := time.Now(), cw.n+int64(w.Buffered())
+		c := s.kv.Session()
+		c.SetBucket(s.Bucket)
+		err = run(c, &sc, w, args)
+		c.Close()
+		if s.AccessLog != nil {
+			s.AccessLog.LogAccess(entry(start, nc.RemoteAddr(), s.Bucket, args,
+				cw.n+int64(w.Buffered())-sent, err))
+		}
+		// Replies are only flushed once the pipeline is drained
+		if r.Buffered() == 0 || quit {
+			if err = w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// run executes a command and writes its reply, returning the error it
+// replied with
+func run(c *myplainkv.MyPlainKV, sc *scanCursors, w *bufio.Writer, args []string) error {
+	cmd, args := strings.ToUpper(args[0]), args[1:]
+	need, ok := arity[cmd]
+	if !ok {
+		return writeError(w, fmt.Errorf(`unknown command '%s'`, cmd))
+	}
+	if len(args) < need {
+		return writeError(w, fmt.Errorf(`wrong number of arguments for '%s' command`, strings.ToLower(cmd)))
+	}
+	switch cmd {
+	case `PING`:
+		if len(args) > 0 {
+			writeBulk(w, []byte(args[0]))
+			return nil
+		}
+		w.WriteString("+PONG\r\n")
+	case `QUIT`:
+		w.WriteString("+OK\r\n")
+	case `COMMAND`:
+		// Clients only probe for the command table, which is not served
+		w.WriteString("*0\r\n")
+	case `GET`:
+		val, err := c.Get(args[0])
+		if err == nil && len(val) == 0 {
+			// An empty value and a missing key read the same
+			var ok bool
+			if ok, err = c.Exists(args[0]); err == nil && !ok {
+				val = nil
+			}
+		}
+		if err != nil {
+			return writeError(w, err)
+		}
+		writeBulk(w, val)
+	case `SET`:
+		return set(c, w, args)
+	case `DEL`:
+		n, err := each(args, func(key string) (bool, error) {
+			ok, err := c.Exists(key)
+			if err != nil || !ok {
+				return false, err
+			}
+			return true, c.Del(key)
+		})
+		return writeInt(w, n, err)
+	case `EXISTS`:
+		n, err := each(args, c.Exists)
+		return writeInt(w, n, err)
+	case `INCR`:
+		n, err := c.TallyIncrBy(args[0], 1)
+		return writeInt(w, n, err)
+	case `KEYS`:
+		keys, err := c.ListKeys(globPrefix(args[0]))
+		if err != nil {
+			return writeError(w, err)
+		}
+		val := make([]string, 0, len(keys))
+		for _, k := range keys {
+			if globMatch(k, args[0]) {
+				val = append(val, k)
+			}
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(val))
+		for _, k := range val {
+			writeBulk(w, []byte(k))
+		}
+	case `SCAN`:
+		return scan(c, sc, w, args)
+	case `EXPIRE`:
+		secs, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return writeError(w, errors.New(`value is not an integer or out of range`))
+		}
+		ok, err := c.Expire(args[0], time.Duration(secs)*time.Second)
+		return writeInt(w, boolInt(ok), err)
+	case `TTL`:
+		d, err := c.TTL(args[0])
+		switch {
+		case err != nil:
+		case d == myplainkv.TTLNone:
+			d = -1
+		case d == myplainkv.TTLMissing:
+			d = -2
+		default:
+			d = (d + time.Second - 1) / time.Second
+		}
+		return writeInt(w, int64(d), err)
+	}
+	return nil
+}
+
+// set runs SET key value [EX seconds|PX milliseconds] [NX]
+func set(c *myplainkv.MyPlainKV, w *bufio.Writer, args []string) error {
+	var (
+		ttl time.Duration
+		nx  bool
+	)
+	key, val := args[0], []byte(args[1])
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == `NX`:
+			nx = true
+		case (opt == `EX` || opt == `PX`) && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return writeError(w, errors.New(`invalid expire time in 'set' command`))
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if opt == `EX` {
+				ttl *= 1000
+			}
+			i++
+		default:
+			return writeError(w, errors.New(`syntax error`))
+		}
+	}
+	var err error
+	switch {
+	case nx:
+		ok := true
+		if ttl > 0 {
+			// The expiry is set in the same transaction, so the key is
+			// never seen without it
+			err = c.WithTransaction(context.Background(), func(tx *myplainkv.Tx) error {
+				var err error
+				if ok, err = tx.SetNX(key, val); err != nil || !ok {
+					return err
+				}
+				_, err = tx.Expire(key, ttl)
+				return err
+			})
+		} else {
+			ok, err = c.SetNX(key, val)
+		}
+		if err == nil && !ok {
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+	case ttl > 0:
+		err = c.SetWithTTL(key, val, ttl)
+	default:
+		err = c.Set(key, val)
+	}
+	if err != nil {
+		return writeError(w, err)
+	}
+	w.WriteString("+OK\r\n")
+	return nil
+}
+
+// each counts the keys for which fn reports true
+func each(keys []string, fn func(key string) (bool, error)) (int64, error) {
+	var n int64
+	for _, k := range keys {
+		ok, err := fn(k)
+		if err != nil {
+			return n, err
+		}
+		n += boolInt(ok)
+	}
+	return n, nil
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// readCommand reads a command as an array of bulk strings, or as an
+// inline line of space-separated words as typed into telnet
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, `*`) {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, ErrProtocol
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if line, err = readLine(r); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, `$`) {
+			return nil, ErrProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulk {
+			return nil, ErrProtocol
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if string(buf[size:]) != "\r\n" {
+			return nil, ErrProtocol
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line without its CRLF
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+func writeBulk(w *bufio.Writer, val []byte) {
+	if val == nil {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n", len(val))
+	w.Write(val)
+	w.WriteString("\r\n")
+}
+
+func writeInt(w *bufio.Writer, n int64, err error) error {
+	if err != nil {
+		return writeError(w, err)
+	}
+	fmt.Fprintf(w, ":%d\r\n", n)
+	return nil
+}
+
+// writeError writes an error reply and returns the error
+func writeError(w *bufio.Writer, err error) error {
+	// Error replies end at the first line break
+	msg := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+	fmt.Fprintf(w, "-ERR %s\r\n", msg)
+	return err
+}
+
+// globPrefix returns the literal prefix of a glob pattern, for ListKeys
+// to narrow the keys to match. LIKE wildcards in it only widen the
+// match, and the keys are matched against the whole pattern afterwards.
+func globPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// globMatch matches s against a Redis glob pattern, where * matches
+// any run of characters, ? matches one, [...] matches a class and \
+// escapes the next character
+func globMatch(s, pattern string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if globMatch(s[i:], pattern[1:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 || len(s) == 0 || !classMatch(s[0], pattern[1:end+1]) {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		s, pattern = s[1:], pattern[1:]
+	}
+	return len(s) == 0
+}
+
+// classMatch matches a byte against the inside of a [...] class, with
+// ^ negating it and a-z ranges
+func classMatch(c byte, class string) bool {
+	neg := strings.HasPrefix(class, `^`)
+	if neg {
+		class = class[1:]
+	}
+	match := false
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			if class[i] <= c && c <= class[i+2] {
+				match = true
+			}
+			i += 2
+			continue
+		}
+		if class[i] == c {
+			match = true
+		}
+	}
+	return match != neg
+}
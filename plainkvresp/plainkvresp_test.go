@@ -0,0 +1,145 @@
+package plainkvresp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCommand(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\na b\r\n\r\nGET k\r\n*1\r\n$2\r\nPING\r\n"))
+	args, err := readCommand(r)
+	if err != nil || len(args) != 3 || args[2] != "a b\r\n" {
+		t.Logf(`Expected SET with a binary value, got %q (%v)`, args, err)
+		t.Fail()
+	}
+	args, err = readCommand(r)
+	if err != nil || strings.Join(args, ` `) != `GET k` {
+		t.Logf(`Expected an inline GET, got %q (%v)`, args, err)
+		t.Fail()
+	}
+	if _, err = readCommand(r); err != ErrProtocol {
+		t.Logf(`Expected a protocol error for a short bulk string, got %v`, err)
+		t.Fail()
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		s, pattern string
+		match      bool
+	}{
+		{`user:1`, `user:*`, true},
+		{`user:1`, `user:?`, true},
+		{`user:10`, `user:?`, false},
+		{`hallo`, `h[ae]llo`, true},
+		{`hillo`, `h[^e]llo`, true},
+		{`hbllo`, `h[a-c]llo`, true},
+		{`h*llo`, `h\*llo`, true},
+		{`hello`, `h\*llo`, false},
+	}
+	for _, c := range cases {
+		if globMatch(c.s, c.pattern) != c.match {
+			t.Logf(`Expected globMatch(%q, %q) to be %v`, c.s, c.pattern, c.match)
+			t.Fail()
+		}
+	}
+	if p := globPrefix(`user:*`); p != `user:` {
+		t.Logf(`Expected prefix user:, got %q`, p)
+		t.Fail()
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSONAccessLog(&buf)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 6379}
+	start := time.Now()
+	l.LogAccess(entry(start, addr, `users`, []string{`get`, `u:1`}, 11, nil))
+	l.LogAccess(entry(start, addr, ``, []string{`SET`, `u:1`, `secret`}, 30, errors.New(`down`)))
+	l.LogAccess(entry(start, addr, ``, []string{`PING`, `hello`}, 11, nil))
+
+	raw := buf.String()
+	var got []AccessEntry
+	dec := json.NewDecoder(strings.NewReader(raw))
+	for dec.More() {
+		var e AccessEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 3 {
+		t.Fatalf(`Expected 3 entries, got %d`, len(got))
+	}
+	if e := got[0]; e.Method != `GET` || e.Key != `u:1` || e.Bucket != `users` || e.Status != StatusOK ||
+		e.Bytes != 11 || e.Principal != `127.0.0.1:6379` {
+		t.Logf(`Unexpected GET entry %+v`, e)
+		t.Fail()
+	}
+	if e := got[1]; e.Status != StatusError || e.Err != `down` || e.Key != `u:1` {
+		t.Logf(`Unexpected SET entry %+v`, e)
+		t.Fail()
+	}
+	if strings.Contains(raw, `secret`) {
+		t.Logf(`Expected values to be left out of the log`)
+		t.Fail()
+	}
+	if e := got[2]; e.Key != `` {
+		t.Logf(`Expected no key for PING, got %q`, e.Key)
+		t.Fail()
+	}
+}
+
+func TestScanCursors(t *testing.T) {
+	var sc scanCursors
+	if tok, ok := sc.token(`0`); !ok || tok != "" {
+		t.Logf(`Expected cursor 0 to start a scan, got %q`, tok)
+		t.Fail()
+	}
+	if n := sc.cursor(""); n != 0 {
+		t.Logf(`Expected the end of a scan to be cursor 0, got %d`, n)
+		t.Fail()
+	}
+	n := sc.cursor(`tok1`)
+	if tok, ok := sc.token(strconv.FormatUint(n, 10)); !ok || tok != `tok1` {
+		t.Logf(`Expected cursor %d to map to its token, got %q`, n, tok)
+		t.Fail()
+	}
+	for _, c := range []string{`12345`, `abc`, `-1`} {
+		if _, ok := sc.token(c); ok {
+			t.Logf(`Expected cursor %s to be invalid`, c)
+			t.Fail()
+		}
+	}
+	for i := 0; i < maxCursors; i++ {
+		sc.cursor(`tok`)
+	}
+	if len(sc.tokens) > maxCursors {
+		t.Logf(`Expected at most %d cursors, got %d`, maxCursors, len(sc.tokens))
+		t.Fail()
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	s := &Server{IdleTimeout: 20 * time.Millisecond}
+	done := make(chan struct{})
+	go func() {
+		s.serveConn(server)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Logf(`Expected an idle client to be dropped`)
+		t.Fail()
+	}
+}
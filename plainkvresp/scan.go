@@ -0,0 +1,100 @@
+package plainkvresp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	myplainkv "github.com/narsilworks/plainkv"
+)
+
+const (
+	// defScanCount is the number of keys SCAN reads without COUNT
+	defScanCount int = 10
+
+	// maxCursors is the most SCAN cursors a client holds. Past it, the
+	// cursors of abandoned scans are dropped along with the others.
+	maxCursors int = 1024
+)
+
+// scanCursors maps the cursors SCAN hands a client to the page tokens
+// of ListKeysPage. Redis clients expect cursors to be numbers, which
+// tokens are not, so cursors are only valid on the connection that got
+// them.
+type scanCursors struct {
+	tokens map[uint64]string
+	last   uint64
+}
+
+// token returns the page token of a cursor. Cursor 0 starts a scan.
+func (sc *scanCursors) token(cursor string) (string, bool) {
+	n, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	if n == 0 {
+		return "", true
+	}
+	tok, ok := sc.tokens[n]
+	return tok, ok
+}
+
+// cursor returns a new cursor for a page token, or 0 for the empty token
+// ending a scan
+func (sc *scanCursors) cursor(token string) uint64 {
+	if token == "" {
+		return 0
+	}
+	if sc.tokens == nil || len(sc.tokens) >= maxCursors {
+		sc.tokens = make(map[uint64]string)
+	}
+	sc.last++
+	sc.tokens[sc.last] = token
+	return sc.last
+}
+
+// scan runs SCAN cursor [MATCH pattern] [COUNT count]. As in Redis, a
+// page may hold fewer keys than COUNT, or none, before the scan ends.
+func scan(c *myplainkv.MyPlainKV, sc *scanCursors, w *bufio.Writer, args []string) error {
+	match, count := `*`, defScanCount
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return writeError(w, errors.New(`syntax error`))
+		}
+		switch strings.ToUpper(args[i]) {
+		case `MATCH`:
+			match = args[i+1]
+		case `COUNT`:
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return writeError(w, errors.New(`value is not an integer or out of range`))
+			}
+			count = n
+		default:
+			return writeError(w, errors.New(`syntax error`))
+		}
+	}
+	token, ok := sc.token(args[0])
+	if !ok {
+		return writeError(w, errors.New(`invalid cursor`))
+	}
+	keys, next, err := c.ListKeysPage(globPrefix(match), token, count)
+	if err != nil {
+		return writeError(w, err)
+	}
+	val := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if globMatch(k, match) {
+			val = append(val, k)
+		}
+	}
+	w.WriteString("*2\r\n")
+	writeBulk(w, []byte(strconv.FormatUint(sc.cursor(next), 10)))
+	fmt.Fprintf(w, "*%d\r\n", len(val))
+	for _, k := range val {
+		writeBulk(w, []byte(k))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Package plainkvtest provides fixtures and assertions for testing
+// applications built on myplainkv
+package plainkvtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	myplainkv "github.com/narsilworks/plainkv"
+)
+
+// LoadDir loads a fixture directory into the store. Each top-level
+// directory is a bucket, and each file below it is a key, named by its
+// slash-separated path relative to the bucket directory. The loaded
+// buckets are truncated when the test completes, even if loading fails
+// partway.
+func LoadDir(t testing.TB, kv *myplainkv.MyPlainKV, dir string) {
+	t.Helper()
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf(`reading fixtures: %s`, err)
+	}
+	for _, e := range ents {
+		if !e.IsDir() {
+			continue
+		}
+		bucket := e.Name()
+		truncateOnCleanup(t, kv, bucket)
+		b := kv.Bucket(bucket)
+		root := filepath.Join(dir, bucket)
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			val, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return b.Set(filepath.ToSlash(rel), val)
+		})
+		if err != nil {
+			t.Fatalf(`loading bucket %s: %s`, bucket, err)
+		}
+	}
+}
+
+// LoadJSON loads a JSON fixture file into the store. The file holds an
+// object of buckets, each an object of keys with string values:
+//
+//	{"sessions": {"abc": "{\"user\":1}"}}
+//
+// The loaded buckets are truncated when the test completes, even if
+// loading fails partway.
+func LoadJSON(t testing.TB, kv *myplainkv.MyPlainKV, path string) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf(`reading fixtures: %s`, err)
+	}
+	var fix map[string]map[string]string
+	if err = json.Unmarshal(raw, &fix); err != nil {
+		t.Fatalf(`parsing fixtures %s: %s`, path, err)
+	}
+	for bucket, kvs := range fix {
+		truncateOnCleanup(t, kv, bucket)
+		b := kv.Bucket(bucket)
+		for k, v := range kvs {
+			if err = b.Set(k, []byte(v)); err != nil {
+				t.Fatalf(`loading %s/%s: %s`, bucket, k, err)
+			}
+		}
+	}
+}
+
+// Truncate deletes every key in the buckets
+func Truncate(t testing.TB, kv *myplainkv.MyPlainKV, buckets ...string) {
+	t.Helper()
+	for _, bucket := range buckets {
+		b := kv.Bucket(bucket)
+		keys, err := b.ListKeys("")
+		if err != nil {
+			t.Fatalf(`listing bucket %s: %s`, bucket, err)
+		}
+		for _, k := range keys {
+			if err = b.Del(k); err != nil {
+				t.Fatalf(`deleting %s/%s: %s`, bucket, k, err)
+			}
+		}
+	}
+}
+
+// AssertKeyEquals fails the test if the value of the key differs from want
+func AssertKeyEquals(t testing.TB, kv *myplainkv.MyPlainKV, bucket, key string, want []byte) {
+	t.Helper()
+	got, err := kv.Bucket(bucket).Get(key)
+	if err != nil {
+		t.Errorf(`getting %s/%s: %s`, bucket, key, err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf(`%s/%s = %q, want %q`, bucket, key, got, want)
+	}
+}
+
+// AssertBucketCount fails the test if the bucket does not hold n keys
+func AssertBucketCount(t testing.TB, kv *myplainkv.MyPlainKV, bucket string, n int) {
+	t.Helper()
+	keys, err := kv.Bucket(bucket).ListKeys("")
+	if err != nil {
+		t.Errorf(`listing bucket %s: %s`, bucket, err)
+		return
+	}
+	if len(keys) != n {
+		t.Errorf(`bucket %s holds %d keys, want %d`, bucket, len(keys), n)
+	}
+}
+
+// truncateOnCleanup truncates the bucket when the test completes. It is
+// registered before the bucket is written, so the keys of a load failing
+// midway are not left behind.
+func truncateOnCleanup(t testing.TB, kv *myplainkv.MyPlainKV, bucket string) {
+	t.Cleanup(func() {
+		Truncate(t, kv, bucket)
+	})
+}
@@ -0,0 +1,111 @@
+package plainkvtest_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	myplainkv "github.com/narsilworks/plainkv"
+	"github.com/narsilworks/plainkv/plainkvtest"
+)
+
+func testKV(t *testing.T) *myplainkv.MyPlainKV {
+	dsn := os.Getenv(`PLAINKV_TEST_DSN`)
+	if dsn == "" {
+		t.Skip(`PLAINKV_TEST_DSN is not set`)
+	}
+	kv := myplainkv.NewMyPlainKV(dsn, false)
+	if err := kv.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { kv.Close() })
+	return kv
+}
+
+// recorder runs the cleanups of a test on demand, and records failures
+// instead of stopping
+type recorder struct {
+	testing.TB
+	cleanups []func()
+	failed   bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Cleanup(fn func()) {
+	r.cleanups = append(r.cleanups, fn)
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.failed = true
+	r.Logf(format, args...)
+}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failed = true
+	r.Logf(format, args...)
+}
+
+func (r *recorder) finish() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	kv := testKV(t)
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, `fixtures`, `users`), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, `fixtures`, `users`, `1`), []byte(`ann`), 0o644)
+	os.WriteFile(filepath.Join(dir, `fixtures`, `top`), []byte(`x`), 0o644)
+
+	r := &recorder{TB: t}
+	plainkvtest.LoadDir(r, kv, dir)
+	plainkvtest.AssertKeyEquals(r, kv, `fixtures`, `users/1`, []byte(`ann`))
+	plainkvtest.AssertKeyEquals(r, kv, `fixtures`, `top`, []byte(`x`))
+	plainkvtest.AssertBucketCount(r, kv, `fixtures`, 2)
+	r.finish()
+	if r.failed {
+		t.Fail()
+	}
+	plainkvtest.AssertBucketCount(t, kv, `fixtures`, 0)
+}
+
+func TestLoadJSON(t *testing.T) {
+	kv := testKV(t)
+	path := filepath.Join(t.TempDir(), `fixtures.json`)
+	os.WriteFile(path, []byte(`{"fixtures": {"a": "1", "b": "2"}}`), 0o644)
+
+	r := &recorder{TB: t}
+	plainkvtest.LoadJSON(r, kv, path)
+	plainkvtest.AssertKeyEquals(r, kv, `fixtures`, `a`, []byte(`1`))
+	plainkvtest.AssertBucketCount(r, kv, `fixtures`, 2)
+	r.finish()
+	if r.failed {
+		t.Fail()
+	}
+	plainkvtest.AssertBucketCount(t, kv, `fixtures`, 0)
+}
+
+// TestLoadJSONPartial checks that the keys of a load failing midway are
+// truncated with the rest
+func TestLoadJSONPartial(t *testing.T) {
+	kv := testKV(t)
+	path := filepath.Join(t.TempDir(), `fixtures.json`)
+	// Keys longer than 300 bytes cannot be stored
+	long := strings.Repeat(`k`, 301)
+	os.WriteFile(path, []byte(fmt.Sprintf(`{"fixtures": {"a": "1", "b": "2", %q: "3"}}`, long)), 0o644)
+
+	r := &recorder{TB: t}
+	plainkvtest.LoadJSON(r, kv, path)
+	if !r.failed {
+		t.Logf(`Expected the load to fail on the long key`)
+		t.Fail()
+	}
+	r.finish()
+	plainkvtest.AssertBucketCount(t, kv, `fixtures`, 0)
+}
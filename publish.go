@@ -0,0 +1,97 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+)
+
+const (
+	latestSuffix string = `@latest`
+	revSuffix    string = `@rev`
+)
+
+var (
+	ErrRevNotFound error = errors.New(`revision not found`)
+)
+
+// revKey returns the key a revision of a published key is stored under
+func revKey(key string, rev int) string {
+	return key + `@` + strconv.Itoa(rev)
+}
+
+// Publish stores value as the next revision of key, under key@<rev>,
+// and points key@latest to it in the same transaction.
+// It returns the revision number.
+func (p *MyPlainKV) Publish(key string, value []byte) (int, error) {
+	return p.publish(p.currBuckt, key, value)
+}
+
+// GetLatest retrieves the latest published revision of a key
+func (p *MyPlainKV) GetLatest(key string) ([]byte, error) {
+	return p.getKey(p.currBuckt, key+latestSuffix)
+}
+
+// GetRev retrieves a published revision of a key
+func (p *MyPlainKV) GetRev(key string, rev int) ([]byte, error) {
+	return p.getKey(p.currBuckt, revKey(key, rev))
+}
+
+// PromoteRev points key@latest to an existing revision of a key,
+// rolling a publish forward or back
+func (p *MyPlainKV) PromoteRev(key string, rev int) error {
+	return p.promoteRev(p.currBuckt, key, rev)
+}
+
+func (p *MyPlainKV) publish(bucket, key string, value []byte) (int, error) {
+	var rev int
+	err := p.atomic(func() error {
+		var err error
+		if rev, err = p.tallyIncr(bucket, key+revSuffix); err != nil {
+			return err
+		}
+		if err = p.set(bucket, revKey(key, rev), value); err != nil {
+			return err
+		}
+		return p.alias(bucket, key+latestSuffix, revKey(key, rev))
+	})
+	if err != nil {
+		return -1, err
+	}
+	return rev, nil
+}
+
+func (p *MyPlainKV) promoteRev(bucket, key string, rev int) error {
+	return p.atomic(func() error {
+		found, err := p.getRaw(bucket, revKey(key, rev), func(sql.RawBytes) error {
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrRevNotFound
+		}
+		return p.alias(bucket, key+latestSuffix, revKey(key, rev))
+	})
+}
+
+// Publish stores value as the next revision of key in the bucket
+func (b *Bucket) Publish(key string, value []byte) (int, error) {
+	return b.kv.publish(b.name, key, value)
+}
+
+// GetLatest retrieves the latest published revision of a key in the bucket
+func (b *Bucket) GetLatest(key string) ([]byte, error) {
+	return b.kv.getKey(b.name, key+latestSuffix)
+}
+
+// GetRev retrieves a published revision of a key in the bucket
+func (b *Bucket) GetRev(key string, rev int) ([]byte, error) {
+	return b.kv.getKey(b.name, revKey(key, rev))
+}
+
+// PromoteRev points key@latest to an existing revision of a key in the bucket
+func (b *Bucket) PromoteRev(key string, rev int) error {
+	return b.kv.promoteRev(b.name, key, rev)
+}
@@ -0,0 +1,101 @@
+package myplainkv
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	rateBuckt string = `--ratelimit--`
+)
+
+// RateLimiter enforces per-key request limits over a sliding window,
+// with counters stored in the store so that every instance sharing it
+// sees the same counts. It is safe for concurrent use.
+type RateLimiter struct {
+	FailClosed bool // Deny requests when the store fails. By default they are allowed
+
+	kv  *MyPlainKV
+	mu  sync.Mutex // Guards err
+	err error
+}
+
+// NewRateLimiter creates a RateLimiter keeping its counters in the
+// store of kv, on a connection pool of its own. Counters expire exactly
+// when due, whatever the TTLJitter of kv, and keep counting while the
+// store is in maintenance.
+func NewRateLimiter(kv *MyPlainKV) *RateLimiter {
+	lk := kv.detached()
+	// A counter expiring early loses its count
+	lk.TTLJitter = 0
+	return &RateLimiter{
+		kv: lk,
+	}
+}
+
+// Allow counts a request for key and reports whether it is within limit
+// requests per window. The window slides: the count of the previous
+// window is weighted by how much of it still overlaps the current one.
+// Denied requests are not counted. Each call runs on a session of its
+// own, so calls do not wait on each other; the counters are updated
+// atomically in the store.
+func (r *RateLimiter) Allow(key string, limit int, window time.Duration) bool {
+	s := r.kv.Session()
+	defer s.Close()
+	ok, err := allow(s, key, limit, window, time.Now())
+	if err != nil {
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+		return !r.FailClosed
+	}
+	return ok
+}
+
+// Err returns the last error met counting requests
+func (r *RateLimiter) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close closes the connection pool of the limiter
+func (r *RateLimiter) Close() error {
+	return r.kv.Close()
+}
+
+func allow(kv *MyPlainKV, key string, limit int, window time.Duration, now time.Time) (bool, error) {
+	if window <= 0 || limit <= 0 {
+		return false, nil
+	}
+	idx := now.UnixNano() / int64(window)
+	curKey := key + `#` + strconv.FormatInt(idx, 10)
+	prevKey := key + `#` + strconv.FormatInt(idx-1, 10)
+
+	cur, err := kv.tallyAdd(rateBuckt, curKey, 1)
+	if err != nil {
+		return false, err
+	}
+	if cur == 1 {
+		// The counter is only needed while it overlaps the next window
+		if _, err = kv.expire(rateBuckt, fmt.Sprintf(tallyKey, curKey), 2*window); err != nil {
+			return false, err
+		}
+	}
+	// Reading the previous counter must not create it
+	val, err := kv.get(rateBuckt, fmt.Sprintf(tallyKey, prevKey))
+	if err != nil {
+		return false, err
+	}
+	prev, _ := strconv.ParseInt(string(val), 10, 64)
+	elapsed := float64(now.UnixNano()%int64(window)) / float64(window)
+	if float64(prev)*(1-elapsed)+float64(cur) <= float64(limit) {
+		return true, nil
+	}
+	if _, err = kv.tallyAdd(rateBuckt, curKey, -1); err != nil {
+		return false, err
+	}
+	return false, nil
+}
@@ -0,0 +1,209 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"io"
+	"time"
+)
+
+// getRaw looks up a record and passes its value to fn without copying it.
+// The value is only valid for the duration of fn. Values stored in parts
+// are passed one part at a time, so fn must append what it receives.
+// Aliases are followed to their target. It reports whether the record
+// was found.
+func (p *MyPlainKV) getRaw(bucket, key string, fn func(val sql.RawBytes) error) (found bool, err error) {
+	var (
+		manifest []byte
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return false, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if v := p.shared().views.get(bucket); v != nil {
+		return p.getView(v, key, fn)
+	}
+	if p.MissTTL > 0 && p.shared().misses.has(bucket, key) {
+		p.record(start, 0)
+		return false, nil
+	}
+	if found, key, manifest, err = p.resolve(bucket, key, fn); err != nil {
+		return found, err
+	}
+	if !found {
+		p.record(start, 0)
+		return false, nil
+	}
+	if manifest != nil {
+		if err = p.readChunks(bucket, key, manifest, fn); err != nil {
+			return true, err
+		}
+	}
+	if p.AccessResolution > 0 {
+		p.touch(bucket, key)
+	}
+	if p.KeyStatsSample > 0 {
+		p.hit(bucket, key, false)
+	}
+	p.record(start, 1)
+	return true, nil
+}
+
+// resolve follows the aliases of a key to its record. A plain value is
+// passed to fn. For a chunked value, the key holding it and its manifest
+// are returned for the caller to read the parts. Keys found missing are
+// remembered if MissTTL is set.
+func (p *MyPlainKV) resolve(bucket, key string, fn func(val sql.RawBytes) error) (bool, string, []byte, error) {
+	var (
+		err      error
+		found    bool
+		target   string
+		manifest []byte
+	)
+	first := key
+	seen := make(map[string]bool)
+	for {
+		if found, target, manifest, err = p.lookup(bucket, key, fn); err != nil {
+			return found, key, nil, err
+		}
+		if found {
+			return true, key, manifest, nil
+		}
+		if target == "" {
+			if p.MissTTL > 0 {
+				p.shared().misses.add(bucket, first, p.MissTTL)
+			}
+			return false, key, nil, nil
+		}
+		seen[key] = true
+		if seen[target] || len(seen) > maxAliasDepth {
+			return false, key, nil, ErrAliasLoop
+		}
+		key = target
+	}
+}
+
+// lookup reads a record together with its alias and chunk manifest in one
+// query. If the record holds a plain value, it is passed to fn. If it is
+// stored in parts, its manifest is returned for the caller to read them.
+// Otherwise, the target of the alias is returned, or an empty string if
+// the key is not an alias.
+func (p *MyPlainKV) lookup(bucket, key string, fn func(val sql.RawBytes) error) (bool, string, []byte, error) {
+	const (
+		rowValue int = iota
+		rowAlias
+		rowManifest
+	)
+	var (
+		err      error
+		sqr      *sql.Rows
+		kind     int
+		raw      sql.RawBytes
+		target   string
+		manifest []byte
+	)
+	// The bucket is compared in SQL so it follows the column's collation.
+	// Manifests sort first so a chunked value is known before it is read.
+	sqlstr := `
+	SELECT CASE WHEN Bucket=? THEN 0 WHEN Bucket=? THEN 1 ELSE 2 END AS Kind, Value
+	FROM ` + p.defTableName + `
+	WHERE Bucket IN (?, ?, ?) AND KeyID=? AND ` + notExpired + `
+	ORDER BY Kind DESC;`
+	ab, cb := aliasBucket(bucket), chunkBucket(bucket)
+	if sqr, err = p.query(sqlstr, bucket, ab, bucket, ab, cb, key); err != nil {
+		return false, "", nil, err
+	}
+	defer sqr.Close()
+	for sqr.Next() {
+		if err = sqr.Scan(&kind, &raw); err != nil {
+			return false, "", nil, err
+		}
+		switch kind {
+		case rowManifest:
+			manifest = append([]byte{}, raw...)
+		case rowAlias:
+			target = string(raw)
+		default:
+			// A value stored under the key takes precedence over its alias
+			if isManifest(raw, manifest) {
+				return true, "", manifest, nil
+			}
+			return true, "", nil, fn(raw)
+		}
+	}
+	if err = sqr.Err(); err != nil {
+		return false, "", nil, err
+	}
+	return false, target, nil, nil
+}
+
+// GetInto retrieves a record using a key and appends its value to buf,
+// returning the extended slice. Passing a reused buffer avoids
+// allocating a new slice on every call. On error, buf is returned as it
+// was passed.
+func (p *MyPlainKV) GetInto(key string, buf []byte) ([]byte, error) {
+	return p.getInto(p.currBuckt, key, buf)
+}
+
+func (p *MyPlainKV) getInto(bucket, key string, buf []byte) ([]byte, error) {
+	buf, found, err := p.appendValue(bucket, key, buf)
+	return buf, p.missing(found, err)
+}
+
+// appendValue appends the value of a key to buf and reports whether the
+// key was found. On error, buf is returned as it was passed, as a
+// chunked value failing verification has been read in part.
+func (p *MyPlainKV) appendValue(bucket, key string, buf []byte) ([]byte, bool, error) {
+	n := len(buf)
+	found, err := p.getRaw(bucket, key, func(val sql.RawBytes) error {
+		buf = append(buf, val...)
+		return nil
+	})
+	if err != nil {
+		return buf[:n], found, err
+	}
+	return buf, found, nil
+}
+
+// GetTo retrieves a record using a key and writes its value to w,
+// returning the number of bytes written. The value is written straight
+// from the driver's buffer, without being copied into a new slice first.
+// A value stored in chunks is streamed part by part and verified at the
+// end, so when GetTo fails with ErrChunkCorrupt, w has already received
+// the bytes counted. Use Get or GetInto to only see verified values.
+// In a bucket with an upgrader, the value is upgraded before it is
+// written.
+func (p *MyPlainKV) GetTo(key string, w io.Writer) (int64, error) {
+	return p.getTo(p.currBuckt, key, w)
+}
+
+func (p *MyPlainKV) getTo(bucket, key string, w io.Writer) (int64, error) {
+	var n int64
+	if p.shared().upgraders.get(p.bucket(bucket)) != nil {
+		val, err := p.getKey(bucket, key)
+		if err != nil {
+			return 0, err
+		}
+		c, err := w.Write(val)
+		return int64(c), err
+	}
+	found, err := p.getRaw(bucket, key, func(val sql.RawBytes) error {
+		c, err := w.Write(val)
+		n += int64(c)
+		return err
+	})
+	return n, p.missing(found, err)
+}
+
+// missing turns a lookup that found nothing into ErrKeyNotFound when
+// StrictNotFound is set
+func (p *MyPlainKV) missing(found bool, err error) error {
+	if err == nil && !found && p.StrictNotFound {
+		return ErrKeyNotFound
+	}
+	return err
+}
@@ -0,0 +1,167 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	tablePlaceholder string = `{table}`
+)
+
+var (
+	ErrQueryNotAllowed error = errors.New(`query not allowed`)
+)
+
+// QueryRaw runs a custom SELECT on the library's table using its
+// connection. The table may be written as {table}, which is replaced by
+// the configured table name. Only a single SELECT reading the library's
+// table is accepted; anything else fails with ErrQueryNotAllowed.
+// Quotes inside literals must be doubled rather than escaped with a
+// backslash.
+// The caller must close the returned rows.
+func (p *MyPlainKV) QueryRaw(tmpl string, args ...any) (*sql.Rows, error) {
+	sqlstr := strings.ReplaceAll(tmpl, tablePlaceholder, p.defTableName)
+	if err := checkSelect(sqlstr, p.defTableName); err != nil {
+		return nil, err
+	}
+	if err := p.Open(); err != nil {
+		return nil, err
+	}
+	// Rows outlive this call, so the connection is not auto-closed
+	return p.query(sqlstr, args...)
+}
+
+// checkSelect validates that a statement is a single read-only SELECT
+// whose table references all name the table. A table reference follows
+// FROM, JOIN, STRAIGHT_JOIN, or a comma in a FROM clause, and is either
+// the table, a parenthesized list of references, or a subquery, which
+// is checked as a SELECT of its own. Anything else in its place is
+// rejected, as are the TABLE and VALUES statements anywhere, which read
+// rows without a FROM clause.
+func checkSelect(sqlstr, table string) error {
+	toks := tokenize(sqlstr)
+	if n := len(toks); n > 0 && toks[n-1] == `;` {
+		toks = toks[:n-1]
+	}
+	// Separators and comments are only allowed inside literals, which
+	// the tokenizer keeps whole
+	for _, t := range toks {
+		switch t {
+		case `;`, `--`, `/*`, `#`:
+			return fmt.Errorf(`%w: contains %q`, ErrQueryNotAllowed, t)
+		}
+		// With NO_BACKSLASH_ESCAPES the server ends such a literal early,
+		// so where it ends is left in doubt
+		if q := t[0]; (q == '\'' || q == '"' || q == '`') && strings.Contains(t[1:], `\`+string(q)) {
+			return fmt.Errorf(`%w: escaped quote in %s`, ErrQueryNotAllowed, t)
+		}
+	}
+	if len(toks) == 0 || !strings.EqualFold(toks[0], `SELECT`) {
+		return fmt.Errorf(`%w: not a SELECT`, ErrQueryNotAllowed)
+	}
+	var (
+		depth  int
+		expect bool // A table reference comes next
+	)
+	// inFrom tells, by parenthesis depth, whether a FROM clause is open
+	inFrom := make(map[int]bool)
+	for i, t := range toks {
+		if expect {
+			expect = false
+			switch {
+			case t == `(` && i+1 < len(toks) && strings.EqualFold(toks[i+1], `SELECT`):
+				depth++
+				inFrom[depth] = false
+			case t == `(`:
+				depth++
+				inFrom[depth] = true
+				expect = true
+			case !strings.EqualFold(strings.Trim(t, "`"), table):
+				return fmt.Errorf(`%w: table %s`, ErrQueryNotAllowed, t)
+			}
+			continue
+		}
+		switch w := strings.ToUpper(t); w {
+		case `INTO`, `OUTFILE`, `DUMPFILE`, `LOAD_FILE`, `UPDATE`,
+			`SHARE`, `LOCK`, `SLEEP`, `BENCHMARK`, `GET_LOCK`,
+			// TABLE and VALUES read rows without a FROM clause
+			`TABLE`, `VALUES`:
+			return fmt.Errorf(`%w: %s`, ErrQueryNotAllowed, w)
+		case `FROM`:
+			inFrom[depth] = true
+			expect = true
+		case `JOIN`:
+			expect = true
+		case `STRAIGHT_JOIN`:
+			// Also a SELECT modifier, which no table follows
+			expect = inFrom[depth]
+		case `,`:
+			expect = inFrom[depth]
+		case `WHERE`, `GROUP`, `HAVING`, `ORDER`, `LIMIT`, `WINDOW`, `UNION`, `FOR`:
+			inFrom[depth] = false
+		case `(`:
+			depth++
+			inFrom[depth] = false
+		case `)`:
+			inFrom[depth] = false
+			depth--
+		}
+	}
+	if expect {
+		return fmt.Errorf(`%w: missing table`, ErrQueryNotAllowed)
+	}
+	return nil
+}
+
+// tokenize splits a statement into words and punctuation, keeping quoted
+// strings and backquoted identifiers whole. The comment openers -- and
+// /* are kept as one token.
+func tokenize(s string) []string {
+	var (
+		toks []string
+		cur  strings.Builder
+	)
+	flush := func() {
+		if cur.Len() > 0 {
+			toks = append(toks, cur.String())
+			cur.Reset()
+		}
+	}
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			flush()
+			j := i + 1
+			for j < len(rs) && rs[j] != r {
+				if rs[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(rs) {
+				j = len(rs) - 1
+			}
+			toks = append(toks, string(rs[i:j+1]))
+			i = j
+		case unicode.IsSpace(r):
+			flush()
+		case (r == '-' && i+1 < len(rs) && rs[i+1] == '-') || (r == '/' && i+1 < len(rs) && rs[i+1] == '*'):
+			flush()
+			toks = append(toks, string(rs[i:i+2]))
+			i++
+		case r == '_' || r == '$' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			cur.WriteRune(r)
+		default:
+			flush()
+			toks = append(toks, string(r))
+		}
+	}
+	flush()
+	return toks
+}
@@ -0,0 +1,60 @@
+package myplainkv
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckSelect(t *testing.T) {
+	allowed := []string{
+		`SELECT KeyID FROM KeyValueTBL WHERE Bucket = ?`,
+		`select Bucket, COUNT(*) from keyvaluetbl group by Bucket;`,
+		"SELECT a.KeyID FROM `KeyValueTBL` a JOIN KeyValueTBL b ON a.KeyID = b.KeyID",
+		`SELECT KeyID FROM KeyValueTBL AS k, KeyValueTBL m WHERE k.KeyID = m.KeyID`,
+		`SELECT x.KeyID FROM (SELECT KeyID FROM KeyValueTBL) x`,
+		`SELECT KeyID FROM KeyValueTBL WHERE Value LIKE 'from users'`,
+		`SELECT STRAIGHT_JOIN a.KeyID FROM KeyValueTBL a STRAIGHT_JOIN KeyValueTBL b ON a.KeyID = b.KeyID`,
+		`SELECT a.KeyID FROM (KeyValueTBL a, KeyValueTBL b) WHERE a.KeyID IN (1, 2)`,
+		`SELECT KeyID FROM KeyValueTBL WHERE Value IN ('a;b', 'c -- d', '# e', '/* f */');`,
+		"SELECT `Table` FROM KeyValueTBL",
+	}
+	for _, q := range allowed {
+		if err := checkSelect(q, `KeyValueTBL`); err != nil {
+			t.Logf(`Expected %q to be allowed, got %s`, q, err)
+			t.Fail()
+		}
+	}
+
+	denied := []string{
+		`DELETE FROM KeyValueTBL`,
+		`SELECT * FROM mysql.user`,
+		`SELECT KeyID FROM KeyValueTBL; DROP TABLE KeyValueTBL`,
+		`SELECT KeyID FROM KeyValueTBL JOIN users ON 1 = 1`,
+		`SELECT KeyID FROM KeyValueTBL, users`,
+		`SELECT (SELECT password FROM users) FROM KeyValueTBL`,
+		`SELECT Value FROM KeyValueTBL INTO OUTFILE '/tmp/x'`,
+		`SELECT Value FROM KeyValueTBL FOR UPDATE`,
+		`SELECT Value FROM KeyValueTBL -- comment`,
+		`SELECT LOAD_FILE('/etc/passwd') FROM KeyValueTBL`,
+		`SELECT * FROM KeyValueTBL STRAIGHT_JOIN mysql.user`,
+		`SELECT * FROM (KeyValueTBL, mysql.user)`,
+		`SELECT * FROM (KeyValueTBL a JOIN (mysql.user))`,
+		`SELECT * FROM KeyValueTBL a JOIN KeyValueTBL b ON a.KeyID = b.KeyID, mysql.user`,
+		`SELECT * FROM KeyValueTBL WHERE KeyID IN (SELECT User FROM KeyValueTBL, mysql.user)`,
+		`SELECT * FROM`,
+		`SELECT KeyID FROM KeyValueTBL UNION TABLE otherdb.secrets`,
+		`SELECT KeyID FROM KeyValueTBL WHERE KeyID IN (TABLE otherdb.t)`,
+		`SELECT KeyID FROM KeyValueTBL WHERE KeyID IN (VALUES ROW('a'), ROW('b'))`,
+		`SELECT KeyID FROM KeyValueTBL UNION VALUES ROW(1)`,
+		`SELECT KeyID FROM KeyValueTBL WHERE KeyID = 'a' /* x */`,
+		`SELECT KeyID FROM KeyValueTBL WHERE KeyID = 'a'# x`,
+		`SELECT KeyID FROM KeyValueTBL WHERE KeyID = 'a;'; DROP TABLE KeyValueTBL`,
+		`SELECT KeyID FROM KeyValueTBL WHERE KeyID = '\'; DROP TABLE KeyValueTBL; '`,
+	}
+	for _, q := range denied {
+		if err := checkSelect(q, `KeyValueTBL`); !errors.Is(err, ErrQueryNotAllowed) {
+			t.Logf(`Expected %q to be denied, got %v`, q, err)
+			t.Fail()
+		}
+	}
+}
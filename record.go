@@ -0,0 +1,212 @@
+package myplainkv
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	ErrReplayMismatch error = errors.New(`operation succeeded but was recorded as failing`)
+)
+
+// Op is a recorded operation
+type Op struct {
+	Time     time.Time     `json:"time"`
+	Op       string        `json:"op"`
+	Bucket   string        `json:"bucket,omitempty"`
+	Key      string        `json:"key,omitempty"`
+	Value    []byte        `json:"value,omitempty"`
+	Mime     string        `json:"mime,omitempty"`
+	Offset   int           `json:"offset,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Err      string        `json:"err,omitempty"`
+}
+
+// Recorder wraps a MyPlainKV and writes every operation made through it,
+// with its arguments, as a JSON line to a writer. The recording can be
+// re-executed against another instance with Replay.
+type Recorder struct {
+	kv  *MyPlainKV
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder creates a Recorder writing operations on kv to w
+func NewRecorder(kv *MyPlainKV, w io.Writer) *Recorder {
+	return &Recorder{
+		kv:  kv,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Err returns the first error met writing the recording
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) write(op Op, start time.Time, err error) {
+	op.Time = start
+	op.Duration = time.Since(start)
+	op.Bucket = r.kv.bucket(r.kv.currBuckt)
+	if err != nil {
+		op.Err = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(op)
+	}
+}
+
+// Get retrieves a record using a key
+func (r *Recorder) Get(key string) ([]byte, error) {
+	start := time.Now()
+	val, err := r.kv.Get(key)
+	r.write(Op{Op: `Get`, Key: key}, start, err)
+	return val, err
+}
+
+// GetMime gets the mime of the value stored
+func (r *Recorder) GetMime(key string) (string, error) {
+	start := time.Now()
+	mime, err := r.kv.GetMime(key)
+	r.write(Op{Op: `GetMime`, Key: key}, start, err)
+	return mime, err
+}
+
+// Set creates or updates the record by the value
+func (r *Recorder) Set(key string, value []byte) error {
+	start := time.Now()
+	err := r.kv.Set(key, value)
+	r.write(Op{Op: `Set`, Key: key, Value: value}, start, err)
+	return err
+}
+
+// SetMime sets the mime of the value stored
+func (r *Recorder) SetMime(key string, mime string) error {
+	start := time.Now()
+	err := r.kv.SetMime(key, mime)
+	r.write(Op{Op: `SetMime`, Key: key, Mime: mime}, start, err)
+	return err
+}
+
+// SetBucket sets the current bucket
+func (r *Recorder) SetBucket(bucket string) {
+	r.kv.SetBucket(bucket)
+	r.write(Op{Op: `SetBucket`}, time.Now(), nil)
+}
+
+// Del deletes a record with the provided key
+func (r *Recorder) Del(key string) error {
+	start := time.Now()
+	err := r.kv.Del(key)
+	r.write(Op{Op: `Del`, Key: key}, start, err)
+	return err
+}
+
+// ListKeys lists all keys containing the current pattern
+func (r *Recorder) ListKeys(pattern string) ([]string, error) {
+	start := time.Now()
+	keys, err := r.kv.ListKeys(pattern)
+	r.write(Op{Op: `ListKeys`, Key: pattern}, start, err)
+	return keys, err
+}
+
+// Tally gets the current tally of a key
+func (r *Recorder) Tally(key string, offset int) (int, error) {
+	start := time.Now()
+	tv, err := r.kv.Tally(key, offset)
+	r.write(Op{Op: `Tally`, Key: key, Offset: offset}, start, err)
+	return tv, err
+}
+
+// TallyIncr increments the tally
+func (r *Recorder) TallyIncr(key string) (int, error) {
+	start := time.Now()
+	tv, err := r.kv.TallyIncr(key)
+	r.write(Op{Op: `TallyIncr`, Key: key}, start, err)
+	return tv, err
+}
+
+// TallyDecr decrements the tally
+func (r *Recorder) TallyDecr(key string) (int, error) {
+	start := time.Now()
+	tv, err := r.kv.TallyDecr(key)
+	r.write(Op{Op: `TallyDecr`, Key: key}, start, err)
+	return tv, err
+}
+
+// TallyReset resets tally to zero
+func (r *Recorder) TallyReset(key string) error {
+	start := time.Now()
+	err := r.kv.TallyReset(key)
+	r.write(Op{Op: `TallyReset`, Key: key}, start, err)
+	return err
+}
+
+// Replay re-executes a recording against kv in order. Each operation
+// runs in the bucket it was recorded in. An operation recorded as
+// failing is expected to fail again with the same error. Replay stops at
+// the first operation whose outcome differs from the recording and
+// returns its error, or ErrReplayMismatch, with the line number.
+func Replay(r io.Reader, kv *MyPlainKV) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 32*1024*1024)
+	for ln := 1; sc.Scan(); ln++ {
+		var (
+			op  Op
+			err error
+		)
+		if err = json.Unmarshal(sc.Bytes(), &op); err != nil {
+			return fmt.Errorf(`line %d: %w`, ln, err)
+		}
+		b := kv.Bucket(op.Bucket)
+		switch op.Op {
+		case `Get`:
+			_, err = b.Get(op.Key)
+		case `GetMime`:
+			// A missing MIME type is an answer, not a failure
+			if _, err = b.GetMime(op.Key); errors.Is(err, ErrNoMime) {
+				err = nil
+			}
+			if op.Err == ErrNoMime.Error() {
+				op.Err = ""
+			}
+		case `Set`:
+			err = b.Set(op.Key, op.Value)
+		case `SetMime`:
+			err = b.SetMime(op.Key, op.Mime)
+		case `SetBucket`:
+			// Every operation carries its bucket
+		case `Del`:
+			err = b.Del(op.Key)
+		case `ListKeys`:
+			_, err = b.ListKeys(op.Key)
+		case `Tally`:
+			_, err = b.Tally(op.Key, op.Offset)
+		case `TallyIncr`:
+			_, err = b.TallyIncr(op.Key)
+		case `TallyDecr`:
+			_, err = b.TallyDecr(op.Key)
+		case `TallyReset`:
+			err = b.TallyReset(op.Key)
+		default:
+			return fmt.Errorf(`line %d: unknown operation %q`, ln, op.Op)
+		}
+		switch {
+		case err == nil && op.Err != "":
+			return fmt.Errorf(`line %d: %s: %w: %s`, ln, op.Op, ErrReplayMismatch, op.Err)
+		case err != nil && err.Error() != op.Err:
+			return fmt.Errorf(`line %d: %s: %w`, ln, op.Op, err)
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,212 @@
+package myplainkv
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	refBuckt  string = `--ref--`
+	rrefBuckt string = `--rref--`
+	refSep    string = "\x1f"
+)
+
+// RefMode sets how Del treats keys referencing the deleted key
+type RefMode int
+
+const (
+	RefUnlink  RefMode = iota // Delete the key and drop its references
+	RefBlock                  // Refuse to delete a key while other keys reference it
+	RefCascade                // Also delete every key referencing it, recursively
+)
+
+var (
+	ErrReferenced error = errors.New(`key is referenced by other keys`)
+)
+
+// refBucket returns the bucket holding the references from keys of a bucket
+func refBucket(bucket string) string {
+	return refBuckt + bucket
+}
+
+// rrefBucket returns the bucket holding the references to keys of a bucket
+func rrefBucket(bucket string) string {
+	return rrefBuckt + bucket
+}
+
+// AddRef records that fromKey references toKey
+func (p *MyPlainKV) AddRef(fromKey, toKey string) error {
+	return p.addRef(p.currBuckt, fromKey, toKey)
+}
+
+// RemoveRef removes the reference from fromKey to toKey
+func (p *MyPlainKV) RemoveRef(fromKey, toKey string) error {
+	return p.removeRef(p.currBuckt, fromKey, toKey)
+}
+
+// Refs lists the keys referenced by a key
+func (p *MyPlainKV) Refs(key string) ([]string, error) {
+	return p.refs(refBucket(p.bucket(p.currBuckt)), key)
+}
+
+// ReverseRefs lists the keys referencing a key
+func (p *MyPlainKV) ReverseRefs(key string) ([]string, error) {
+	return p.refs(rrefBucket(p.bucket(p.currBuckt)), key)
+}
+
+func (p *MyPlainKV) addRef(bucket, fromKey, toKey string) error {
+	bucket = p.bucket(bucket)
+	return p.atomic(func() error {
+		if err := p.set(refBucket(bucket), fromKey+refSep+toKey, []byte{}); err != nil {
+			return err
+		}
+		return p.set(rrefBucket(bucket), toKey+refSep+fromKey, []byte{})
+	})
+}
+
+func (p *MyPlainKV) removeRef(bucket, fromKey, toKey string) error {
+	bucket = p.bucket(bucket)
+	return p.atomic(func() error {
+		sqlstr := `DELETE FROM ` + p.defTableName + ` WHERE (Bucket = ? AND KeyID = ?) OR (Bucket = ? AND KeyID = ?);`
+		_, err := p.exec(sqlstr,
+			refBucket(bucket), fromKey+refSep+toKey,
+			rrefBucket(bucket), toKey+refSep+fromKey)
+		return err
+	})
+}
+
+// refs lists the keys linked to a key in a reference bucket
+func (p *MyPlainKV) refs(rb, key string) ([]string, error) {
+	if err := p.Open(); err != nil {
+		return nil, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	return p.linked(rb, key)
+}
+
+// linked lists the keys linked to a key in a reference bucket.
+// The connection must be open.
+func (p *MyPlainKV) linked(rb, key string) ([]string, error) {
+	var (
+		k   string
+		val []string
+	)
+	sqlstr := `SELECT KeyID FROM ` + p.defTableName + ` WHERE Bucket = ? AND KeyID LIKE ?;`
+	sqr, err := p.query(sqlstr, rb, escapeLike(key+refSep)+`%`)
+	if err != nil {
+		return nil, err
+	}
+	defer sqr.Close()
+	val = make([]string, 0)
+	for sqr.Next() {
+		if err = sqr.Scan(&k); err != nil {
+			return nil, err
+		}
+		if i := strings.Index(k, refSep); i >= 0 {
+			val = append(val, k[i+len(refSep):])
+		}
+	}
+	return val, sqr.Err()
+}
+
+// referrers lists every key referencing a key, directly or through other
+// referencing keys. The connection must be open.
+func (p *MyPlainKV) referrers(bucket, key string) ([]string, error) {
+	seen := map[string]bool{key: true}
+	queue := []string{key}
+	val := make([]string, 0)
+	for len(queue) > 0 {
+		rr, err := p.linked(rrefBucket(bucket), queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+		for _, k := range rr {
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			val = append(val, k)
+			queue = append(queue, k)
+		}
+	}
+	return val, nil
+}
+
+// unlinkRefs removes the references from and to the keys.
+// The connection must be open.
+func (p *MyPlainKV) unlinkRefs(bucket string, keys ...string) error {
+	var (
+		out bool
+		k   string
+	)
+	if len(keys) == 0 {
+		return nil
+	}
+	rb, rrb := refBucket(bucket), rrefBucket(bucket)
+
+	// Both directions are read in one query, as most keys have none
+	likes := make([]string, len(keys))
+	args := []any{rb, rb, rrb}
+	for i, key := range keys {
+		likes[i] = `KeyID LIKE ?`
+		args = append(args, escapeLike(key+refSep)+`%`)
+	}
+	sqlstr := `SELECT Bucket = ?, KeyID FROM ` + p.defTableName + `
+	WHERE Bucket IN (?, ?) AND (` + strings.Join(likes, ` OR `) + `);`
+	sqr, err := p.query(sqlstr, args...)
+	if err != nil {
+		return err
+	}
+	conds := make([]string, 0)
+	args = make([]any, 0)
+	for sqr.Next() {
+		if err = sqr.Scan(&out, &k); err != nil {
+			sqr.Close()
+			return err
+		}
+		i := strings.Index(k, refSep)
+		if i < 0 {
+			continue
+		}
+		key, other := k[:i], k[i+len(refSep):]
+		conds = append(conds, `(Bucket = ? AND KeyID = ?)`, `(Bucket = ? AND KeyID = ?)`)
+		if out {
+			args = append(args, rb, k, rrb, other+refSep+key)
+		} else {
+			args = append(args, rrb, k, rb, other+refSep+key)
+		}
+	}
+	sqr.Close()
+	if err = sqr.Err(); err != nil {
+		return err
+	}
+	if len(conds) == 0 {
+		return nil
+	}
+	sqlstr = `DELETE FROM ` + p.defTableName + ` WHERE ` + strings.Join(conds, ` OR `) + `;`
+	_, err = p.exec(sqlstr, args...)
+	return err
+}
+
+// AddRef records that fromKey references toKey in the bucket
+func (b *Bucket) AddRef(fromKey, toKey string) error {
+	return b.kv.addRef(b.name, fromKey, toKey)
+}
+
+// RemoveRef removes the reference from fromKey to toKey in the bucket
+func (b *Bucket) RemoveRef(fromKey, toKey string) error {
+	return b.kv.removeRef(b.name, fromKey, toKey)
+}
+
+// Refs lists the keys referenced by a key in the bucket
+func (b *Bucket) Refs(key string) ([]string, error) {
+	return b.kv.refs(refBucket(b.name), key)
+}
+
+// ReverseRefs lists the keys referencing a key in the bucket
+func (b *Bucket) ReverseRefs(key string) ([]string, error) {
+	return b.kv.refs(rrefBucket(b.name), key)
+}
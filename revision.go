@@ -0,0 +1,114 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	hlcBuckt string = `--revision--`
+	hlcKey   string = `hlc`
+)
+
+var (
+	ErrInvalidRevision error = errors.New(`invalid revision`)
+)
+
+// Revision is a hybrid logical clock reading. Wall is the database time
+// in microseconds since the Unix epoch. Logical orders revisions issued
+// within the same microsecond, or while the database clock is behind
+// the last revision issued.
+type Revision struct {
+	Wall    int64
+	Logical uint32
+}
+
+// String formats the revision as a fixed-width token. Tokens sort in
+// the same order as the revisions they encode.
+func (r Revision) String() string {
+	return fmt.Sprintf(`%016x.%08x`, r.Wall, r.Logical)
+}
+
+// Time returns the wall clock part of the revision
+func (r Revision) Time() time.Time {
+	return time.UnixMicro(r.Wall)
+}
+
+// Compare returns -1, 0 or 1 as r is before, equal to or after o
+func (r Revision) Compare(o Revision) int {
+	switch {
+	case r.Wall < o.Wall:
+		return -1
+	case r.Wall > o.Wall:
+		return 1
+	case r.Logical < o.Logical:
+		return -1
+	case r.Logical > o.Logical:
+		return 1
+	}
+	return 0
+}
+
+// ParseRevision parses a token returned by Revision.String
+func ParseRevision(s string) (Revision, error) {
+	var r Revision
+	if len(s) != 25 {
+		return r, fmt.Errorf(`%w: %q`, ErrInvalidRevision, s)
+	}
+	if _, err := fmt.Sscanf(s, `%016x.%08x`, &r.Wall, &r.Logical); err != nil {
+		return r, fmt.Errorf(`%w: %q`, ErrInvalidRevision, s)
+	}
+	return r, nil
+}
+
+// next returns the revision following last at the database time now
+func (r Revision) next(now int64) Revision {
+	if now > r.Wall {
+		return Revision{Wall: now}
+	}
+	return Revision{Wall: r.Wall, Logical: r.Logical + 1}
+}
+
+// NextRevision issues a new revision, ordered after every revision
+// issued before it by any instance sharing the store
+func (p *MyPlainKV) NextRevision() (Revision, error) {
+	var next Revision
+	err := p.atomic(func() error {
+		var (
+			err  error
+			val  []byte
+			now  int64
+			last Revision
+		)
+		err = p.queryRow(
+			`SELECT Value FROM `+p.defTableName+` WHERE Bucket=? AND KeyID=? FOR UPDATE;`,
+			hlcBuckt, hlcKey).Scan(&val)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err == nil {
+			if last, err = ParseRevision(string(val)); err != nil {
+				return err
+			}
+		}
+		if err = p.queryRow(`SELECT CAST(UNIX_TIMESTAMP(NOW(6)) * 1000000 AS SIGNED);`).Scan(&now); err != nil {
+			return err
+		}
+		next = last.next(now)
+		_, err = p.upsert(hlcBuckt, hlcKey, []byte(next.String()))
+		return err
+	})
+	return next, err
+}
+
+// LastRevision returns the last revision issued, or the zero revision
+// if none was
+func (p *MyPlainKV) LastRevision() (Revision, error) {
+	val, err := p.get(hlcBuckt, hlcKey)
+	if err != nil || len(val) == 0 {
+		return Revision{}, err
+	}
+	return ParseRevision(string(val))
+}
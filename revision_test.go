@@ -0,0 +1,32 @@
+package myplainkv
+
+import "testing"
+
+func TestRevisionOrder(t *testing.T) {
+	r := Revision{}
+	a := r.next(100)
+	b := a.next(100)
+	c := b.next(90) // clock went back
+	d := c.next(200)
+	revs := []Revision{r, a, b, c, d}
+	for i := 1; i < len(revs); i++ {
+		if revs[i-1].Compare(revs[i]) >= 0 {
+			t.Logf(`Expected %s before %s`, revs[i-1], revs[i])
+			t.Fail()
+		}
+		if revs[i-1].String() >= revs[i].String() {
+			t.Logf(`Expected token %s to sort before %s`, revs[i-1], revs[i])
+			t.Fail()
+		}
+	}
+
+	p, err := ParseRevision(c.String())
+	if err != nil || p != c {
+		t.Logf(`Expected %s to round-trip, got %s (%v)`, c, p, err)
+		t.Fail()
+	}
+	if _, err = ParseRevision(`not a revision`); err == nil {
+		t.Logf(`Expected an error for an invalid token`)
+		t.Fail()
+	}
+}
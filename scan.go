@@ -0,0 +1,143 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	scanPageSize int = 1000
+)
+
+var (
+	ErrInvalidParts error = errors.New(`parts must be at least 1`)
+)
+
+// Range is a range of keys in a bucket, from Start inclusive to End
+// exclusive. An empty Start begins at the first key and an empty End
+// runs to the last.
+type Range struct {
+	Bucket string
+	Start  string
+	End    string
+}
+
+// SplitKeyspace splits the keys of a bucket into at most parts ranges of
+// roughly equal cardinality. The ranges do not overlap and together cover
+// the whole bucket, so each can be handed to its own worker.
+func (p *MyPlainKV) SplitKeyspace(bucket string, parts int) ([]Range, error) {
+	var (
+		err   error
+		count int
+		k     string
+	)
+	if parts < 1 {
+		return nil, ErrInvalidParts
+	}
+	if err = p.Open(); err != nil {
+		return nil, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	// Expired keys are left out, as ScanRange skips them
+	sqlstr := `SELECT COUNT(*) FROM ` + p.defTableName + ` WHERE Bucket=? AND ` + notExpired + `;`
+	if err = p.queryRow(sqlstr, bucket).Scan(&count); err != nil {
+		return nil, err
+	}
+	step := (count + parts - 1) / parts
+	if step == 0 {
+		step = 1
+	}
+	rngs := make([]Range, 0, parts)
+	start := ""
+	sqlstr = `
+	SELECT KeyID FROM ` + p.defTableName + `
+	WHERE Bucket=? AND ` + notExpired + `
+	ORDER BY KeyID
+	LIMIT 1 OFFSET ?;`
+	for i := 1; i < parts && i*step < count; i++ {
+		if err = p.queryRow(sqlstr, bucket, i*step).Scan(&k); err != nil {
+			return nil, err
+		}
+		rngs = append(rngs, Range{Bucket: bucket, Start: start, End: k})
+		start = k
+	}
+	rngs = append(rngs, Range{Bucket: bucket, Start: start})
+	return rngs, nil
+}
+
+// ScanRange calls fn for every key in the range and its value, in key
+// order. It reads the range a page at a time, so fn may use the store.
+func (p *MyPlainKV) ScanRange(r Range, fn func(key string, value []byte) error) error {
+	type entry struct {
+		key     string
+		value   []byte
+		chunked bool
+	}
+	var (
+		err error
+		sqr *sql.Rows
+	)
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		// Keep the connection while fn runs
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	bucket := p.bucket(r.Bucket)
+	from, op := r.Start, `>=`
+	for {
+		args := []any{chunkBucket(bucket), bucket, from}
+		sqlstr := `
+		SELECT v.KeyID, v.Value, COALESCE(c.Value = v.Value, 0)
+		FROM ` + p.defTableName + ` v
+		LEFT JOIN ` + p.defTableName + ` c ON c.Bucket = ? AND c.KeyID = v.KeyID
+		WHERE v.Bucket = ? AND v.KeyID ` + op + ` ?
+		AND (v.ExpiresAt IS NULL OR v.ExpiresAt > NOW(6))`
+		if r.End != "" {
+			sqlstr += ` AND v.KeyID < ?`
+			args = append(args, r.End)
+		}
+		sqlstr += ` ORDER BY v.KeyID LIMIT ?;`
+		args = append(args, scanPageSize)
+
+		if sqr, err = p.query(sqlstr, args...); err != nil {
+			return err
+		}
+		page := make([]entry, 0, scanPageSize)
+		for sqr.Next() {
+			var e entry
+			if err = sqr.Scan(&e.key, &e.value, &e.chunked); err != nil {
+				sqr.Close()
+				return err
+			}
+			page = append(page, e)
+		}
+		sqr.Close()
+		if err = sqr.Err(); err != nil {
+			return err
+		}
+
+		for _, e := range page {
+			if e.chunked {
+				if e.value, err = p.get(bucket, e.key); err != nil {
+					return err
+				}
+			}
+			if err = fn(e.key, e.value); err != nil {
+				return err
+			}
+		}
+		if len(page) < scanPageSize {
+			return nil
+		}
+		from, op = page[len(page)-1].key, `>`
+	}
+}
@@ -0,0 +1,160 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	schemaBuckt string = `--schema--`
+	schemaKey   string = `version`
+
+	// SchemaVersion is the version of the table layout this library writes.
+	// It is stored in the database so that older libraries sharing the table
+	// refuse to operate on a layout they do not understand.
+	SchemaVersion int = 7
+)
+
+var (
+	ErrSchemaTooNew error = errors.New(`database schema is newer than this library supports`)
+)
+
+// migrations upgrade the table to the version of their index.
+// Each migration must be safe to re-run on a table that already has the change.
+var migrations = map[int]func(p *MyPlainKV) error{
+	// Expiry time of keys set with a TTL
+	3: func(p *MyPlainKV) error {
+		if err := p.alter(`ADD COLUMN ExpiresAt DATETIME(6) NULL`); err != nil {
+			return err
+		}
+		return p.alter(`ADD INDEX IX_ExpiresAt (ExpiresAt)`)
+	},
+	// Version of each record for compare-and-swap
+	4: func(p *MyPlainKV) error {
+		return p.alter(`ADD COLUMN Version BIGINT UNSIGNED NOT NULL DEFAULT 1`)
+	},
+	// Last read time of each record for idle expiry
+	5: func(p *MyPlainKV) error {
+		if err := p.alter(`ADD COLUMN AccessedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP`); err != nil {
+			return err
+		}
+		return p.alter(`ADD INDEX IX_BucketAccessedAt (Bucket, AccessedAt)`)
+	},
+	// MIME type and write times in the row of each record. The MIME
+	// types kept in the MIME buckets are moved into their records, and
+	// the buckets dropped. Records that existed before get the time of
+	// the migration as their creation time.
+	6: func(p *MyPlainKV) error {
+		for _, c := range []string{
+			`ADD COLUMN Mime VARCHAR(255) NULL`,
+			`ADD COLUMN CreatedAt DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)`,
+			`ADD COLUMN UpdatedAt DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6)`,
+		} {
+			if err := p.alter(c); err != nil {
+				return err
+			}
+		}
+		// A bucket's own MIME bucket is read first. The shared MIME bucket
+		// held the MIME types of every bucket before buckets had their
+		// own, and of the default bucket since, so it fills in what is
+		// left for any bucket holding the key. The MIME buckets are only
+		// dropped in the same transaction, once every MIME type is moved.
+		// Moving a MIME type is not an update of the record.
+		tx, err := p.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for _, on := range []string{
+			`m.Bucket = CONCAT(?, v.Bucket)`,
+			`m.Bucket = ? AND v.Mime IS NULL`,
+		} {
+			_, err = tx.Exec(
+				`UPDATE `+p.defTableName+` v
+				JOIN `+p.defTableName+` m ON m.KeyID = v.KeyID AND `+on+`
+				SET v.Mime = NULLIF(LEFT(CAST(m.Value AS CHAR), ?), ''), v.UpdatedAt = v.UpdatedAt
+				WHERE v.Bucket NOT LIKE '--%';`,
+				mimeBuckt, maxMimeLen)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err = tx.Exec(`DELETE FROM `+p.defTableName+` WHERE Bucket LIKE ?;`, mimeBuckt+`%`); err != nil {
+			return err
+		}
+		return tx.Commit()
+	},
+	// Drop the index on (Bucket, KeyID) version 2 added, which repeats the
+	// primary key and only made writes costlier
+	7: func(p *MyPlainKV) error {
+		if p.SurrogateKey {
+			return nil
+		}
+		return p.alter(`DROP INDEX IX_BucketKeyID`)
+	},
+}
+
+// checkSchema reads the schema version stored in the database, migrates
+// the table if the stored version is missing or older, and fails if the
+// stored version is newer than SchemaVersion. The connection must be open.
+func (p *MyPlainKV) checkSchema() error {
+	var (
+		err error
+		val []byte
+		ver int
+	)
+	err = p.db.QueryRow(
+		`SELECT Value FROM `+p.defTableName+` WHERE Bucket=? AND KeyID=?;`,
+		schemaBuckt, schemaKey).Scan(&val)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	ver = 1
+	if err == nil {
+		if ver, err = strconv.Atoi(string(val)); err != nil {
+			return fmt.Errorf(`invalid schema version %q: %w`, val, err)
+		}
+		if ver > SchemaVersion {
+			return fmt.Errorf(`%w (database: %d, library: %d)`, ErrSchemaTooNew, ver, SchemaVersion)
+		}
+		if ver == SchemaVersion {
+			return nil
+		}
+	}
+	for v := ver + 1; v <= SchemaVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			continue
+		}
+		if err = m(p); err != nil {
+			return fmt.Errorf(`migrating schema to version %d: %w`, v, err)
+		}
+	}
+	cur := []byte(strconv.Itoa(SchemaVersion))
+	_, err = p.db.Exec(
+		`INSERT INTO `+p.defTableName+` (Bucket, KeyID, Value) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE Value=?;`,
+		schemaBuckt, schemaKey, cur, cur)
+	return err
+}
+
+// alter runs an ALTER TABLE clause on the table, ignoring errors
+// raised when the column or index already exists, or is already gone
+func (p *MyPlainKV) alter(clause string) error {
+	_, err := p.db.Exec(`ALTER TABLE ` + p.defTableName + ` ` + clause + `;`)
+	if err != nil {
+		var me *mysql.MySQLError
+		if errors.As(err, &me) {
+			switch me.Number {
+			case 1060, 1061, 1091: // duplicate column name, duplicate key name, no such column or key
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package myplainkv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSeedFormat error = errors.New(`unsupported seed file format`)
+)
+
+// SeedFromEnv stores every environment variable whose name starts with
+// prefix in the bucket, keyed by the rest of its name. All keys are
+// written in one transaction.
+func (p *MyPlainKV) SeedFromEnv(prefix, bucket string) error {
+	vars := make(map[string]string)
+	for _, e := range os.Environ() {
+		name, val, ok := strings.Cut(e, `=`)
+		if !ok || !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+			continue
+		}
+		vars[name[len(prefix):]] = val
+	}
+	return p.seed(map[string]map[string]string{bucket: vars})
+}
+
+// SeedFromFile stores the keys of a configuration file, in one
+// transaction. The format follows the file extension:
+//
+//   - .json holds an object of buckets, each an object of keys with
+//     string values, as in {"config": {"timeout": "30s"}}
+//   - .env holds KEY=VALUE lines, stored in the current bucket
+//
+// Other formats fail with ErrSeedFormat.
+func (p *MyPlainKV) SeedFromFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var data map[string]map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case `.json`:
+		if err = json.Unmarshal(raw, &data); err != nil {
+			return fmt.Errorf(`parsing %s: %w`, path, err)
+		}
+	case `.env`:
+		vars, err := parseEnv(raw)
+		if err != nil {
+			return fmt.Errorf(`parsing %s: %w`, path, err)
+		}
+		data = map[string]map[string]string{p.currBuckt: vars}
+	default:
+		return fmt.Errorf(`%w: %s`, ErrSeedFormat, path)
+	}
+	return p.seed(data)
+}
+
+// seed stores the keys of each bucket in one transaction
+func (p *MyPlainKV) seed(data map[string]map[string]string) error {
+	return p.atomic(func() error {
+		for bucket, vars := range data {
+			for k, v := range vars {
+				if err := p.set(bucket, k, []byte(v)); err != nil {
+					return fmt.Errorf(`seeding %s: %w`, k, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// parseEnv parses KEY=VALUE lines. Blank lines and lines starting with #
+// are skipped, an export prefix is allowed, and values may be quoted.
+func parseEnv(raw []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, `#`) {
+			continue
+		}
+		line = strings.TrimPrefix(line, `export `)
+		name, val, ok := strings.Cut(line, `=`)
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf(`line %d: expected KEY=VALUE`, n)
+		}
+		val = strings.TrimSpace(val)
+		if len(val) >= 2 {
+			switch val[0] {
+			case '"':
+				if val[len(val)-1] == '"' {
+					uq, err := strconv.Unquote(val)
+					if err != nil {
+						return nil, fmt.Errorf(`line %d: %w`, n, err)
+					}
+					val = uq
+				}
+			case '\'':
+				if val[len(val)-1] == '\'' {
+					val = val[1 : len(val)-1]
+				}
+			}
+		}
+		vars[name] = val
+	}
+	return vars, sc.Err()
+}
@@ -0,0 +1,34 @@
+package myplainkv
+
+import "testing"
+
+func TestParseEnv(t *testing.T) {
+	raw := []byte("# settings\n\nHOST=db.local\nexport PORT = 3306\nNAME=\"plain kv\\n\"\nMODE='ro'\nEMPTY=\n")
+	want := map[string]string{
+		`HOST`:  `db.local`,
+		`PORT`:  `3306`,
+		`NAME`:  "plain kv\n",
+		`MODE`:  `ro`,
+		`EMPTY`: ``,
+	}
+	got, err := parseEnv(raw)
+	if err != nil {
+		t.Logf(`%s`, err)
+		t.Fail()
+	}
+	if len(got) != len(want) {
+		t.Logf(`Expected %d variables, got %d`, len(want), len(got))
+		t.Fail()
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Logf(`%s: expected %q, got %q`, k, v, got[k])
+			t.Fail()
+		}
+	}
+
+	if _, err = parseEnv([]byte("NOVALUE\n")); err == nil {
+		t.Logf(`Expected an error for a line without =`)
+		t.Fail()
+	}
+}
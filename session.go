@@ -0,0 +1,62 @@
+package myplainkv
+
+import (
+	"database/sql"
+)
+
+// Session returns a handle on the store for one goroutine. A MyPlainKV
+// keeps its current bucket, transaction and last result on itself, so
+// goroutines sharing one race on them and run inside each other's
+// transactions. Sessions each keep their own, while sharing the
+// connection pool and everything registered on the store: views,
+// upgraders, key orders, erasure subjects, the miss cache, the access
+// log and maintenance. The session starts in the current bucket of the
+// store.
+//
+// If the store closes automatically, each session opens and closes a
+// pool of its own per operation, as the store would. Otherwise the pool
+// stays with the store, closing a session only lets go of it, and the
+// store must outlive its sessions.
+func (p *MyPlainKV) Session() *MyPlainKV {
+	s := p.detached()
+	s.root = p.shared()
+	s.currBuckt = p.currBuckt
+	s.autoClose = p.autoClose
+	s.sharedPool = !p.autoClose
+	if p.root != nil {
+		s.sharedPool = p.sharedPool
+	}
+	return s
+}
+
+// shared returns the store holding the pool and registrations of p,
+// which is p unless p is a session
+func (p *MyPlainKV) shared() *MyPlainKV {
+	if p.root != nil {
+		return p.root
+	}
+	return p
+}
+
+// openShared opens the pool of the store a session belongs to and
+// takes it for the session
+func (p *MyPlainKV) openShared() error {
+	if p.db != nil {
+		return nil
+	}
+	if err := p.root.Open(); err != nil {
+		return err
+	}
+	p.root.mu.Lock()
+	db := p.root.db
+	p.root.mu.Unlock()
+	if db == nil {
+		// The store was closed in the meantime
+		return sql.ErrConnDone
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.db = db
+	p.inTransaction = false
+	return nil
+}
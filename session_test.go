@@ -0,0 +1,123 @@
+package myplainkv
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	pkv.SetBucket(`orders`)
+	pkv.SetKeyOrder(`orders`, OrderNatural)
+
+	s := pkv.Session()
+	s.SetBucket(`users`)
+	if pkv.currBuckt != `orders` || s.currBuckt != `users` {
+		t.Logf(`Expected the session to keep its own bucket, got %s and %s`, pkv.currBuckt, s.currBuckt)
+		t.Fail()
+	}
+	if s.shared().orders.get(`orders`) != OrderNatural {
+		t.Logf(`Expected the session to see the key order set on the store`)
+		t.Fail()
+	}
+	s.SetKeyOrder(`users`, OrderBinary)
+	if pkv.orders.get(`users`) != OrderBinary {
+		t.Logf(`Expected the store to see the key order set on the session`)
+		t.Fail()
+	}
+	if s.Session().shared() != pkv {
+		t.Logf(`Expected a session of a session to share the store`)
+		t.Fail()
+	}
+}
+
+// TestGetCtxConcurrent is meant to run with -race. Calls cancelled
+// midway must not cancel the calls running beside them.
+func TestGetCtxConcurrent(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer pkv.Close()
+	pkv.SetBucket(`ctxtest`)
+	if err := pkv.Set(`sample_ctx`, []byte(`value`)); err != nil {
+		t.Fatal(err)
+	}
+	defer pkv.Del(`sample_ctx`)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(time.Duration(i)*time.Microsecond, cancel)
+				pkv.GetCtx(ctx, `sample_ctx`)
+				return
+			}
+			val, err := pkv.GetCtx(context.Background(), `sample_ctx`)
+			if err == nil && !bytes.Equal(val, []byte(`value`)) {
+				err = fmt.Errorf(`got %q`, val)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Logf(`Expected uncancelled calls to succeed, got %s`, err)
+			t.Fail()
+		}
+	}
+}
+
+// TestGetCtxBegin is meant to run with -race. Calls with a context may
+// run while another goroutine begins and ends transactions on the store.
+func TestGetCtxBegin(t *testing.T) {
+	pkv := NewMyPlainKV(testDSN(t), false)
+	if err := pkv.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer pkv.Close()
+	pkv.SetBucket(`ctxtest`)
+	if err := pkv.Set(`sample_ctx_tx`, []byte(`value`)); err != nil {
+		t.Fatal(err)
+	}
+	defer pkv.Del(`sample_ctx_tx`)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := pkv.Begin(); err != nil {
+				t.Logf(`%s`, err)
+				t.Fail()
+				return
+			}
+			pkv.Rollback()
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		// A call joining a transaction that ends under it sees ErrTxDone
+		val, err := pkv.GetCtx(context.Background(), `sample_ctx_tx`)
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			t.Logf(`%s`, err)
+			t.Fail()
+		}
+		if err == nil && !bytes.Equal(val, []byte(`value`)) {
+			t.Logf(`Expected value, got %q`, val)
+			t.Fail()
+		}
+	}
+	wg.Wait()
+}
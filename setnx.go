@@ -0,0 +1,68 @@
+package myplainkv
+
+import (
+	"time"
+)
+
+// SetNX creates the record only if the key does not exist, or has
+// expired, and reports whether it did. The check and the write are one
+// statement, so concurrent callers cannot both succeed. Values too large
+// for a single row fail with ErrValueTooLong.
+func (p *MyPlainKV) SetNX(key string, value []byte) (bool, error) {
+	return p.setNX(p.currBuckt, key, value)
+}
+
+func (p *MyPlainKV) setNX(bucket, key string, value []byte) (ok bool, err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return false, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return false, ErrReadOnlyView
+	}
+	if len(bucket) > 50 {
+		return false, ErrBucketIdTooLong
+	}
+	if len(key) > 300 {
+		return false, ErrKeyTooLong
+	}
+	if len(value) > maxValueLen {
+		return false, ErrValueTooLong
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return false, err
+	}
+
+	// An existing row is only replaced if it has expired. MySQL reports
+	// 1 row affected for an insert, 2 for a replaced row and 0 otherwise.
+	sqlstr := `
+	INSERT INTO ` + p.defTableName + ` (Bucket, KeyID, Value) VALUES (?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		` + renewed + `,
+		Value = IF(ExpiresAt <= NOW(6), VALUES(Value), Value),
+		Version = IF(ExpiresAt <= NOW(6), Version + 1, Version),
+		ExpiresAt = IF(ExpiresAt <= NOW(6), NULL, ExpiresAt);`
+	res, err := p.exec(sqlstr, bucket, key, value)
+	if err != nil {
+		return false, err
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if ra > 0 {
+		p.shared().misses.forget(bucket, key)
+	}
+	p.record(start, ra)
+	return ra > 0, nil
+}
+
+// SetNX creates the record in the bucket only if the key does not exist
+func (b *Bucket) SetNX(key string, value []byte) (bool, error) {
+	return b.kv.setNX(b.name, key, value)
+}
@@ -0,0 +1,83 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Size returns the length of the value of the key in bytes, without
+// reading it. Chunked values report their full length and aliases are
+// followed. A missing key has size 0.
+func (p *MyPlainKV) Size(key string) (int64, error) {
+	return p.size(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) size(bucket, key string) (n int64, err error) {
+	var (
+		manifest []byte
+		target   []byte
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return 0, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if v := p.shared().views.get(bucket); v != nil {
+		// A transform may change the length, so the value is read
+		var val []byte
+		val, err = p.get(bucket, key)
+		return int64(len(val)), err
+	}
+
+	// The manifest is only joined if it still matches the value
+	sqlstr := `
+	SELECT COALESCE(OCTET_LENGTH(v.Value), 0), c.Value
+	FROM ` + p.defTableName + ` v
+	LEFT JOIN ` + p.defTableName + ` c ON c.Bucket = ? AND c.KeyID = v.KeyID AND c.Value = v.Value
+	WHERE v.Bucket = ? AND v.KeyID = ? AND (v.ExpiresAt IS NULL OR v.ExpiresAt > NOW(6));`
+	aliasstr := `SELECT Value FROM ` + p.defTableName + ` WHERE Bucket = ? AND KeyID = ?;`
+	seen := make(map[string]bool)
+	for {
+		err = p.queryRow(sqlstr, chunkBucket(bucket), bucket, key).Scan(&n, &manifest)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		err = p.queryRow(aliasstr, aliasBucket(bucket), key).Scan(&target)
+		if errors.Is(err, sql.ErrNoRows) {
+			p.record(start, 0)
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		seen[key] = true
+		if seen[string(target)] || len(seen) > maxAliasDepth {
+			return 0, ErrAliasLoop
+		}
+		key = string(target)
+	}
+	if manifest != nil {
+		var man chunkManifest
+		if err = json.Unmarshal(manifest, &man); err != nil {
+			return 0, fmt.Errorf(`%w: %s`, ErrChunkCorrupt, err)
+		}
+		n = man.Size
+	}
+	p.record(start, 1)
+	return n, nil
+}
+
+// Size returns the length of the value of the key in the bucket
+func (b *Bucket) Size(key string) (int64, error) {
+	return b.kv.size(b.name, key)
+}
@@ -0,0 +1,78 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrInTransaction error = errors.New(`a transaction is already in progress`)
+)
+
+// Reader is the read-only view of the store passed to SnapshotRead
+type Reader interface {
+	Get(key string) ([]byte, error)
+	GetMime(key string) (string, error)
+	ListKeys(pattern string) ([]string, error)
+	In(bucket string) Reader
+}
+
+// snapshot implements Reader for a bucket within a snapshot transaction
+type snapshot struct {
+	kv     *MyPlainKV
+	bucket string
+}
+
+func (s *snapshot) Get(key string) ([]byte, error) {
+	return s.kv.getKey(s.bucket, key)
+}
+
+func (s *snapshot) GetMime(key string) (string, error) {
+	return s.kv.getMime(s.bucket, key)
+}
+
+func (s *snapshot) ListKeys(pattern string) ([]string, error) {
+	return s.kv.listKeys(s.bucket, pattern)
+}
+
+func (s *snapshot) In(bucket string) Reader {
+	return &snapshot{
+		kv:     s.kv,
+		bucket: s.kv.bucket(bucket),
+	}
+}
+
+// SnapshotRead runs fn in a read-only REPEATABLE READ transaction, so
+// every read made through r sees the same point-in-time view of the
+// store, even while other writers are active.
+func (p *MyPlainKV) SnapshotRead(fn func(r Reader) error) error {
+	var err error
+	if p.inTransaction {
+		return ErrInTransaction
+	}
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		// Keep the connection until the snapshot completes
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	tx, err := p.beginTx(p.callCtx(), &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return err
+	}
+	p.setTx(tx)
+	defer p.Rollback()
+
+	return fn(&snapshot{
+		kv:     p,
+		bucket: p.bucket(p.currBuckt),
+	})
+}
@@ -0,0 +1,69 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const (
+	stageBuckt string = `--stage--`
+)
+
+var (
+	ErrNotStaged error = errors.New(`key is not staged`)
+)
+
+// stageBucket returns the bucket holding the staged values of a bucket
+func stageBucket(bucket string) string {
+	return stageBuckt + bucket
+}
+
+// StageSet stores a value in the staging area of the current bucket.
+// Staged values are not visible to Get until promoted.
+func (p *MyPlainKV) StageSet(key string, value []byte) error {
+	return p.set(stageBucket(p.bucket(p.currBuckt)), key, value)
+}
+
+// Promote moves the staged values of the keys into the current bucket
+// in one transaction. If any key is not staged, nothing is promoted.
+func (p *MyPlainKV) Promote(keys ...string) error {
+	return p.promote(p.currBuckt, keys...)
+}
+
+func (p *MyPlainKV) promote(bucket string, keys ...string) error {
+	bucket = p.bucket(bucket)
+	sb := stageBucket(bucket)
+	return p.atomic(func() error {
+		for _, k := range keys {
+			val := make([]byte, 0)
+			found, err := p.getRaw(sb, k, func(raw sql.RawBytes) error {
+				val = append(val, raw...)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf(`%w: %s`, ErrNotStaged, k)
+			}
+			if err = p.set(bucket, k, val); err != nil {
+				return err
+			}
+			if err = p.del(sb, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// StageSet stores a value in the staging area of the bucket
+func (b *Bucket) StageSet(key string, value []byte) error {
+	return b.kv.set(stageBucket(b.name), key, value)
+}
+
+// Promote moves the staged values of the keys into the bucket in one transaction
+func (b *Bucket) Promote(keys ...string) error {
+	return b.kv.promote(b.name, keys...)
+}
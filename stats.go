@@ -0,0 +1,200 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// statsTriggers are the suffixes of the triggers keeping the stats table
+// in step with the key-value table
+var statsTriggers = []string{`_StatsIns`, `_StatsUpd`, `_StatsDel`}
+
+// statsSlots is the number of rows the stats of each bucket are spread
+// over. Each key counts in the row picked by the hash of its ID, so
+// concurrent writes to a bucket rarely wait on the same row lock.
+const statsSlots int = 16
+
+// statsSlot returns the SQL picking the stats row of a key from its ID
+func statsSlot(keyID string) string {
+	return `CRC32(` + keyID + `) % ` + strconv.Itoa(statsSlots)
+}
+
+// statsTable returns the name of the table holding per-bucket stats
+func (p *MyPlainKV) statsTable() string {
+	return p.defTableName + `Stats`
+}
+
+// bucketStats creates the stats table and the triggers maintaining it,
+// then fills it from the key-value table. It does nothing if the
+// triggers and the table with its slots already exist. A stats table
+// from before slots is dropped and rebuilt. The connection must be open.
+func (p *MyPlainKV) bucketStats() error {
+	var (
+		err   error
+		n     int
+		slots int
+	)
+	schema, table := splitTable(p.defTableName)
+	err = p.db.QueryRow(
+		`SELECT COUNT(*) FROM information_schema.TRIGGERS
+		WHERE TRIGGER_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND EVENT_OBJECT_TABLE = ? AND TRIGGER_NAME LIKE ?;`,
+		schema, table, escapeLike(table)+`\_Stats%`).Scan(&n)
+	if err != nil {
+		return err
+	}
+	err = p.db.QueryRow(
+		`SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ? AND COLUMN_NAME = 'Slot';`,
+		schema, table+`Stats`).Scan(&slots)
+	if err != nil {
+		return err
+	}
+	if n == len(statsTriggers) && slots == 1 {
+		return nil
+	}
+
+	st := p.statsTable()
+	// The old triggers go first, as writes fail while a trigger refers
+	// to a table that is gone
+	stmts := make([]string, 0)
+	for _, s := range statsTriggers {
+		stmts = append(stmts, `DROP TRIGGER IF EXISTS `+p.defTableName+s+`;`)
+	}
+	if slots == 0 {
+		stmts = append(stmts, `DROP TABLE IF EXISTS `+st+`;`)
+	}
+	stmts = append(stmts,
+		`CREATE TABLE IF NOT EXISTS `+st+` (
+			Bucket VARCHAR(50) NOT NULL,
+			Slot SMALLINT UNSIGNED NOT NULL,
+			KeyCount BIGINT NOT NULL DEFAULT 0,
+			ByteSize BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (Bucket, Slot)
+		);`,
+		`CREATE TRIGGER `+p.defTableName+statsTriggers[0]+` AFTER INSERT ON `+p.defTableName+`
+		FOR EACH ROW
+		INSERT INTO `+st+` (Bucket, Slot, KeyCount, ByteSize) VALUES (NEW.Bucket, `+statsSlot(`NEW.KeyID`)+`, 1, COALESCE(LENGTH(NEW.Value), 0))
+		ON DUPLICATE KEY UPDATE KeyCount = KeyCount + 1, ByteSize = ByteSize + VALUES(ByteSize);`,
+		`CREATE TRIGGER `+p.defTableName+statsTriggers[1]+` AFTER UPDATE ON `+p.defTableName+`
+		FOR EACH ROW
+		BEGIN
+			UPDATE `+st+` SET KeyCount = KeyCount - 1, ByteSize = ByteSize - COALESCE(LENGTH(OLD.Value), 0)
+			WHERE Bucket = OLD.Bucket AND Slot = `+statsSlot(`OLD.KeyID`)+`;
+			INSERT INTO `+st+` (Bucket, Slot, KeyCount, ByteSize) VALUES (NEW.Bucket, `+statsSlot(`NEW.KeyID`)+`, 1, COALESCE(LENGTH(NEW.Value), 0))
+			ON DUPLICATE KEY UPDATE KeyCount = KeyCount + 1, ByteSize = ByteSize + VALUES(ByteSize);
+		END;`,
+		`CREATE TRIGGER `+p.defTableName+statsTriggers[2]+` AFTER DELETE ON `+p.defTableName+`
+		FOR EACH ROW
+		UPDATE `+st+` SET KeyCount = KeyCount - 1, ByteSize = ByteSize - COALESCE(LENGTH(OLD.Value), 0)
+		WHERE Bucket = OLD.Bucket AND Slot = `+statsSlot(`OLD.KeyID`)+`;`,
+	)
+	for _, s := range stmts {
+		if _, err = p.db.Exec(s); err != nil {
+			return err
+		}
+	}
+	// The stats are rebuilt once the triggers exist, so that no
+	// write made meanwhile goes uncounted
+	return p.rebuildStats()
+}
+
+// rebuildStats recounts the stats table from the key-value table in one
+// transaction, so Count never reads the table half rebuilt. It runs from
+// Open, which holds mu, so it begins the transaction on the pool rather
+// than through atomic. The connection must be open.
+func (p *MyPlainKV) rebuildStats() error {
+	st := p.statsTable()
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`DELETE FROM ` + st + `;`); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`REPLACE INTO ` + st + ` (Bucket, Slot, KeyCount, ByteSize)
+		SELECT Bucket, ` + statsSlot(`KeyID`) + `, COUNT(*), COALESCE(SUM(LENGTH(Value)), 0) FROM ` + p.defTableName + `
+		GROUP BY Bucket, ` + statsSlot(`KeyID`) + `;`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Count returns the number of live keys in the current bucket.
+// With BucketStats set, it reads the maintained stats instead of
+// counting rows, and those count expired keys until they are swept.
+func (p *MyPlainKV) Count() (int64, error) {
+	n, _, err := p.stats(p.currBuckt)
+	return n, err
+}
+
+// BucketSize returns the number of bytes stored in the current bucket,
+// including the parts of chunked values and leaving out expired keys.
+// With BucketStats set, it reads the maintained stats instead of
+// scanning rows, and those count expired keys until they are swept.
+func (p *MyPlainKV) BucketSize() (int64, error) {
+	_, n, err := p.stats(p.currBuckt)
+	return n, err
+}
+
+// stats returns the number of keys and bytes stored in a bucket, leaving
+// out expired keys unless read from the maintained stats. Views report
+// the keys and bytes of the bucket they read from in the end, matching
+// the pattern of every view on the way.
+func (p *MyPlainKV) stats(bucket string) (count, size int64, err error) {
+	var (
+		c, s int64
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return 0, 0, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if src, pats := p.shared().views.chain(bucket); pats != nil {
+		sqlstr := `SELECT COUNT(*), COALESCE(SUM(LENGTH(Value)), 0) FROM ` + p.defTableName + `
+		WHERE Bucket = ? AND ` + notExpired
+		args := []any{src}
+		for _, pat := range pats {
+			sqlstr += ` AND KeyID LIKE ?`
+			args = append(args, pat+`%`)
+		}
+		if err = p.queryRow(sqlstr+`;`, args...).Scan(&count, &size); err != nil {
+			return 0, 0, err
+		}
+		p.record(start, 1)
+		return count, size, nil
+	}
+
+	var sqlstr string
+	if p.BucketStats {
+		sqlstr = `SELECT COALESCE(SUM(KeyCount), 0), COALESCE(SUM(ByteSize), 0) FROM ` + p.statsTable() + `
+		WHERE Bucket = ?;`
+	} else {
+		sqlstr = `SELECT COUNT(*), COALESCE(SUM(LENGTH(Value)), 0) FROM ` + p.defTableName + `
+		WHERE Bucket = ? AND ` + notExpired + `;`
+	}
+	for i, b := range []string{bucket, partBucket(bucket)} {
+		err = p.queryRow(sqlstr, b).Scan(&c, &s)
+		if errors.Is(err, sql.ErrNoRows) {
+			c, s, err = 0, 0, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		// Parts add to the size, but are not keys of their own
+		if i == 0 {
+			count = c
+		}
+		size += s
+	}
+	p.record(start, 1)
+	return count, size, nil
+}
@@ -0,0 +1,238 @@
+package myplainkv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// PutReader stores everything read from r under the key. With
+// ChunkOversized set, payloads larger than one part are streamed into
+// parts as they are read, in one transaction, so their size is not
+// limited by MEDIUMBLOB and they are never held in memory whole.
+// Otherwise the payload is read into a single row, and one larger than
+// MEDIUMBLOB fails with ErrValueTooLong.
+func (p *MyPlainKV) PutReader(key string, r io.Reader) error {
+	return p.putReader(p.currBuckt, key, r)
+}
+
+func (p *MyPlainKV) putReader(bucket, key string, r io.Reader) (err error) {
+	var (
+		n     int
+		parts int
+		size  int64
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		p.autoClose = false
+		defer func() {
+			p.autoClose = true
+			p.Close()
+		}()
+	}
+	bucket = p.bucket(bucket)
+	buf := make([]byte, chunkSize)
+	n, err = io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// Small enough for a single row
+		return p.set(bucket, key, buf[:n])
+	}
+	if err != nil {
+		return err
+	}
+	if !p.ChunkOversized {
+		// Read one byte past the limit to tell a payload that fits from
+		// one that does not
+		var rest []byte
+		if rest, err = io.ReadAll(io.LimitReader(r, int64(maxValueLen-chunkSize+1))); err != nil {
+			return err
+		}
+		if chunkSize+len(rest) > maxValueLen {
+			return ErrValueTooLong
+		}
+		return p.set(bucket, key, append(buf, rest...))
+	}
+
+	if p.shared().views.get(bucket) != nil {
+		return ErrReadOnlyView
+	}
+	if len(bucket) > 50 || len(chunkBucket(bucket)) > 50 {
+		return ErrBucketIdTooLong
+	}
+	if len(key)+len(partSuffix) > 300 {
+		return ErrKeyTooLong
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return err
+	}
+	p.shared().misses.forget(bucket, key)
+	h := sha256.New()
+	err = p.atomic(func() error {
+		if err := p.dropParts(bucket, key); err != nil {
+			return err
+		}
+		for {
+			h.Write(buf[:n])
+			size += int64(n)
+			if _, err := p.upsert(partBucket(bucket), partKey(key, parts), buf[:n]); err != nil {
+				return err
+			}
+			parts++
+			var err error
+			n, err = io.ReadFull(r, buf)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return err
+			}
+		}
+		man, err := json.Marshal(chunkManifest{
+			Parts:  parts,
+			Size:   size,
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+		})
+		if err != nil {
+			return err
+		}
+		return p.writeManifest(bucket, key, man)
+	})
+	if err != nil {
+		return err
+	}
+	p.record(start, int64(parts))
+	return nil
+}
+
+// GetReader returns a reader of the value of the key. Chunked values are
+// read one part at a time as the reader is consumed, and verified at the
+// end; a value replaced while it is read fails with ErrChunkCorrupt.
+// A missing key reads as empty. The reader must be closed.
+func (p *MyPlainKV) GetReader(key string) (io.ReadCloser, error) {
+	return p.getReader(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) getReader(bucket, key string) (rc io.ReadCloser, err error) {
+	var (
+		val      []byte
+		found    bool
+		manifest []byte
+	)
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return nil, err
+	}
+	closer := &storeCloser{kv: p}
+	bucket = p.bucket(bucket)
+	// Views, upgraded buckets and remembered misses are read whole
+	if p.shared().views.get(bucket) != nil || p.shared().upgraders.get(bucket) != nil ||
+		(p.MissTTL > 0 && p.shared().misses.has(bucket, key)) {
+		if val, err = p.get(bucket, key); err != nil {
+			return nil, err
+		}
+		return readCloser{bytes.NewReader(val), closer}, nil
+	}
+	found, key, manifest, err = p.resolve(bucket, key, func(raw sql.RawBytes) error {
+		val = append(val, raw...)
+		return nil
+	})
+	if err != nil {
+		closer.Close()
+		return nil, err
+	}
+	if !found || manifest == nil {
+		return readCloser{bytes.NewReader(val), closer}, nil
+	}
+	cr := &chunkReader{
+		kv:     p,
+		bucket: bucket,
+		key:    key,
+		h:      sha256.New(),
+		closer: closer,
+	}
+	if err = json.Unmarshal(manifest, &cr.man); err != nil {
+		closer.Close()
+		return nil, fmt.Errorf(`%w: %s`, ErrChunkCorrupt, err)
+	}
+	return cr, nil
+}
+
+// storeCloser closes the store when a reader is closed, if the store
+// closes automatically
+type storeCloser struct {
+	kv     *MyPlainKV
+	closed bool
+}
+
+func (c *storeCloser) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.kv.autoClose {
+		return c.kv.Close()
+	}
+	return nil
+}
+
+// readCloser is a reader of a value already in memory
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// chunkReader reads a chunked value one part at a time
+type chunkReader struct {
+	kv     *MyPlainKV
+	bucket string
+	key    string
+	man    chunkManifest
+	next   int
+	size   int64
+	buf    []byte
+	h      hash.Hash
+	closer io.Closer
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next == r.man.Parts {
+			if r.size != r.man.Size || hex.EncodeToString(r.h.Sum(nil)) != r.man.SHA256 {
+				return 0, fmt.Errorf(`%w: %s`, ErrChunkCorrupt, r.key)
+			}
+			return 0, io.EOF
+		}
+		if err := r.kv.Open(); err != nil {
+			return 0, err
+		}
+		sqlstr := `SELECT Value FROM ` + r.kv.defTableName + ` WHERE Bucket = ? AND KeyID = ?;`
+		err := r.kv.queryRow(sqlstr, partBucket(r.bucket), partKey(r.key, r.next)).Scan(&r.buf)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf(`%w: %s`, ErrChunkCorrupt, r.key)
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.h.Write(r.buf)
+		r.size += int64(len(r.buf))
+		r.next++
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	return r.closer.Close()
+}
@@ -0,0 +1,85 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"time"
+)
+
+// reverseKeys adds the reversed-key column and its index to the table.
+// The connection must be open.
+func (p *MyPlainKV) reverseKeys() error {
+	if err := p.alter(`ADD COLUMN KeyRev VARCHAR(300) AS (REVERSE(KeyID)) STORED`); err != nil {
+		return err
+	}
+	return p.alter(`ADD INDEX IX_BucketKeyRev (Bucket, KeyRev)`)
+}
+
+// reverse reverses a string by characters, as REVERSE does in SQL
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// ListKeysBySuffix lists all keys ending with suffix in the current bucket.
+// With ReverseKeys set, the lookup uses an index on the reversed key.
+// Otherwise, it scans every key in the bucket.
+func (p *MyPlainKV) ListKeysBySuffix(suffix string) ([]string, error) {
+	return p.listKeysBySuffix(p.currBuckt, suffix)
+}
+
+func (p *MyPlainKV) listKeysBySuffix(bucket, suffix string) (val []string, err error) {
+	var (
+		k   string
+		sqr *sql.Rows
+	)
+
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	val = make([]string, 0)
+	if err = p.Open(); err != nil {
+		return val, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if v := p.shared().views.get(bucket); v != nil {
+		var keys []string
+		if keys, err = p.listView(v, `%`); err != nil {
+			return val, err
+		}
+		for _, k := range keys {
+			if likeMatch(k, `%`+escapeLike(suffix)) {
+				val = append(val, k)
+			}
+		}
+		return val, nil
+	}
+	if p.ReverseKeys {
+		sqr, err = p.query(
+			`SELECT KeyID FROM `+p.defTableName+` WHERE Bucket=? AND KeyRev LIKE ? AND `+notExpired+`;`,
+			bucket, escapeLike(reverse(suffix))+`%`)
+	} else {
+		sqr, err = p.query(
+			`SELECT KeyID FROM `+p.defTableName+` WHERE Bucket=? AND KeyID LIKE ? AND `+notExpired+`;`,
+			bucket, `%`+escapeLike(suffix))
+	}
+	if err != nil {
+		return val, err
+	}
+	defer sqr.Close()
+	for sqr.Next() {
+		if err = sqr.Scan(&k); err != nil {
+			return val, err
+		}
+		val = append(val, k)
+	}
+	if err = sqr.Err(); err != nil {
+		return val, err
+	}
+	p.record(start, int64(len(val)))
+	return val, nil
+}
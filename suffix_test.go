@@ -0,0 +1,20 @@
+package myplainkv
+
+import "testing"
+
+func TestReverse(t *testing.T) {
+	cases := []struct {
+		s, want string
+	}{
+		{``, ``},
+		{`a`, `a`},
+		{`.png`, `gnp.`},
+		{`café.txt`, `txt.éfac`},
+	}
+	for _, c := range cases {
+		if got := reverse(c.s); got != c.want {
+			t.Logf(`reverse(%q) = %q, want %q`, c.s, got, c.want)
+			t.Fail()
+		}
+	}
+}
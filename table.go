@@ -0,0 +1,77 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+const (
+	// maxTableName is the longest table name accepted. MySQL allows 64
+	// characters, less the longest suffix of the stats triggers.
+	maxTableName int = 64 - len(`_StatsIns`)
+)
+
+var (
+	ErrInvalidTableName error = errors.New(`table names may only hold letters, digits, underscores and dollar signs`)
+)
+
+// NewMyPlainKVTable creates a new MyPlainKV object keeping its records in
+// the named table instead of KeyValueTBL, so that several applications
+// can share a database. The name may be qualified by a schema, as in
+// `appdb.Settings`. Tables derived from it, such as the stats table,
+// are created next to it.
+func NewMyPlainKVTable(dsn, table string, autoClose bool) (*MyPlainKV, error) {
+	if !validTableName(table) {
+		return nil, ErrInvalidTableName
+	}
+	p := NewMyPlainKV(dsn, autoClose)
+	p.defTableName = table
+	return p, nil
+}
+
+// NewFromDBTable creates a new MyPlainKV object on a connection pool the
+// application manages, as NewFromDB does, keeping its records in the
+// named table as NewMyPlainKVTable does
+func NewFromDBTable(db *sql.DB, table string) (*MyPlainKV, error) {
+	if !validTableName(table) {
+		return nil, ErrInvalidTableName
+	}
+	p := NewFromDB(db)
+	p.defTableName = table
+	return p, nil
+}
+
+// validTableName reports whether a table name, optionally qualified by a
+// schema, is safe to write into statements unquoted. Identifiers cannot
+// be bound as parameters, hence the check.
+func validTableName(name string) bool {
+	parts := strings.Split(name, `.`)
+	if len(parts) > 2 {
+		return false
+	}
+	for i, s := range parts {
+		max := maxTableName
+		if i < len(parts)-1 {
+			max = 64
+		}
+		if s == "" || len(s) > max {
+			return false
+		}
+		// A name of digits only would read as a number
+		if strings.Trim(s, `0123456789`) == "" ||
+			strings.Trim(s, `abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_$`) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// splitTable returns the schema and the name of the table. The schema is
+// empty for a table in the default database of the connection.
+func splitTable(name string) (string, string) {
+	if i := strings.LastIndex(name, `.`); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
@@ -0,0 +1,51 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestValidTableName(t *testing.T) {
+	for name, want := range map[string]bool{
+		`KeyValueTBL`:          true,
+		`app_kv`:               true,
+		`appdb.Settings`:       true,
+		`kv$1`:                 true,
+		``:                     false,
+		`123`:                  false,
+		`a.b.c`:                false,
+		`.kv`:                  false,
+		`kv; DROP TABLE users`: false,
+		"kv`":                  false,
+		`this_name_is_far_too_long_to_leave_room_for_the_trigger_suffix`: false,
+	} {
+		if got := validTableName(name); got != want {
+			t.Logf(`validTableName(%q) = %v, expected %v`, name, got, want)
+			t.Fail()
+		}
+	}
+}
+
+func TestSplitTable(t *testing.T) {
+	if s, n := splitTable(`appdb.Settings`); s != `appdb` || n != `Settings` {
+		t.Logf(`Expected appdb and Settings, got %q and %q`, s, n)
+		t.Fail()
+	}
+	if s, n := splitTable(`KeyValueTBL`); s != `` || n != `KeyValueTBL` {
+		t.Logf(`Expected no schema, got %q and %q`, s, n)
+		t.Fail()
+	}
+	if _, err := NewMyPlainKVTable(`dsn`, `bad name`, false); err != ErrInvalidTableName {
+		t.Logf(`Expected ErrInvalidTableName, got %v`, err)
+		t.Fail()
+	}
+	if _, err := NewFromDBTable(nil, `bad name`); err != ErrInvalidTableName {
+		t.Logf(`Expected ErrInvalidTableName, got %v`, err)
+		t.Fail()
+	}
+	db := &sql.DB{}
+	if p, err := NewFromDBTable(db, `appdb.Settings`); err != nil || p.defTableName != `appdb.Settings` || p.extDB != db {
+		t.Logf(`Expected a store on the pool using appdb.Settings, got %v`, err)
+		t.Fail()
+	}
+}
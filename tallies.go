@@ -0,0 +1,247 @@
+package myplainkv
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrTallyBound error = errors.New(`tally would cross its bound`)
+)
+
+// TallyIncrBounded adds delta to the tally only if the new value stays
+// within min and max, returning ErrTallyBound and leaving the tally
+// unchanged otherwise. The check and the update are one statement, so
+// concurrent callers can never push the tally past a bound. A missing
+// tally starts at zero. Pass math.MinInt64 or math.MaxInt64 for a tally
+// bounded on one side only.
+func (p *MyPlainKV) TallyIncrBounded(key string, delta, min, max int64) (int64, error) {
+	return p.tallyAddBounded(p.currBuckt, key, delta, min, max)
+}
+
+func (p *MyPlainKV) tallyAddBounded(bucket, key string, delta, min, max int64) (n int64, err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return -1, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return -1, ErrReadOnlyView
+	}
+	if err = p.checkWrite(bucket); err != nil {
+		return -1, err
+	}
+	tk := fmt.Sprintf(tallyKey, key)
+	if len(tk) > 300 {
+		return -1, ErrKeyTooLong
+	}
+	p.shared().misses.forget(bucket, tk)
+
+	// The assignments run in order and later ones see the new values, so
+	// Version and Value are set from the old row first. An expired tally
+	// counts as zero, so it is revived only if delta is within bounds. A
+	// tally left out of bounds is not changed at all, so no row is
+	// affected.
+	const (
+		curr   string = `IF(ExpiresAt <= NOW(6), 0, CAST(Value AS SIGNED))`
+		within string = `(` + curr + ` + ? BETWEEN ? AND ?)`
+	)
+	sqlstr := `
+	INSERT INTO ` + p.defTableName + ` (Bucket, KeyID, Value) VALUES (?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		Version = IF(` + within + `, Version + 1, Version),
+		Value = IF(` + within + `, LAST_INSERT_ID(` + curr + ` + ?), Value),
+		ExpiresAt = IF(ExpiresAt <= NOW(6) AND ? BETWEEN ? AND ?, NULL, ExpiresAt);`
+	args := []any{
+		bucket, tk, []byte(strconv.FormatInt(delta, 10)),
+		delta, min, max,
+		delta, min, max, delta,
+		delta, min, max,
+	}
+	if delta < min || delta > max {
+		// A missing tally would be created out of bounds, so only an
+		// existing one may be updated
+		sqlstr = `
+		UPDATE ` + p.defTableName + ` SET
+			Version = Version + 1,
+			Value = LAST_INSERT_ID(` + curr + ` + ?),
+			ExpiresAt = IF(ExpiresAt <= NOW(6), NULL, ExpiresAt)
+		WHERE Bucket = ? AND KeyID = ? AND ` + within + `;`
+		args = []any{delta, bucket, tk, delta, min, max}
+	}
+	res, err := p.exec(sqlstr, args...)
+	if err != nil {
+		return -1, err
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+	p.record(start, ra)
+	switch {
+	case ra == 0:
+		return -1, ErrTallyBound
+	case ra == 1 && delta >= min && delta <= max:
+		// Inserted
+		return delta, nil
+	}
+	return res.LastInsertId()
+}
+
+// TallyIncrMany adds the deltas to their tallies in one transaction,
+// sending one statement per 500 tallies, and returns the new values.
+// Missing tallies start from zero.
+func (p *MyPlainKV) TallyIncrMany(deltas map[string]int64) (map[string]int64, error) {
+	return p.tallyIncrMany(p.currBuckt, deltas)
+}
+
+func (p *MyPlainKV) tallyIncrMany(bucket string, deltas map[string]int64) (vals map[string]int64, err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	vals = make(map[string]int64, len(deltas))
+	if len(deltas) == 0 {
+		return vals, nil
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return vals, ErrReadOnlyView
+	}
+	// Keys are sorted so concurrent callers lock rows in the same order
+	keys := make([]string, 0, len(deltas))
+	for k := range deltas {
+		tk := fmt.Sprintf(tallyKey, k)
+		if len(tk) > 300 {
+			return vals, ErrKeyTooLong
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	err = p.atomic(func() error {
+		if err := p.checkMaintenance(); err != nil {
+			return err
+		}
+		for rest := keys; len(rest) > 0; {
+			n := len(rest)
+			if n > batchSize {
+				n = batchSize
+			}
+			args := make([]any, 0, n*3)
+			for _, k := range rest[:n] {
+				tk := fmt.Sprintf(tallyKey, k)
+				p.shared().misses.forget(bucket, tk)
+				args = append(args, bucket, tk, []byte(strconv.FormatInt(deltas[k], 10)))
+			}
+			// An expired tally starts again from zero
+			sqlstr := `
+			INSERT INTO ` + p.defTableName + ` (Bucket, KeyID, Value) VALUES ` + placeholders(n, `(?, ?, ?)`) + `
+			ON DUPLICATE KEY UPDATE
+				Value = IF(ExpiresAt <= NOW(6), 0, CAST(Value AS SIGNED)) + CAST(VALUES(Value) AS SIGNED),
+				ExpiresAt = IF(ExpiresAt <= NOW(6), NULL, ExpiresAt),
+				Version = Version + 1;`
+			if _, err := p.exec(sqlstr, args...); err != nil {
+				return err
+			}
+			rest = rest[n:]
+		}
+		// The new values are read in the same transaction, so they are
+		// exactly those written
+		var err error
+		vals, err = p.readTallies(bucket, keys)
+		return err
+	})
+	if err != nil {
+		return make(map[string]int64), err
+	}
+	p.record(start, int64(len(vals)))
+	return vals, nil
+}
+
+// TallyGetMany reads several tallies in one query per 500 keys,
+// without creating missing ones. Missing and expired tallies read 0.
+func (p *MyPlainKV) TallyGetMany(keys []string) (map[string]int64, error) {
+	return p.tallyGetMany(p.currBuckt, keys)
+}
+
+func (p *MyPlainKV) tallyGetMany(bucket string, keys []string) (vals map[string]int64, err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return make(map[string]int64), err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	if vals, err = p.readTallies(p.bucket(bucket), keys); err != nil {
+		return make(map[string]int64), err
+	}
+	p.record(start, int64(len(vals)))
+	return vals, nil
+}
+
+// readTallies reads the tallies of the keys, with 0 for missing ones.
+// The connection must be open.
+func (p *MyPlainKV) readTallies(bucket string, keys []string) (map[string]int64, error) {
+	var (
+		tk string
+		v  int64
+	)
+	vals := make(map[string]int64, len(keys))
+	names := make(map[string]string, len(keys))
+	for _, k := range keys {
+		vals[k] = 0
+		names[fmt.Sprintf(tallyKey, k)] = k
+	}
+	for rest := keys; len(rest) > 0; {
+		n := len(rest)
+		if n > batchSize {
+			n = batchSize
+		}
+		args := []any{bucket}
+		for _, k := range rest[:n] {
+			args = append(args, fmt.Sprintf(tallyKey, k))
+		}
+		sqlstr := `
+		SELECT KeyID, CAST(Value AS SIGNED) FROM ` + p.defTableName + `
+		WHERE Bucket = ? AND KeyID IN (` + placeholders(n, `?`) + `) AND ` + notExpired + `;`
+		sqr, err := p.query(sqlstr, args...)
+		if err != nil {
+			return vals, err
+		}
+		for sqr.Next() {
+			if err = sqr.Scan(&tk, &v); err != nil {
+				sqr.Close()
+				return vals, err
+			}
+			vals[names[tk]] = v
+		}
+		sqr.Close()
+		if err = sqr.Err(); err != nil {
+			return vals, err
+		}
+		rest = rest[n:]
+	}
+	return vals, nil
+}
+
+// TallyIncrMany adds the deltas to their tallies in the bucket
+func (b *Bucket) TallyIncrMany(deltas map[string]int64) (map[string]int64, error) {
+	return b.kv.tallyIncrMany(b.name, deltas)
+}
+
+// TallyGetMany reads several tallies of the bucket
+func (b *Bucket) TallyGetMany(keys []string) (map[string]int64, error) {
+	return b.kv.tallyGetMany(b.name, keys)
+}
+
+// TallyIncrBounded adds delta to the tally of the bucket only if the new
+// value stays within min and max
+func (b *Bucket) TallyIncrBounded(key string, delta, min, max int64) (int64, error) {
+	return b.kv.tallyAddBounded(b.name, key, delta, min, max)
+}
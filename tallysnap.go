@@ -0,0 +1,239 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	tallySnapBuckt string = `--tsnap--`
+
+	// tallySnapFormat names snapshots by the UTC time they were taken, so
+	// that they sort in the order they were taken
+	tallySnapFormat string = `20060102150405`
+)
+
+// tallySnapBucket returns the bucket holding the tally snapshots of a
+// bucket
+func tallySnapBucket(bucket string) string {
+	return tallySnapBuckt + bucket
+}
+
+// TallySnapshot copies the current values of the tallies whose names
+// start with the prefix into a new snapshot, and returns its name. The
+// copy is one statement, so it is consistent. Snapshots are named by the
+// UTC time they were taken, to the second; a second snapshot taken in
+// the same second replaces the first.
+func (p *MyPlainKV) TallySnapshot(prefix string) (string, error) {
+	return p.tallySnapshot(p.currBuckt, prefix)
+}
+
+func (p *MyPlainKV) tallySnapshot(bucket, prefix string) (snap string, err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return "", err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return "", err
+	}
+	bucket = p.bucket(bucket)
+	snap = start.UTC().Format(tallySnapFormat)
+	tp := fmt.Sprintf(tallyKey, "")
+	// Expired tallies read as zero, so they are left out
+	sqlstr := `
+	INSERT INTO ` + p.defTableName + ` (Bucket, KeyID, Value)
+	SELECT ?, CONCAT(?, SUBSTRING(KeyID, ?)), Value FROM ` + p.defTableName + `
+	WHERE Bucket = ? AND KeyID LIKE ? AND ` + notExpired + `
+	ON DUPLICATE KEY UPDATE Value = VALUES(Value), Version = Version + 1;`
+	res, err := p.exec(sqlstr, tallySnapBucket(bucket), snap+`/`, len(tp)+1,
+		bucket, escapeLike(tp+prefix)+`%`)
+	if err != nil {
+		return "", err
+	}
+	n, _ := res.RowsAffected()
+	p.record(start, n)
+	return snap, nil
+}
+
+// TallyDelta returns how much each tally whose name starts with the
+// prefix changed between two snapshots. A tally missing from a snapshot
+// counts as zero there.
+func (p *MyPlainKV) TallyDelta(prefix, fromSnapshot, toSnapshot string) (map[string]int64, error) {
+	return p.tallyDelta(p.currBuckt, prefix, fromSnapshot, toSnapshot)
+}
+
+func (p *MyPlainKV) tallyDelta(bucket, prefix, from, to string) (delta map[string]int64, err error) {
+	var (
+		sqr  *sql.Rows
+		snap string
+		name string
+		v    int64
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	delta = make(map[string]int64)
+	if err = p.Open(); err != nil {
+		return delta, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	sqlstr := `
+	SELECT SUBSTRING_INDEX(KeyID, '/', 1), SUBSTRING(KeyID, LOCATE('/', KeyID) + 1), CAST(Value AS SIGNED)
+	FROM ` + p.defTableName + `
+	WHERE Bucket = ? AND (KeyID LIKE ? OR KeyID LIKE ?);`
+	if sqr, err = p.query(sqlstr, tallySnapBucket(bucket),
+		escapeLike(from+`/`+prefix)+`%`, escapeLike(to+`/`+prefix)+`%`); err != nil {
+		return delta, err
+	}
+	defer sqr.Close()
+	for sqr.Next() {
+		if err = sqr.Scan(&snap, &name, &v); err != nil {
+			return make(map[string]int64), err
+		}
+		if _, ok := delta[name]; !ok {
+			delta[name] = 0
+		}
+		// A snapshot compared with itself shows no change
+		if from == to {
+			continue
+		}
+		if snap == to {
+			delta[name] += v
+		} else {
+			delta[name] -= v
+		}
+	}
+	if err = sqr.Err(); err != nil {
+		return make(map[string]int64), err
+	}
+	p.record(start, int64(len(delta)))
+	return delta, nil
+}
+
+// TallySnapshots lists the names of the snapshots taken, oldest first
+func (p *MyPlainKV) TallySnapshots() ([]string, error) {
+	return p.tallySnapshots(p.currBuckt)
+}
+
+func (p *MyPlainKV) tallySnapshots(bucket string) (val []string, err error) {
+	var (
+		sqr  *sql.Rows
+		snap string
+	)
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	val = make([]string, 0)
+	if err = p.Open(); err != nil {
+		return val, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	sqlstr := `
+	SELECT DISTINCT SUBSTRING_INDEX(KeyID, '/', 1) AS Snap FROM ` + p.defTableName + `
+	WHERE Bucket = ? ORDER BY Snap;`
+	if sqr, err = p.query(sqlstr, tallySnapBucket(p.bucket(bucket))); err != nil {
+		return val, err
+	}
+	defer sqr.Close()
+	for sqr.Next() {
+		if err = sqr.Scan(&snap); err != nil {
+			return make([]string, 0), err
+		}
+		val = append(val, snap)
+	}
+	if err = sqr.Err(); err != nil {
+		return make([]string, 0), err
+	}
+	p.record(start, int64(len(val)))
+	return val, nil
+}
+
+// DropTallySnapshot deletes a snapshot
+func (p *MyPlainKV) DropTallySnapshot(snapshot string) error {
+	return p.dropTallySnapshot(p.currBuckt, snapshot)
+}
+
+func (p *MyPlainKV) dropTallySnapshot(bucket, snap string) (err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return err
+	}
+	sqlstr := `DELETE FROM ` + p.defTableName + ` WHERE Bucket = ? AND KeyID LIKE ?;`
+	res, err := p.exec(sqlstr, tallySnapBucket(p.bucket(bucket)), escapeLike(snap+`/`)+`%`)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	p.record(start, n)
+	return nil
+}
+
+// StartTallySnapshots starts taking a snapshot of the tallies of a bucket
+// whose names start with the prefix at every interval. The returned
+// function stops it and waits for a snapshot in progress to finish.
+func (p *MyPlainKV) StartTallySnapshots(bucket, prefix string, interval time.Duration) (stop func()) {
+	sn := p.detached()
+	bucket = p.bucket(bucket)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				sn.Close()
+				return
+			case <-t.C:
+				// A failed snapshot is not retried; the next one is taken
+				// on schedule
+				sn.tallySnapshot(bucket, prefix)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// TallySnapshot copies the tallies of the bucket starting with the
+// prefix into a new snapshot
+func (b *Bucket) TallySnapshot(prefix string) (string, error) {
+	return b.kv.tallySnapshot(b.name, prefix)
+}
+
+// TallyDelta returns how much each tally of the bucket starting with the
+// prefix changed between two snapshots
+func (b *Bucket) TallyDelta(prefix, fromSnapshot, toSnapshot string) (map[string]int64, error) {
+	return b.kv.tallyDelta(b.name, prefix, fromSnapshot, toSnapshot)
+}
+
+// TallySnapshots lists the snapshots of the tallies of the bucket
+func (b *Bucket) TallySnapshots() ([]string, error) {
+	return b.kv.tallySnapshots(b.name)
+}
+
+// DropTallySnapshot deletes a snapshot of the tallies of the bucket
+func (b *Bucket) DropTallySnapshot(snapshot string) error {
+	return b.kv.dropTallySnapshot(b.name, snapshot)
+}
@@ -0,0 +1,274 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// notExpired is the condition excluding expired keys from reads
+	notExpired string = `(ExpiresAt IS NULL OR ExpiresAt > NOW(6))`
+
+	// sweepBatch is the number of expired keys the sweeper deletes
+	// per query
+	sweepBatch int = 1000
+)
+
+const (
+	TTLNone    time.Duration = -1 // Returned by TTL for a key without expiry
+	TTLMissing time.Duration = -2 // Returned by TTL for a missing key
+)
+
+// SetWithTTL creates or updates the record by the value. The key
+// expires after ttl, spread by TTLJitter, and then behaves as missing.
+func (p *MyPlainKV) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	return p.setWithTTL(p.currBuckt, key, value, ttl)
+}
+
+func (p *MyPlainKV) setWithTTL(bucket, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return p.set(bucket, key, value)
+	}
+	return p.atomic(func() error {
+		if err := p.set(bucket, key, value); err != nil {
+			return err
+		}
+		_, err := p.expire(bucket, key, ttl)
+		return err
+	})
+}
+
+// Expire sets the key to expire after ttl, replacing any previous
+// expiry. With TTLJitter set, ttl is spread randomly. A ttl of zero or
+// less deletes the key. It reports whether the key exists.
+func (p *MyPlainKV) Expire(key string, ttl time.Duration) (bool, error) {
+	return p.expire(p.currBuckt, key, ttl)
+}
+
+func (p *MyPlainKV) expire(bucket, key string, ttl time.Duration) (ok bool, err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return false, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return false, ErrReadOnlyView
+	}
+	if ttl <= 0 {
+		var d time.Duration
+		if d, err = p.ttl(bucket, key); err != nil {
+			return false, err
+		}
+		return d != TTLMissing, p.del(bucket, key)
+	}
+	if err = p.checkWrite(bucket); err != nil {
+		return false, err
+	}
+	sqlstr := `UPDATE ` + p.defTableName + ` SET ExpiresAt = NOW(6) + INTERVAL ? MICROSECOND
+	WHERE Bucket = ? AND KeyID = ? AND ` + notExpired + `;`
+	res, err := p.exec(sqlstr, p.jitter(ttl).Microseconds(), bucket, key)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	p.record(start, n)
+	return n > 0, nil
+}
+
+// jitter spreads a TTL by up to TTLJitter of it either way, so keys set
+// together do not all expire together
+func (p *MyPlainKV) jitter(ttl time.Duration) time.Duration {
+	f := p.TTLJitter
+	if f <= 0 {
+		return ttl
+	}
+	if f > 1 {
+		f = 1
+	}
+	spread := time.Duration((rand.Float64()*2 - 1) * f * float64(ttl))
+	if ttl+spread <= 0 {
+		// A key set with a TTL never expires at once
+		return time.Microsecond
+	}
+	return ttl + spread
+}
+
+// TTL returns the time left before the key expires. It returns TTLNone
+// if the key does not expire and TTLMissing if it does not exist.
+func (p *MyPlainKV) TTL(key string) (time.Duration, error) {
+	return p.ttl(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) ttl(bucket, key string) (d time.Duration, err error) {
+	var left sql.NullInt64
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return TTLMissing, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	sqlstr := `SELECT TIMESTAMPDIFF(MICROSECOND, NOW(6), ExpiresAt) FROM ` + p.defTableName + `
+	WHERE Bucket = ? AND KeyID = ? AND ` + notExpired + `;`
+	err = p.queryRow(sqlstr, p.bucket(bucket), key).Scan(&left)
+	if errors.Is(err, sql.ErrNoRows) {
+		p.record(start, 0)
+		return TTLMissing, nil
+	}
+	if err != nil {
+		return TTLMissing, err
+	}
+	p.record(start, 1)
+	if !left.Valid {
+		return TTLNone, nil
+	}
+	return time.Duration(left.Int64) * time.Microsecond, nil
+}
+
+// Persist removes the expiry of the key. It reports whether the key
+// had one.
+func (p *MyPlainKV) Persist(key string) (bool, error) {
+	return p.persist(p.currBuckt, key)
+}
+
+func (p *MyPlainKV) persist(bucket, key string) (ok bool, err error) {
+	start := time.Now()
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return false, err
+	}
+	if p.autoClose {
+		defer p.Close()
+	}
+	bucket = p.bucket(bucket)
+	if p.shared().views.get(bucket) != nil {
+		return false, ErrReadOnlyView
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return false, err
+	}
+	sqlstr := `UPDATE ` + p.defTableName + ` SET ExpiresAt = NULL
+	WHERE Bucket = ? AND KeyID = ? AND ExpiresAt > NOW(6);`
+	res, err := p.exec(sqlstr, bucket, key)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	p.record(start, n)
+	return n > 0, nil
+}
+
+// StartExpirySweeper starts deleting expired keys every interval, along
+// with their aliases, chunks and references. Until then, expired keys
+// only behave as missing. The sweeper runs on its own connection pool,
+// and skips its turn while the store is in maintenance. Calling the
+// returned function stops it.
+func (p *MyPlainKV) StartExpirySweeper(interval time.Duration) (stop func()) {
+	sw := p.detached()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				sw.Close()
+				return
+			case <-t.C:
+				// Errors are left for the next turn to retry
+				sw.sweep()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// sweep deletes expired keys in batches until none are left
+func (p *MyPlainKV) sweep() (err error) {
+	type expiredKey struct {
+		bucket, key string
+	}
+	defer func() { p.noteErr(err) }()
+	if err = p.Open(); err != nil {
+		return err
+	}
+	if err = p.checkMaintenance(); err != nil {
+		return err
+	}
+	sqlstr := `SELECT Bucket, KeyID FROM ` + p.defTableName + `
+	WHERE ExpiresAt <= NOW(6) LIMIT ?;`
+	for {
+		keys := make([]expiredKey, 0, sweepBatch)
+		sqr, err := p.query(sqlstr, sweepBatch)
+		if err != nil {
+			return err
+		}
+		for sqr.Next() {
+			var k expiredKey
+			if err = sqr.Scan(&k.bucket, &k.key); err != nil {
+				sqr.Close()
+				return err
+			}
+			keys = append(keys, k)
+		}
+		sqr.Close()
+		if err = sqr.Err(); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			// The key may have been set again since it was listed
+			if _, err = p.purge(k.bucket, k.key, `ExpiresAt <= NOW(6)`); err != nil {
+				return err
+			}
+		}
+		if len(keys) < sweepBatch {
+			return nil
+		}
+	}
+}
+
+// purge deletes a key along with its aliases, chunks and references if
+// it still meets the condition. It reports whether the key was deleted.
+func (p *MyPlainKV) purge(bucket, key, cond string, args ...any) (bool, error) {
+	var n int64
+	err := p.atomic(func() error {
+		res, err := p.exec(
+			`DELETE FROM `+p.defTableName+` WHERE Bucket = ? AND KeyID = ? AND `+cond+`;`,
+			append([]any{bucket, key}, args...)...)
+		if err != nil {
+			return err
+		}
+		if n, _ = res.RowsAffected(); n == 0 {
+			return nil
+		}
+		return p.detach(bucket, key)
+	})
+	return n > 0, err
+}
+
+// SetWithTTL creates or updates the record of the bucket by the value,
+// expiring after ttl
+func (b *Bucket) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	return b.kv.setWithTTL(b.name, key, value, ttl)
+}
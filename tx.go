@@ -0,0 +1,305 @@
+package myplainkv
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	ErrNoTransaction    error = errors.New(`no transaction in progress`)
+	ErrInvalidSavepoint error = errors.New(`savepoint names may only hold letters, digits and underscores`)
+)
+
+const (
+	// txRetries is how many times WithTransaction retries a transaction
+	// chosen as a deadlock victim
+	txRetries int = 4
+
+	// txBackoff is the wait before the first retry, doubled for each
+	// retry after it
+	txBackoff time.Duration = 20 * time.Millisecond
+)
+
+// Tx is a transaction. Every operation through it runs in the
+// transaction, and operations on the store or on other transactions
+// never do, so transactions of one store can run side by side from
+// different goroutines. Only data operations are offered, on the
+// current bucket of the store when the transaction began or on another
+// through Bucket. A Tx is for one goroutine, and is finished by Commit
+// or Rollback.
+type Tx struct {
+	kv *MyPlainKV
+}
+
+// NewTx begins a transaction bound to ctx. If ctx is done before the
+// transaction is committed, the transaction is rolled back. The
+// transaction starts in the current bucket of the store.
+func (p *MyPlainKV) NewTx(ctx context.Context) (*Tx, error) {
+	s := p.Session()
+	// The transaction keeps its connection until it is finished
+	s.autoClose = false
+	if err := s.Open(); err != nil {
+		return nil, err
+	}
+	if err := s.BeginCtx(ctx); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return &Tx{kv: s}, nil
+}
+
+// Commit commits the transaction and releases its connection
+func (t *Tx) Commit() error {
+	defer t.finish()
+	return t.kv.Commit()
+}
+
+// Rollback rolls back the transaction and releases its connection
+func (t *Tx) Rollback() error {
+	defer t.finish()
+	return t.kv.Rollback()
+}
+
+// finish releases the connection of the transaction. Even if Commit or
+// Rollback failed, the transaction is over.
+func (t *Tx) finish() {
+	t.kv.setTx(nil)
+	t.kv.Close()
+}
+
+// Bucket returns a handle to a bucket whose operations run in the
+// transaction
+func (t *Tx) Bucket(name string) *Bucket {
+	return t.kv.Bucket(name)
+}
+
+// LastResult returns the result of the last operation in the transaction
+func (t *Tx) LastResult() Result {
+	return t.kv.LastResult()
+}
+
+// Savepoint marks a point in the transaction that RollbackTo can return
+// to, as MyPlainKV.Savepoint does
+func (t *Tx) Savepoint(name string) error {
+	return t.kv.Savepoint(name)
+}
+
+// RollbackTo undoes the changes made since the savepoint was set
+func (t *Tx) RollbackTo(name string) error {
+	return t.kv.RollbackTo(name)
+}
+
+// ReleaseSavepoint drops the savepoint and the ones after it
+func (t *Tx) ReleaseSavepoint(name string) error {
+	return t.kv.ReleaseSavepoint(name)
+}
+
+// Get retrieves a record using a key
+func (t *Tx) Get(key string) ([]byte, error) {
+	return t.kv.Get(key)
+}
+
+// GetInto retrieves a record using a key and appends its value to buf
+func (t *Tx) GetInto(key string, buf []byte) ([]byte, error) {
+	return t.kv.GetInto(key, buf)
+}
+
+// GetWithVersion retrieves a record and its version
+func (t *Tx) GetWithVersion(key string) ([]byte, uint64, error) {
+	return t.kv.GetWithVersion(key)
+}
+
+// Set creates or updates the record by the value
+func (t *Tx) Set(key string, value []byte) error {
+	return t.kv.Set(key, value)
+}
+
+// SetWithTTL creates or updates the record by the value, expiring
+// after ttl
+func (t *Tx) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	return t.kv.SetWithTTL(key, value, ttl)
+}
+
+// SetNX creates the record only if the key does not exist
+func (t *Tx) SetNX(key string, value []byte) (bool, error) {
+	return t.kv.SetNX(key, value)
+}
+
+// SetIfVersion updates the record only if its version is still expected
+func (t *Tx) SetIfVersion(key string, value []byte, expected uint64) error {
+	return t.kv.SetIfVersion(key, value, expected)
+}
+
+// Del deletes a record with the provided key
+func (t *Tx) Del(key string) error {
+	return t.kv.Del(key)
+}
+
+// Exists reports whether the key exists
+func (t *Tx) Exists(key string) (bool, error) {
+	return t.kv.Exists(key)
+}
+
+// MGet retrieves several records
+func (t *Tx) MGet(keys []string) (map[string][]byte, error) {
+	return t.kv.MGet(keys)
+}
+
+// MSet creates or updates several records
+func (t *Tx) MSet(values map[string][]byte) error {
+	return t.kv.MSet(values)
+}
+
+// MDel deletes several records
+func (t *Tx) MDel(keys []string) error {
+	return t.kv.MDel(keys)
+}
+
+// ListKeys lists the keys starting with the pattern
+func (t *Tx) ListKeys(pattern string) ([]string, error) {
+	return t.kv.ListKeys(pattern)
+}
+
+// GetMime returns the MIME type of the key
+func (t *Tx) GetMime(key string) (string, error) {
+	return t.kv.GetMime(key)
+}
+
+// SetMime sets the MIME type of the key
+func (t *Tx) SetMime(key string, mime string) error {
+	return t.kv.SetMime(key, mime)
+}
+
+// Expire sets the key to expire after ttl
+func (t *Tx) Expire(key string, ttl time.Duration) (bool, error) {
+	return t.kv.Expire(key, ttl)
+}
+
+// TTL returns the time left before the key expires
+func (t *Tx) TTL(key string) (time.Duration, error) {
+	return t.kv.TTL(key)
+}
+
+// Persist removes the expiry of the key
+func (t *Tx) Persist(key string) (bool, error) {
+	return t.kv.Persist(key)
+}
+
+// Tally returns the tally of the key, creating it at offset if missing
+func (t *Tx) Tally(key string, offset int) (int, error) {
+	return t.kv.Tally(key, offset)
+}
+
+// TallyIncr increments the tally of the key
+func (t *Tx) TallyIncr(key string) (int, error) {
+	return t.kv.TallyIncr(key)
+}
+
+// TallyDecr decrements the tally of the key
+func (t *Tx) TallyDecr(key string) (int, error) {
+	return t.kv.TallyDecr(key)
+}
+
+// TallyIncrBy adds delta to the tally of the key
+func (t *Tx) TallyIncrBy(key string, delta int64) (int64, error) {
+	return t.kv.TallyIncrBy(key, delta)
+}
+
+// TallyDecrBy subtracts delta from the tally of the key
+func (t *Tx) TallyDecrBy(key string, delta int64) (int64, error) {
+	return t.kv.TallyDecrBy(key, delta)
+}
+
+// TallyReset resets the tally of the key
+func (t *Tx) TallyReset(key string) error {
+	return t.kv.TallyReset(key)
+}
+
+// WithTransaction runs fn in a new transaction, committing if fn returns
+// nil and rolling back if it returns an error or panics. A panic is
+// raised again after the rollback. If MySQL picks the transaction as a
+// deadlock victim, it is run again from the start after a backoff, so
+// fn must be safe to repeat. LastResult reports the number of retries.
+func (p *MyPlainKV) WithTransaction(ctx context.Context, fn func(tx *Tx) error) error {
+	var (
+		err error
+		try int
+	)
+	start := time.Now()
+	defer func() { p.recordRetries(start, 0, try) }()
+	wait := txBackoff
+	for ; ; try++ {
+		if err = p.runTx(ctx, fn); !isDeadlock(err) || try == txRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// runTx runs fn once in a new transaction
+func (p *MyPlainKV) runTx(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	tx, err := p.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// isDeadlock reports whether err is MySQL choosing the transaction as a
+// deadlock victim
+func isDeadlock(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == 1213
+}
+
+// Savepoint marks a point in the transaction that RollbackTo can return
+// to without abandoning the rest of the transaction. Setting a savepoint
+// with the name of an existing one moves it.
+func (p *MyPlainKV) Savepoint(name string) error {
+	return p.savepoint(`SAVEPOINT`, name)
+}
+
+// RollbackTo undoes the changes made since the savepoint was set. The
+// savepoint is kept, and later ones are dropped.
+func (p *MyPlainKV) RollbackTo(name string) error {
+	return p.savepoint(`ROLLBACK TO SAVEPOINT`, name)
+}
+
+// ReleaseSavepoint drops the savepoint and the ones after it, keeping
+// the changes made since
+func (p *MyPlainKV) ReleaseSavepoint(name string) error {
+	return p.savepoint(`RELEASE SAVEPOINT`, name)
+}
+
+// savepoint runs a savepoint statement in the current transaction
+func (p *MyPlainKV) savepoint(stmt, name string) (err error) {
+	defer func() { p.noteErr(err) }()
+	if !p.inTransaction {
+		return ErrNoTransaction
+	}
+	if name == "" || strings.Trim(name, `abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_`) != "" {
+		return ErrInvalidSavepoint
+	}
+	// Identifiers cannot be bound as parameters, hence the check above
+	_, err = p.exec(stmt + " `" + name + "`;")
+	return err
+}
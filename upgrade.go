@@ -0,0 +1,74 @@
+package myplainkv
+
+import (
+	"errors"
+	"sync"
+)
+
+// Upgrader converts a value stored in an older format. It returns the
+// converted value and true, or false if the value is already current.
+type Upgrader func(old []byte) ([]byte, bool)
+
+// upgraderSet holds the upgraders registered on a store
+type upgraderSet struct {
+	mu  sync.RWMutex
+	fns map[string]Upgrader
+}
+
+func (us *upgraderSet) get(bucket string) Upgrader {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+	return us.fns[bucket]
+}
+
+// RegisterUpgrader sets fn to run on every value Get reads from the
+// bucket. Values fn converts are returned converted and written back,
+// unless the key was changed since it was read, so the bucket migrates
+// as it is used. Passing a nil fn removes the upgrader. Upgraders are
+// registered in memory, with the store and its sessions and connections
+// sharing them.
+func (p *MyPlainKV) RegisterUpgrader(bucket string, fn Upgrader) {
+	p.shared().upgraders.mu.Lock()
+	defer p.shared().upgraders.mu.Unlock()
+	if fn == nil {
+		delete(p.shared().upgraders.fns, p.bucket(bucket))
+		return
+	}
+	if p.shared().upgraders.fns == nil {
+		p.shared().upgraders.fns = make(map[string]Upgrader)
+	}
+	p.shared().upgraders.fns[p.bucket(bucket)] = fn
+}
+
+// getUpgraded reads a value and upgrades it. The read takes no
+// transaction; only a value the upgrader converts is read again with its
+// version, to be written back if nobody wrote the key since. A failed
+// write-back is noted but does not fail the read, as the upgraded value
+// is still correct.
+func (p *MyPlainKV) getUpgraded(bucket string, key string, up Upgrader) ([]byte, error) {
+	val, err := p.fetch(bucket, key)
+	if err != nil || len(val) == 0 {
+		return val, err
+	}
+	nv, ok := up(val)
+	if !ok {
+		return val, nil
+	}
+	// The version must be read with the value it belongs to
+	cur, ver, err := p.getWithVersion(bucket, key)
+	if err != nil || len(cur) == 0 {
+		p.noteErr(err)
+		return nv, nil
+	}
+	if nv, ok = up(cur); !ok {
+		return cur, nil
+	}
+	// An alias has no version of its own, so its target is left as is.
+	// A conflict means the key was written since, so it is not upgraded.
+	if ver > 0 {
+		if err = p.updateIfVersion(bucket, key, nv, ver, true); !errors.Is(err, ErrVersionConflict) {
+			p.noteErr(err)
+		}
+	}
+	return nv, nil
+}
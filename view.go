@@ -0,0 +1,166 @@
+package myplainkv
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrReadOnlyView error = errors.New(`view is read-only`)
+	ErrInvalidView  error = errors.New(`view cannot read from itself, directly or through other views`)
+)
+
+// view is a virtual bucket exposing a filtered, transformed subset of
+// another bucket
+type view struct {
+	source    string
+	pattern   string
+	transform func([]byte) []byte
+}
+
+// viewSet holds the views registered on a store
+type viewSet struct {
+	mu    sync.RWMutex
+	views map[string]*view
+}
+
+func (vs *viewSet) get(name string) *view {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return vs.views[name]
+}
+
+// chain returns the bucket a view reads from in the end, following views
+// of views, along with the key prefixes of every view on the way. A
+// bucket that is not a view is its own source, with no prefixes.
+func (vs *viewSet) chain(bucket string) (string, []string) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	var patterns []string
+	for v := vs.views[bucket]; v != nil; v = vs.views[bucket] {
+		bucket = v.source
+		patterns = append(patterns, v.pattern)
+	}
+	return bucket, patterns
+}
+
+// inView reports whether a key matches every prefix of a view chain
+func inView(key string, patterns []string) bool {
+	for _, pat := range patterns {
+		if !likeMatch(key, pat+`%`) {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateView registers a read-only virtual bucket named name. Get and
+// ListKeys on it read the keys of source matching keyPattern, a LIKE
+// prefix as in ListKeys, passing values through transform if it is not
+// nil. Writes to the view fail with ErrReadOnlyView. Views are defined
+// in memory; the sessions and connections of the store see them, other
+// instances do not.
+func (p *MyPlainKV) CreateView(name, source, keyPattern string, transform func([]byte) []byte) error {
+	name, source = p.bucket(name), p.bucket(source)
+	if name == source {
+		return ErrInvalidView
+	}
+	p.shared().views.mu.Lock()
+	defer p.shared().views.mu.Unlock()
+	if p.shared().views.views == nil {
+		p.shared().views.views = make(map[string]*view)
+	}
+	// A view may read from a view, as long as the chain ends in a bucket
+	for src := p.shared().views.views[source]; src != nil; src = p.shared().views.views[src.source] {
+		if src.source == name {
+			return ErrInvalidView
+		}
+	}
+	p.shared().views.views[name] = &view{
+		source:    source,
+		pattern:   keyPattern,
+		transform: transform,
+	}
+	return nil
+}
+
+// DropView removes a view
+func (p *MyPlainKV) DropView(name string) {
+	p.shared().views.mu.Lock()
+	defer p.shared().views.mu.Unlock()
+	delete(p.shared().views.views, p.bucket(name))
+}
+
+// getView reads a key through a view
+func (p *MyPlainKV) getView(v *view, key string, fn func(val sql.RawBytes) error) (bool, error) {
+	if !likeMatch(key, v.pattern+`%`) {
+		return false, nil
+	}
+	val := make([]byte, 0)
+	found, err := p.getRaw(v.source, key, func(raw sql.RawBytes) error {
+		val = append(val, raw...)
+		return nil
+	})
+	if err != nil || !found {
+		return found, err
+	}
+	if v.transform != nil {
+		val = v.transform(val)
+	}
+	return true, fn(val)
+}
+
+// listView lists the keys of a view matching the LIKE pattern
+func (p *MyPlainKV) listView(v *view, like string) ([]string, error) {
+	keys, err := p.listKeys(v.source, v.pattern)
+	if err != nil || like == `%` {
+		return keys, err
+	}
+	val := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if likeMatch(k, like) {
+			val = append(val, k)
+		}
+	}
+	return val, nil
+}
+
+// likeMatch matches s against a LIKE pattern case-insensitively, where %
+// matches any run of characters, _ matches one and \ escapes either
+func likeMatch(s, pattern string) bool {
+	sr := []rune(strings.ToLower(s))
+	pr := []rune(strings.ToLower(pattern))
+	var match func(i, j int) bool
+	match = func(i, j int) bool {
+		for j < len(pr) {
+			switch pr[j] {
+			case '%':
+				for k := i; k <= len(sr); k++ {
+					if match(k, j+1) {
+						return true
+					}
+				}
+				return false
+			case '_':
+				if i >= len(sr) {
+					return false
+				}
+			case '\\':
+				if j+1 < len(pr) {
+					j++
+				}
+				fallthrough
+			default:
+				if i >= len(sr) || sr[i] != pr[j] {
+					return false
+				}
+			}
+			i++
+			j++
+		}
+		return i == len(sr)
+	}
+	return match(0, 0)
+}
@@ -0,0 +1,69 @@
+package myplainkv
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLikeMatch(t *testing.T) {
+	cases := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{`users/1`, `users/%`, true},
+		{`Users/1`, `users/%`, true},
+		{`orders/1`, `users/%`, false},
+		{`item_1`, `item\_%`, true},
+		{`itemX1`, `item\_%`, false},
+		{`a1c`, `a_c`, true},
+		{`ac`, `a_c`, false},
+		{`anything`, `%`, true},
+	}
+	for _, c := range cases {
+		if got := likeMatch(c.s, c.pattern); got != c.want {
+			t.Logf(`likeMatch(%q, %q) = %v, want %v`, c.s, c.pattern, got, c.want)
+			t.Fail()
+		}
+	}
+}
+
+func TestViewCycle(t *testing.T) {
+	pkv := NewMyPlainKV("", false)
+	if err := pkv.CreateView(`a`, `a`, ``, nil); !errors.Is(err, ErrInvalidView) {
+		t.Logf(`Expected ErrInvalidView for a view of itself, got %v`, err)
+		t.Fail()
+	}
+	if err := pkv.CreateView(`a`, `b`, ``, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := pkv.CreateView(`b`, `a`, ``, nil); !errors.Is(err, ErrInvalidView) {
+		t.Logf(`Expected ErrInvalidView for a two-view cycle, got %v`, err)
+		t.Fail()
+	}
+	if err := pkv.CreateView(`b`, `c`, ``, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := pkv.CreateView(`c`, `a`, ``, nil); !errors.Is(err, ErrInvalidView) {
+		t.Logf(`Expected ErrInvalidView for a three-view cycle, got %v`, err)
+		t.Fail()
+	}
+}
+
+func TestViewChain(t *testing.T) {
+	pkv := NewMyPlainKV("", false)
+	pkv.CreateView(`users`, `default`, `user:`, nil)
+	pkv.CreateView(`admins`, `users`, `user:admin`, nil)
+	src, pats := pkv.shared().views.chain(`admins`)
+	if src != `default` || len(pats) != 2 {
+		t.Logf(`Expected two views on default, got %s and %q`, src, pats)
+		t.Fail()
+	}
+	if !inView(`user:admin:1`, pats) || inView(`user:1`, pats) {
+		t.Logf(`Expected keys to match every view on the way`)
+		t.Fail()
+	}
+	if src, pats = pkv.shared().views.chain(`default`); src != `default` || pats != nil {
+		t.Logf(`Expected a bucket to be its own source, got %s and %q`, src, pats)
+		t.Fail()
+	}
+}
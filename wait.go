@@ -0,0 +1,46 @@
+package myplainkv
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	waitPollInterval time.Duration = 250 * time.Millisecond
+)
+
+// WaitFor polls a key until it exists and its value satisfies predicate,
+// returning the value. A nil predicate waits for the key to exist.
+// It returns the context's error if the context expires first.
+func (p *MyPlainKV) WaitFor(ctx context.Context, key string, predicate func([]byte) bool) ([]byte, error) {
+	return p.waitFor(ctx, p.currBuckt, key, predicate)
+}
+
+func (p *MyPlainKV) waitFor(ctx context.Context, bucket, key string, predicate func([]byte) bool) ([]byte, error) {
+	tkr := time.NewTicker(waitPollInterval)
+	defer tkr.Stop()
+	for {
+		val := make([]byte, 0)
+		found, err := p.getRaw(bucket, key, func(raw sql.RawBytes) error {
+			val = append(val, raw...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found && (predicate == nil || predicate(val)) {
+			return val, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-tkr.C:
+		}
+	}
+}
+
+// WaitFor polls a key in the bucket until it exists and satisfies predicate
+func (b *Bucket) WaitFor(ctx context.Context, key string, predicate func([]byte) bool) ([]byte, error) {
+	return b.kv.waitFor(ctx, b.name, key, predicate)
+}